@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	styx "github.com/underlay/styx"
+)
+
+const readScope = "read"
+const writeScope = "write"
+
+// An authorizer checks bearer tokens against their scopes. A nil authorizer allows everything.
+type authorizer struct {
+	tokens map[string][]string
+	public bool // Whether reads are allowed without a token
+}
+
+// loadTokens reads a JSON object mapping bearer tokens to lists of scopes
+func loadTokens(path string, public bool) (*authorizer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &authorizer{public: public}
+	err = json.Unmarshal(data, &auth.tokens)
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// requiredScope is write for requests that modify the store, including registering
+// queries with POST /q:, and read for everything else
+func requiredScope(r *http.Request) string {
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		return writeScope
+	} else if r.Method == http.MethodPost && r.URL.Path == "/"+styx.QueryURIScheme {
+		return writeScope
+	}
+	return readScope
+}
+
+// authorize returns the HTTP status to fail the request with, or 0 if it's allowed.
+// Tokens are read from the Authorization header, or from the access_token query
+// parameter since browsers can't set headers on websocket requests.
+func (auth *authorizer) authorize(r *http.Request) int {
+	if auth == nil || r.Method == http.MethodOptions {
+		return 0
+	}
+
+	scope := requiredScope(r)
+	if scope == readScope && auth.public {
+		return 0
+	}
+
+	token := r.URL.Query().Get("access_token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = header[len("Bearer "):]
+	}
+
+	scopes, has := auth.tokens[token]
+	if token == "" || !has {
+		return http.StatusUnauthorized
+	}
+
+	for _, s := range scopes {
+		if s == scope {
+			return 0
+		}
+	}
+	return http.StatusForbidden
+}
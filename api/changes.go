@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type changeRecord struct {
+	Event   string    `json:"event"`
+	Dataset string    `json:"dataset"`
+	Quads   int       `json:"quads"`
+	Time    time.Time `json:"time"`
+}
+
+// serveChanges returns the changelog after ?since= (an RFC 3339 timestamp), oldest first.
+// Passing the time of the last change as ?since= returns the next page.
+func (api *httpAPI) serveChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	limit, err := getLimit(r)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	changes := api.store.Changes(since)
+	defer changes.Close()
+
+	result := []*changeRecord{}
+	for len(result) < limit {
+		change, err := changes.Next()
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		} else if change == nil {
+			break
+		}
+		result = append(result, &changeRecord{change.Event, change.Dataset.Value(), change.Quads, change.Time})
+	}
+
+	w.Header().Add("Content-Type", jsonMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	websocket "github.com/gorilla/websocket"
+	styx "github.com/underlay/styx"
+	fixtures "github.com/underlay/styx/fixtures"
+)
+
+func TestConformance(t *testing.T) {
+	fixtures.Conform(t, filepath.Join("..", "fixtures", "conformance"), func(store *styx.Store) http.Handler {
+		api := &httpAPI{store: store}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				handleRPC(w, r, store)
+			} else {
+				api.ServeHTTP(w, r)
+			}
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ld "github.com/piprate/json-gold/ld"
+	styx "github.com/underlay/styx"
+)
+
+// loadContexts reads a JSON file mapping context URLs to file paths (relative to the
+// file) and returns a loader that serves those files, falling back to next
+func loadContexts(path string, next ld.DocumentLoader) (ld.DocumentLoader, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files map[string]string
+	err = json.Unmarshal(data, &files)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make(map[string]io.Reader, len(files))
+	for url, file := range files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+		documents[url] = f
+	}
+
+	return styx.NewStaticLoader(documents, next)
+}
+
+// loadGraphQLContext reads a JSON-LD context from a file, which is either
+// the context itself or a document with an "@context"
+func loadGraphQLContext(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var context interface{}
+	err = json.Unmarshal(data, &context)
+	if err != nil {
+		return nil, err
+	}
+
+	if document, is := context.(map[string]interface{}); is {
+		if value, has := document["@context"]; has {
+			return value, nil
+		}
+	}
+	return context, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// fragmentPageSize is the number of triples in each page of a triple pattern fragment
+const fragmentPageSize = 100
+
+const hydra = "http://www.w3.org/ns/hydra/core#"
+const void = "http://rdfs.org/ns/void#"
+const xsdInteger = "http://www.w3.org/2001/XMLSchema#integer"
+
+// serveFragment serves Triple Pattern Fragments: the subject, predicate and object
+// query parameters are terms in N-Triples syntax, and missing ones are unbound.
+// The response lists a page of matching triples, followed by the total count and
+// paging controls as hydra and VoID metadata about the fragment's URL.
+func (api *httpAPI) serveFragment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	query := r.URL.Query()
+	var terms [3]rdf.Term
+	for i, key := range []string{"subject", "predicate", "object"} {
+		if value := query.Get(key); value != "" {
+			term, err := rdf.ParseTerm(value)
+			if err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			terms[i] = term
+		}
+	}
+
+	page := 1
+	if value := query.Get("page"); value != "" {
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 1 {
+			w.WriteHeader(400)
+			return
+		}
+		page = p
+	}
+
+	fragment, err := api.store.Fragment(terms[0], terms[1], terms[2], (page-1)*fragmentPageSize, fragmentPageSize)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	self := rdf.NewNamedNode(fragmentURL(r, query, page))
+	count := rdf.NewLiteral(strconv.FormatUint(fragment.Count, 10), "", rdf.NewNamedNode(xsdInteger))
+	metadata := []*rdf.Quad{
+		rdf.NewQuad(self, rdf.NewNamedNode(void+"triples"), count, rdf.Default),
+		rdf.NewQuad(self, rdf.NewNamedNode(hydra+"totalItems"), count, rdf.Default),
+	}
+	if uint64(page*fragmentPageSize) < fragment.Count {
+		next := rdf.NewNamedNode(fragmentURL(r, query, page+1))
+		metadata = append(metadata, rdf.NewQuad(self, rdf.NewNamedNode(hydra+"next"), next, rdf.Default))
+	}
+	if page > 1 {
+		previous := rdf.NewNamedNode(fragmentURL(r, query, page-1))
+		metadata = append(metadata, rdf.NewQuad(self, rdf.NewNamedNode(hydra+"previous"), previous, rdf.Default))
+	}
+
+	w.Header().Add("Content-Type", nQuadsMime)
+	w.WriteHeader(200)
+	for _, quad := range append(fragment.Triples, metadata...) {
+		w.Write([]byte(quad.String()))
+		w.Write([]byte{'\n'})
+	}
+}
+
+func fragmentURL(r *http.Request, query url.Values, page int) string {
+	values := url.Values{}
+	for _, key := range []string{"subject", "predicate", "object"} {
+		if value := query.Get(key); value != "" {
+			values.Set(key, value)
+		}
+	}
+	values.Set("page", strconv.Itoa(page))
+	return fmt.Sprintf("%s%s?%s", prefix, r.URL.Path, values.Encode())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	styx "github.com/underlay/styx"
+)
+
+// gatewayMaxAge is how long (in seconds) clients and caches may reuse gateway responses
+const gatewayMaxAge = "60"
+
+var gatewayLimits = &styx.Limits{MaxQuads: 16, MaxVariables: 12}
+
+// gatewayLimit caps ?limit= on the gateway
+const gatewayLimit = 1000
+
+// gatewayAllowed rejects everything but queries and reads, caps result sizes,
+// and marks the responses as cacheable
+func gatewayAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodOptions {
+		w.WriteHeader(405)
+		return false
+	} else if r.Method == http.MethodPost && r.URL.Path != "/" && r.URL.Path != "/graphql" {
+		w.WriteHeader(404)
+		return false
+	}
+
+	query := r.URL.Query()
+	if limit, err := getLimit(r); err == nil && limit > gatewayLimit {
+		query.Set("limit", strconv.Itoa(gatewayLimit))
+		r.URL.RawQuery = query.Encode()
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Cache-Control", "public, max-age="+gatewayMaxAge)
+	}
+	return true
+}
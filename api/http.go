@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	content "github.com/joeltg/negotiate/content"
 	ld "github.com/piprate/json-gold/ld"
@@ -14,7 +16,8 @@ import (
 )
 
 type httpAPI struct {
-	store *styx.Store
+	store     *styx.Store
+	templates map[string]*template
 }
 
 var jsonMime = "application/json"
@@ -22,7 +25,69 @@ var nQuadsMime = "application/n-quads"
 var jsonLdMime = "application/ld+json"
 var offers = []string{jsonMime, jsonLdMime, nQuadsMime}
 
+type graphRecord struct {
+	Graph    string    `json:"graph"`
+	Quads    uint64    `json:"quads"`
+	Bytes    uint64    `json:"bytes"`
+	Modified time.Time `json:"modified"`
+}
+
+func (api *httpAPI) serveGraphs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	records, err := api.store.Graphs(r.Context())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	result := make([]*graphRecord, len(records))
+	for i, record := range records {
+		result[i] = &graphRecord{record.Node.Value(), record.Quads, record.Bytes, record.Modified}
+	}
+
+	w.Header().Add("Content-Type", jsonMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
 func (api *httpAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/graphs" {
+		api.serveGraphs(w, r)
+		return
+	} else if r.URL.Path == "/fragments" {
+		api.serveFragment(w, r)
+		return
+	} else if r.URL.Path == "/summary" {
+		api.serveSummary(w, r)
+		return
+	} else if strings.HasPrefix(r.URL.Path, "/queries/") {
+		api.serveTemplate(w, r)
+		return
+	} else if strings.HasPrefix(r.URL.Path, "/"+styx.QueryURIScheme) {
+		api.serveRegistered(w, r)
+		return
+	} else if r.URL.Path == "/changes" {
+		api.serveChanges(w, r)
+		return
+	} else if r.URL.Path == "/stats" {
+		api.serveStats(w, r)
+		return
+	} else if r.URL.Path == "/graphql" {
+		api.store.GraphQLHandler().ServeHTTP(w, r)
+		return
+	} else if r.URL.Path == "/void" {
+		api.serveVoID(w, r)
+		return
+	} else if r.Method == http.MethodPost {
+		api.serveQuery(w, r)
+		return
+	}
+
 	var node rdf.Term = rdf.Default
 	if r.URL.RawQuery != "" {
 		_, err := url.Parse(r.URL.RawQuery)
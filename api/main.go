@@ -1,25 +1,50 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v2"
+	options "github.com/dgraph-io/badger/v2/options"
+	ld "github.com/piprate/json-gold/ld"
 	cors "github.com/rs/cors"
 
 	styx "github.com/underlay/styx"
 )
 
 var path = os.Getenv("STYX_PATH")
+var host = os.Getenv("STYX_HOST")
 var port = os.Getenv("STYX_PORT")
 var prefix = os.Getenv("STYX_PREFIX")
+var queries = os.Getenv("STYX_QUERIES")
+var socket = os.Getenv("STYX_SOCKET")
+var tokens = os.Getenv("STYX_TOKENS")
+var publicRead = os.Getenv("STYX_PUBLIC_READ") != ""
+var gateway = os.Getenv("STYX_GATEWAY") != ""
+var tlsCert = os.Getenv("STYX_TLS_CERT")
+var tlsKey = os.Getenv("STYX_TLS_KEY")
+var verifyChecksums = os.Getenv("STYX_VERIFY_CHECKSUMS") != ""
+var webhooks = os.Getenv("STYX_WEBHOOKS")
+var webhookSecret = os.Getenv("STYX_WEBHOOK_SECRET")
+var contexts = os.Getenv("STYX_CONTEXTS")
+var sequenceBandwidth = os.Getenv("STYX_SEQUENCE_BANDWIDTH")
+var zstdLevel = os.Getenv("STYX_ZSTD_LEVEL")
+var queryTTL = os.Getenv("STYX_QUERY_TTL")
+var pipelineFile = os.Getenv("STYX_PIPELINES")
+var graphqlContext = os.Getenv("STYX_GRAPHQL_CONTEXT")
+var varintKeys = os.Getenv("STYX_VARINT_KEYS") != ""
 
 func init() {
 	if path == "" {
-		log.Println("Using default path /tmp/styx")
-		path = "/tmp/styx"
+		path = filepath.Join(os.TempDir(), "styx")
+		log.Println("Using default path", path)
 	}
 	if port == "" {
 		log.Println("Using default port 8086")
@@ -33,22 +58,88 @@ func init() {
 }
 
 func main() {
-	opt := badger.DefaultOptions(path)
+	opt := platformOptions(badger.DefaultOptions(path)).WithVerifyValueChecksum(verifyChecksums)
+
+	// STYX_ZSTD_LEVEL compresses the LSM tree's blocks with ZSTD instead of Snappy
+	if zstdLevel != "" {
+		level, err := strconv.Atoi(zstdLevel)
+		if err != nil || level < 1 {
+			log.Fatalln("Invalid STYX_ZSTD_LEVEL", zstdLevel)
+		}
+		opt = opt.WithCompression(options.ZSTD).WithZSTDCompressionLevel(level)
+	}
+
 	db, err := badger.Open(opt)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	tags := styx.NewPrefixTagScheme(prefix)
-	dictionary, err := styx.MakeIriDictionary(tags, db)
+	bandwidth := uint64(styx.SequenceBandwidth)
+	if sequenceBandwidth != "" {
+		bandwidth, err = strconv.ParseUint(sequenceBandwidth, 10, 64)
+		if err != nil || bandwidth == 0 {
+			log.Fatalln("Invalid STYX_SEQUENCE_BANDWIDTH", sequenceBandwidth)
+		}
+	}
+
+	dictionary, err := styx.MakeIriDictionaryWithBandwidth(tags, db, bandwidth)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
+	var loader ld.DocumentLoader = styx.NewContextCache(db, styx.NewDIDLoader(ld.NewDefaultDocumentLoader(nil)))
+
+	// STYX_CONTEXTS is a JSON file mapping context URLs to local files that are served instead
+	if contexts != "" {
+		loader, err = loadContexts(contexts, loader)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	config := &styx.Config{
-		TagScheme:  tags,
-		Dictionary: dictionary,
-		QuadStore:  styx.MakeBadgerStore(db),
+		TagScheme:      tags,
+		Dictionary:     dictionary,
+		QuadStore:      styx.MakeBadgerStore(db),
+		DocumentLoader: loader,
+		Dir:            path,
+		// STYX_VERIFY_CHECKSUMS also stores checksums with the index values that styx writes
+		Checksums: verifyChecksums,
+	}
+
+	// STYX_VARINT_KEYS creates new databases with the smaller varint key layout
+	if varintKeys {
+		config.KeyLayout = styx.VarintKeyLayout
+	}
+
+	// STYX_QUERY_TTL is how long registered queries are kept, like "24h"
+	if queryTTL != "" {
+		config.QueryTTL, err = time.ParseDuration(queryTTL)
+		if err != nil || config.QueryTTL <= 0 {
+			log.Fatalln("Invalid STYX_QUERY_TTL", queryTTL)
+		}
+	}
+
+	// STYX_PIPELINES is a JSON file of the transformers applied to each endpoint's solutions
+	if pipelineFile != "" {
+		pipelines, err = loadPipelines(pipelineFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// STYX_GRAPHQL_CONTEXT is a JSON-LD context file that the field names of /graphql queries are expanded with
+	if graphqlContext != "" {
+		config.GraphQLContext, err = loadGraphQLContext(graphqlContext)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// STYX_GATEWAY runs a public, read-only query gateway with strict pattern limits
+	if gateway {
+		config.Limits = gatewayLimits
 	}
 
 	store, err := styx.NewStore(config, db)
@@ -59,20 +150,74 @@ func main() {
 
 	defer store.Close()
 
+	// "styx doctor" prints the results of the store's self-test and exits
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		healthy := true
+		for _, d := range store.SelfTest() {
+			status := "ok"
+			if !d.OK {
+				status, healthy = "FAIL", false
+			}
+			fmt.Printf("[%s] %s: %s\n", status, d.Check, d.Message)
+		}
+		if !healthy {
+			store.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// STYX_WEBHOOKS is a comma-separated list of URLs that get notified of ingestions
+	for _, url := range strings.Split(webhooks, ",") {
+		if url == "" {
+			continue
+		}
+		hook := &styx.Webhook{URL: url}
+		if webhookSecret != "" {
+			hook.Secret = []byte(webhookSecret)
+		}
+		if _, err := store.AddWebhook(hook); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// STYX_TOKENS is a JSON file mapping bearer tokens to their "read" and "write" scopes
+	var auth *authorizer
+	if tokens != "" {
+		auth, err = loadTokens(tokens, publicRead)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	api := &httpAPI{store: store}
+	if queries != "" {
+		api.templates, err = loadTemplates(queries)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
 	handler := cors.New(cors.Options{
 		AllowCredentials: false,
 		AllowedMethods: []string{
 			http.MethodGet,
 			http.MethodPut,
+			http.MethodPost,
 			http.MethodDelete,
 		},
-		AllowedHeaders: []string{"Content-Type", "Accept"},
-		ExposedHeaders: []string{"Content-Type"},
+		AllowedHeaders: []string{"Content-Type", "Accept", "Authorization"},
+		ExposedHeaders: []string{"Content-Type", continuationHeader},
 		Debug:          false,
 	}).Handler(api)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if status := auth.authorize(r); status != 0 {
+			w.WriteHeader(status)
+			return
+		} else if gateway && !gatewayAllowed(w, r) {
+			return
+		}
+
 		conns := strings.Split(r.Header.Get("Connection"), ", ")
 		for _, c := range conns {
 			if c == "Upgrade" && r.Header.Get("Upgrade") == "websocket" {
@@ -83,5 +228,20 @@ func main() {
 		handler.ServeHTTP(w, r)
 	})
 
-	log.Fatalln(http.ListenAndServe(":"+port, nil))
+	// STYX_SOCKET serves on a unix domain socket instead of STYX_HOST:STYX_PORT
+	var listener net.Listener
+	if socket != "" {
+		os.Remove(socket)
+		listener, err = net.Listen("unix", socket)
+	} else {
+		listener, err = net.Listen("tcp", net.JoinHostPort(host, port))
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if tlsCert != "" || tlsKey != "" {
+		log.Fatalln(http.ServeTLS(listener, nil, tlsCert, tlsKey))
+	}
+	log.Fatalln(http.Serve(listener, nil))
 }
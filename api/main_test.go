@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "styx-tokens.json")
+	err := ioutil.WriteFile(path, []byte(`{"reader": ["read"], "writer": ["read", "write"]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	for _, public := range []bool{false, true} {
+		auth, err := loadTokens(path, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range []struct {
+			method   string
+			target   string
+			token    string
+			expected int
+		}{
+			{http.MethodGet, "/", "reader", 0},
+			{http.MethodPut, "/", "reader", http.StatusForbidden},
+			{http.MethodDelete, "/", "writer", 0},
+			{http.MethodPost, "/q:", "reader", http.StatusForbidden},
+			{http.MethodPost, "/", "reader", 0},
+			{http.MethodPut, "/", "", http.StatusUnauthorized},
+			{http.MethodPut, "/", "nobody", http.StatusUnauthorized},
+			{http.MethodGet, "/?access_token=reader", "", 0},
+			{http.MethodOptions, "/", "", 0},
+			{http.MethodGet, "/", "", http.StatusUnauthorized},
+		} {
+			r := httptest.NewRequest(c.method, c.target, nil)
+			if c.token != "" {
+				r.Header.Set("Authorization", "Bearer "+c.token)
+			}
+
+			expected := c.expected
+			if public && c.method == http.MethodGet {
+				expected = 0
+			}
+
+			if status := auth.authorize(r); status != expected {
+				t.Errorf("Expected %d for %s %s with %q (public %v), got %d", expected, c.method, c.target, c.token, public, status)
+			}
+		}
+	}
+
+	// Without tokens everything is allowed
+	var auth *authorizer
+	if status := auth.authorize(httptest.NewRequest(http.MethodPut, "/", nil)); status != 0 {
+		t.Errorf("Expected a nil authorizer to allow writes, got %d", status)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	for _, c := range []struct {
+		method   string
+		target   string
+		allowed  bool
+		status   int
+		rawQuery string
+	}{
+		{http.MethodPut, "/", false, http.StatusMethodNotAllowed, ""},
+		{http.MethodDelete, "/", false, http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/q:", false, http.StatusNotFound, ""},
+		{http.MethodPost, "/", true, http.StatusOK, ""},
+		{http.MethodPost, "/graphql", true, http.StatusOK, ""},
+		{http.MethodGet, "/?limit=5000", true, http.StatusOK, "limit=1000"},
+		{http.MethodGet, "/?limit=10", true, http.StatusOK, "limit=10"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(c.method, c.target, nil)
+		if allowed := gatewayAllowed(w, r); allowed != c.allowed || w.Code != c.status {
+			t.Errorf("Expected %s %s to be allowed %v with %d, got %v with %d", c.method, c.target, c.allowed, c.status, allowed, w.Code)
+		} else if r.URL.RawQuery != c.rawQuery {
+			t.Errorf("Expected the query of %s %s to be %q, got %q", c.method, c.target, c.rawQuery, r.URL.RawQuery)
+		} else if cached := w.Header().Get("Cache-Control") != ""; cached != (c.method == http.MethodGet) {
+			t.Errorf("Expected only GET responses to be cacheable, got %q for %s", w.Header().Get("Cache-Control"), c.method)
+		}
+	}
+}
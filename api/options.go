@@ -0,0 +1,11 @@
+//go:build !386 && !arm && !mips && !mipsle
+// +build !386,!arm,!mips,!mipsle
+
+package main
+
+import badger "github.com/dgraph-io/badger/v2"
+
+// platformOptions adjusts badger's options for the target platform
+func platformOptions(opt badger.Options) badger.Options {
+	return opt
+}
@@ -0,0 +1,19 @@
+//go:build 386 || arm || mips || mipsle
+// +build 386 arm mips mipsle
+
+package main
+
+import (
+	badger "github.com/dgraph-io/badger/v2"
+	options "github.com/dgraph-io/badger/v2/options"
+)
+
+// platformOptions adjusts badger's options for the target platform.
+// 32-bit platforms can't memory-map badger's default 1GB value log files,
+// so they use smaller files and plain file IO instead.
+func platformOptions(opt badger.Options) badger.Options {
+	return opt.
+		WithValueLogFileSize(64 << 20).
+		WithValueLogLoadingMode(options.FileIO).
+		WithTableLoadingMode(options.FileIO)
+}
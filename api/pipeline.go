@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	styx "github.com/underlay/styx"
+)
+
+// The endpoints that can be given their own pipeline
+const (
+	queryEndpoint    = "query"
+	rpcEndpoint      = "rpc"
+	preparedEndpoint = "prepared"
+)
+
+// pipelines are the transformers applied to the solutions of each endpoint's queries,
+// after the store's Config.Pipeline
+var pipelines = map[string][]styx.TransformerFactory{}
+
+// errInvalidTransform is returned for unknown transforms in STYX_PIPELINES
+var errInvalidTransform = errors.New("Invalid transform")
+
+type transformSpec struct {
+	Transform  string            `json:"transform"`
+	Prefixes   map[string]string `json:"prefixes"`
+	Predicates []string          `json:"predicates"`
+	Layout     string            `json:"layout"`
+}
+
+// loadPipelines reads a JSON file mapping endpoint names ("query", "rpc", "prepared")
+// to arrays of transforms like { "transform": "compactIRIs", "prefixes": { ... } }
+func loadPipelines(path string) (map[string][]styx.TransformerFactory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs map[string][]*transformSpec
+	err = json.Unmarshal(data, &specs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]styx.TransformerFactory, len(specs))
+	for endpoint, pipeline := range specs {
+		if endpoint != queryEndpoint && endpoint != rpcEndpoint && endpoint != preparedEndpoint {
+			return nil, errors.New("Invalid pipeline endpoint " + endpoint)
+		}
+
+		for _, spec := range pipeline {
+			factory, err := spec.factory()
+			if err != nil {
+				return nil, err
+			}
+			result[endpoint] = append(result[endpoint], factory)
+		}
+	}
+	return result, nil
+}
+
+func (spec *transformSpec) factory() (styx.TransformerFactory, error) {
+	switch spec.Transform {
+	case "dedupe":
+		return styx.Dedupe, nil
+	case "compactIRIs":
+		return func() styx.Transformer { return styx.CompactIRIs(spec.Prefixes) }, nil
+	case "redactPredicates":
+		return func() styx.Transformer { return styx.RedactPredicates(spec.Predicates...) }, nil
+	case "formatDates":
+		return func() styx.Transformer { return styx.FormatDates(spec.Layout) }, nil
+	default:
+		return nil, errInvalidTransform
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+	styx "github.com/underlay/styx"
+)
+
+// serveRegistered handles /q: paths. POST /q: registers the JSON-encoded query
+// pattern in the body and responds with its URI, and GET /q:<hash> executes
+// a registered query and responds with its solutions' graphs.
+func (api *httpAPI) serveRegistered(w http.ResponseWriter, r *http.Request) {
+	uri := strings.TrimPrefix(r.URL.Path, "/")
+	if r.Method == http.MethodPost && uri == styx.QueryURIScheme {
+		if r.Header.Get("Content-Type") != jsonMime {
+			w.WriteHeader(415)
+			return
+		}
+
+		var pattern []*rdf.Quad
+		err := json.NewDecoder(r.Body).Decode(&pattern)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		node, err := api.store.RegisterQuery(pattern)
+		if err == styx.ErrInvalidInput || err == styx.ErrQueryTooComplex {
+			w.WriteHeader(400)
+			return
+		} else if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Add("Location", "/"+node.Value())
+		w.WriteHeader(201)
+		w.Write([]byte(node.Value()))
+		return
+	} else if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	limit, err := getLimit(r)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+
+	opts := &styx.QueryOptions{Limit: limit, Pipeline: pipelines[preparedEndpoint]}
+	iter, err := api.store.QueryURI(r.Context(), rdf.NewNamedNode(uri), nil, nil, opts)
+	if err == styx.ErrNotFound {
+		w.WriteHeader(404)
+		return
+	} else if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	defer iter.Close()
+
+	graphs := [][]*rdf.Quad{}
+	for delta, err := iter.Next(nil); delta != nil; delta, err = iter.Next(nil) {
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		graphs = append(graphs, iter.Graph())
+	}
+
+	w.Header().Add("Content-Type", jsonMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(graphs)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ld "github.com/piprate/json-gold/ld"
+	rdf "github.com/underlay/go-rdfjs"
+	styx "github.com/underlay/styx"
+)
+
+// defaultLimit is the maximum number of solutions a query returns unless ?limit= is given
+const defaultLimit = 100
+
+// maxLimit caps ?limit=, so that responses are never serialized unbounded
+const maxLimit = 10000
+
+// continuationHeader carries the token to pass as ?after= to get the next page of solutions
+const continuationHeader = "X-Styx-Continuation"
+
+var proc = ld.NewJsonLdProcessor()
+
+// serveQuery runs a JSON-LD query pattern and frames the solutions with the pattern.
+// Nodes with "?"-prefixed ids are variables.
+func (api *httpAPI) serveQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != jsonLdMime {
+		w.WriteHeader(415)
+		return
+	}
+
+	limit, err := getLimit(r)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+
+	var query interface{}
+	err = json.NewDecoder(r.Body).Decode(&query)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	api.runQuery(w, r, query, limit)
+}
+
+func (api *httpAPI) runQuery(w http.ResponseWriter, r *http.Request, query interface{}, limit int) {
+	after, err := parseContinuation(r.URL.Query().Get("after"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	iter, err := api.store.QueryJSONLDWithOptions(query, &styx.QueryOptions{Pipeline: pipelines[queryEndpoint]})
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	defer iter.Close()
+
+	if after != nil {
+		err = iter.Seek(after)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	quads := []*rdf.Quad{}
+	for i := 0; i < limit; i++ {
+		delta, err := iter.Next(nil)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		} else if delta == nil {
+			break
+		}
+		quads = append(quads, iter.Graph()...)
+	}
+
+	// If there are more solutions, the next one's index is the continuation token
+	if delta, err := iter.Next(nil); err == nil && delta != nil {
+		if token := formatContinuation(iter.Index()); token != "" {
+			w.Header().Set(continuationHeader, token)
+		}
+	}
+
+	opts := ld.NewJsonLdOptions("")
+	opts.UseNativeTypes = true
+	opts.DocumentLoader = api.store.Config.DocumentLoader
+	expanded, err := ld.NewJsonLdApi().FromRDF(styx.ToRDFDataset(quads), opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	result, err := proc.Frame(expanded, toFrame(query), opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Add("Content-Type", jsonLdMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func getLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err == nil && limit < 0 {
+		err = strconv.ErrRange
+	} else if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, err
+}
+
+// formatContinuation encodes a solution's index as a URL-safe token
+func formatContinuation(index []rdf.Term) string {
+	values := make([]string, len(index))
+	for i, term := range index {
+		if term == nil {
+			return "" // Redacted solutions can't be resumed from
+		}
+		values[i] = term.String()
+	}
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseContinuation(token string) ([]rdf.Term, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make([]rdf.Term, len(values))
+	for i, value := range values {
+		index[i], err = rdf.ParseTerm(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// toFrame turns a query pattern into a frame by removing the ids of variables,
+// so that they match any node
+func toFrame(pattern interface{}) interface{} {
+	switch pattern := pattern.(type) {
+	case map[string]interface{}:
+		frame := make(map[string]interface{}, len(pattern))
+		for key, value := range pattern {
+			if id, is := value.(string); is && key == "@id" && strings.HasPrefix(id, "?") {
+				continue
+			}
+			frame[key] = toFrame(value)
+		}
+		return frame
+	case []interface{}:
+		frame := make([]interface{}, len(pattern))
+		for i, value := range pattern {
+			frame[i] = toFrame(value)
+		}
+		return frame
+	default:
+		return pattern
+	}
+}
@@ -29,11 +29,15 @@ func handleRPC(w http.ResponseWriter, r *http.Request, store *styx.Store) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 	stream := &jsonObjectStream{conn}
-	handler := &rpcHandler{store: store}
+	handler := &rpcHandler{store: store, ctx: ctx}
 	c := jsonrpc2.NewConn(ctx, stream, handler)
 	<-c.DisconnectNotify()
+	cancel()
+	for _, unsubscribe := range handler.subscriptions {
+		unsubscribe()
+	}
 	if handler.iter != nil {
 		handler.iter.Close()
 		handler.iter = nil
@@ -48,6 +52,9 @@ var methods = map[string]method{
 	"seek":  callSeek,
 	"prov":  callProv,
 	"close": callClose,
+
+	"subscribe":   callSubscribe,
+	"unsubscribe": callUnsubscribe,
 }
 
 func callQuery(params []json.RawMessage, store *styx.Store, handler *rpcHandler) (interface{}, int64, error) {
@@ -77,7 +84,8 @@ func callQuery(params []json.RawMessage, store *styx.Store, handler *rpcHandler)
 		}
 	}
 
-	handler.iter, err = store.Query(quads, domain, index)
+	opts := &styx.QueryOptions{Pipeline: pipelines[rpcEndpoint]}
+	handler.iter, err = store.QueryContext(handler.ctx, quads, domain, index, opts)
 	if err != nil {
 		return nil, jsonrpc2.CodeInternalError, err
 	}
@@ -175,8 +183,12 @@ func callProv(params []json.RawMessage, store *styx.Store, handler *rpcHandler)
 }
 
 type rpcHandler struct {
-	store *styx.Store
-	iter  *styx.Iterator
+	ctx           context.Context
+	conn          *jsonrpc2.Conn
+	store         *styx.Store
+	iter          *styx.Iterator
+	subscription  uint64
+	subscriptions map[uint64]func()
 }
 
 func (handler *rpcHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) {
@@ -184,6 +196,8 @@ func (handler *rpcHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, requ
 	var code int64
 	var err error
 
+	handler.conn = conn
+
 	if method, has := methods[request.Method]; !has {
 		code = jsonrpc2.CodeMethodNotFound
 	} else {
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+
+	jsonrpc2 "github.com/sourcegraph/jsonrpc2"
+	rdf "github.com/underlay/go-rdfjs"
+	styx "github.com/underlay/styx"
+)
+
+type solutionParams struct {
+	Subscription uint64     `json:"subscription"`
+	Solution     []rdf.Term `json:"solution"`
+}
+
+// callSubscribe registers a standing query and returns its subscription id.
+// New solutions are pushed as "solution" notifications until "unsubscribe" is called
+// or the connection closes.
+func callSubscribe(params []json.RawMessage, store *styx.Store, handler *rpcHandler) (interface{}, int64, error) {
+	if len(params) != 1 {
+		return nil, jsonrpc2.CodeInvalidParams, nil
+	}
+
+	quads := make([]*rdf.Quad, 0)
+	err := json.Unmarshal(params[0], &quads)
+	if err != nil || len(quads) == 0 {
+		return nil, jsonrpc2.CodeInvalidParams, err
+	}
+
+	results, cancel, err := store.Subscribe(quads)
+	if err != nil {
+		return nil, jsonrpc2.CodeInternalError, err
+	}
+
+	handler.subscription++
+	id := handler.subscription
+	if handler.subscriptions == nil {
+		handler.subscriptions = map[uint64]func(){}
+	}
+	handler.subscriptions[id] = cancel
+
+	conn := handler.conn
+	go func() {
+		for index := range results {
+			params := &solutionParams{Subscription: id, Solution: index}
+			if conn.Notify(handler.ctx, "solution", params) != nil {
+				return
+			}
+		}
+	}()
+
+	return id, 0, nil
+}
+
+func callUnsubscribe(params []json.RawMessage, store *styx.Store, handler *rpcHandler) (interface{}, int64, error) {
+	if len(params) != 1 {
+		return nil, jsonrpc2.CodeInvalidParams, nil
+	}
+
+	var id uint64
+	err := json.Unmarshal(params[0], &id)
+	if err != nil {
+		return nil, jsonrpc2.CodeInvalidParams, err
+	}
+
+	cancel, has := handler.subscriptions[id]
+	if !has {
+		return nil, jsonrpc2.CodeInvalidParams, nil
+	}
+
+	cancel()
+	delete(handler.subscriptions, id)
+	return nil, 0, nil
+}
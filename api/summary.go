@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+var summaryContext = map[string]interface{}{
+	"void":   "http://rdfs.org/ns/void#",
+	"rdfs":   "http://www.w3.org/2000/01/rdf-schema#",
+	"domain": map[string]interface{}{"@id": "rdfs:domain", "@type": "@id"},
+	"range":  map[string]interface{}{"@id": "rdfs:range", "@type": "@id"},
+}
+
+// serveSummary describes the class-level shape of the store as a VoID dataset
+// with one property partition for each domain, predicate and range
+func (api *httpAPI) serveSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	edges, err := api.store.Summary()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	partitions := make([]interface{}, len(edges))
+	for i, edge := range edges {
+		partitions[i] = map[string]interface{}{
+			"void:property": map[string]interface{}{"@id": edge.Predicate.Value()},
+			"void:triples":  edge.Count,
+			"domain":        edge.Domain.Value(),
+			"range":         edge.Range.Value(),
+		}
+	}
+
+	w.Header().Add("Content-Type", jsonLdMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"@context":               summaryContext,
+		"@id":                    prefix,
+		"@type":                  "void:Dataset",
+		"void:propertyPartition": partitions,
+	})
+}
+
+var voidContext = map[string]interface{}{
+	"void":             "http://rdfs.org/ns/void#",
+	"dcat":             "http://www.w3.org/ns/dcat#",
+	"dcterms":          "http://purl.org/dc/terms/",
+	"xsd":              "http://www.w3.org/2001/XMLSchema#",
+	"void:vocabulary":  map[string]interface{}{"@type": "@id"},
+	"dcterms:modified": map[string]interface{}{"@type": "xsd:dateTime"},
+}
+
+// serveVoID describes the store as a VoID and DCAT dataset
+func (api *httpAPI) serveVoID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	description, err := api.store.Describe()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	result := map[string]interface{}{
+		"@context":              voidContext,
+		"@id":                   prefix,
+		"@type":                 []string{"void:Dataset", "dcat:Dataset"},
+		"void:triples":          description.Triples,
+		"void:distinctSubjects": description.DistinctSubjects,
+		"void:distinctObjects":  description.DistinctObjects,
+		"void:properties":       description.Properties,
+		"void:vocabulary":       description.Vocabularies,
+	}
+	if !description.Modified.IsZero() {
+		result["dcterms:modified"] = description.Modified.UTC().Format(time.RFC3339)
+	}
+
+	w.Header().Add("Content-Type", jsonLdMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+type predicateStats struct {
+	Predicate        string `json:"predicate"`
+	Triples          uint64 `json:"triples"`
+	DistinctSubjects uint32 `json:"distinctSubjects"`
+	DistinctObjects  uint32 `json:"distinctObjects"`
+}
+
+type usageStats struct {
+	Quads uint64 `json:"quads"`
+	Bytes uint64 `json:"bytes"`
+}
+
+type peerStats struct {
+	Key string `json:"key"`
+	usageStats
+}
+
+// serveStats renders the counts that the query planner sees and the store's usage
+func (api *httpAPI) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	stats, err := api.store.Stats()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	predicates := make([]*predicateStats, len(stats.Predicates))
+	for i, p := range stats.Predicates {
+		predicates[i] = &predicateStats{p.Predicate.Value(), p.Triples, p.DistinctSubjects, p.DistinctObjects}
+	}
+
+	peers := make([]*peerStats, len(stats.Peers))
+	for i, p := range stats.Peers {
+		peers[i] = &peerStats{hex.EncodeToString(p.Key), usageStats{p.Quads, p.Bytes}}
+	}
+
+	w.Header().Add("Content-Type", jsonMime)
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"triples":    stats.Triples,
+		"terms":      stats.Terms,
+		"lsmSize":    stats.LSMSize,
+		"vlogSize":   stats.VlogSize,
+		"predicates": predicates,
+		"usage":      &usageStats{stats.Usage.Quads, stats.Usage.Bytes},
+		"peers":      peers,
+	})
+}
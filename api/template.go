@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// A template is a named JSON-LD query pattern with typed parameters. Each parameter
+// replaces the variable with the same name ({"@id": "?name"}) in the pattern.
+// Parameter types are "iri" or the IRI or compact xsd: name of a literal datatype.
+type template struct {
+	Query      interface{}       `json:"query"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+var errMissingParameter = errors.New("Missing template parameter")
+var errInvalidParameter = errors.New("Literal parameters can't be subjects")
+
+// loadTemplates reads every .json file in a directory as a template named by its file name
+func loadTemplates(dir string) (map[string]*template, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]*template, len(paths))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		t := &template{}
+		err = json.Unmarshal(data, t)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[strings.TrimSuffix(filepath.Base(path), ".json")] = t
+	}
+
+	return templates, nil
+}
+
+// serveTemplate runs the query template named by the path /queries/{name},
+// taking its parameters from the URL query
+func (api *httpAPI) serveTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		return
+	}
+
+	t, has := api.templates[strings.TrimPrefix(r.URL.Path, "/queries/")]
+	if !has {
+		w.WriteHeader(404)
+		return
+	}
+
+	limit, err := getLimit(r)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+
+	values := r.URL.Query()
+	for name := range t.Parameters {
+		if values.Get(name) == "" {
+			w.WriteHeader(400)
+			w.Write([]byte(errMissingParameter.Error() + ": " + name))
+			return
+		}
+	}
+
+	query, err := t.bind(t.Query, values.Get)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	api.runQuery(w, r, query, limit)
+}
+
+// bind returns a copy of the pattern with the parameters' variables replaced by their values
+func (t *template) bind(pattern interface{}, get func(string) string) (interface{}, error) {
+	switch pattern := pattern.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(pattern))
+		for key, value := range pattern {
+			id, is := value.(string)
+			if key != "@id" || !is || !strings.HasPrefix(id, "?") {
+				bound, err := t.bind(value, get)
+				if err != nil {
+					return nil, err
+				}
+				result[key] = bound
+				continue
+			}
+
+			datatype, has := t.Parameters[id[1:]]
+			if !has {
+				result[key] = value
+			} else if datatype == "iri" {
+				result[key] = get(id[1:])
+			} else if len(pattern) > 1 {
+				return nil, errInvalidParameter
+			} else {
+				return map[string]interface{}{"@value": get(id[1:]), "@type": expandDatatype(datatype)}, nil
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(pattern))
+		for i, value := range pattern {
+			bound, err := t.bind(value, get)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = bound
+		}
+		return result, nil
+	default:
+		return pattern, nil
+	}
+}
+
+func expandDatatype(datatype string) string {
+	if strings.HasPrefix(datatype, "xsd:") {
+		return "http://www.w3.org/2001/XMLSchema#" + datatype[4:]
+	}
+	return datatype
+}
@@ -0,0 +1,142 @@
+package styx
+
+import (
+	"encoding/binary"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// QueryAt is like Query, but only considers the triples that some dataset asserted at t.
+// With Config.History, this is resolved from the history of each triple, so triples that
+// a dataset kept across versions count from when they were first asserted. Triples without
+// history only count if their dataset was last inserted at or before t. Either way only the
+// current triples are searched, so triples that have been retracted since t are missing.
+func (s *Store) QueryAt(pattern []*rdf.Quad, t time.Time) (*Iterator, error) {
+	return s.QueryWithOptions(pattern, nil, nil, &QueryOptions{AsOf: t})
+}
+
+// asOfFilter returns a transformer that drops solutions with a quad that no dataset
+// asserted at t, according to the triples' history if it is recorded
+func asOfFilter(t time.Time, history bool) Transformer {
+	// The datasets' usage records are read once per query
+	inserted := map[iri]bool{}
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		for _, quad := range iter.query {
+			ids := [3]ID{iter.lookup(quad[0]), iter.lookup(quad[1]), iter.lookup(quad[2])}
+
+			if history {
+				asserted, recorded, err := iter.assertedAt(ids, t)
+				if err != nil || recorded && !asserted {
+					return nil
+				} else if recorded {
+					continue
+				}
+			}
+
+			statements, err := iter.getStatements(ids)
+			if err != nil {
+				return nil
+			}
+
+			asserted := false
+			for _, statement := range statements {
+				if statement == nil {
+					continue
+				}
+
+				before, has := inserted[statement.base]
+				if !has {
+					before = insertedBefore(ID(statement.base), t, iter.txn)
+					inserted[statement.base] = before
+				}
+
+				if before {
+					asserted = true
+					break
+				}
+			}
+
+			if !asserted {
+				return nil
+			}
+		}
+		return index
+	})
+}
+
+// assertedAt replays the history of a triple up to t and reports whether any dataset
+// asserted it then, and whether the triple has any history at all
+func (iter *Iterator) assertedAt(ids [3]ID, t time.Time) (asserted, recorded bool, err error) {
+	var terms [3]rdf.Term
+	for i, id := range ids {
+		terms[i], err = iter.dictionary.GetTerm(id, rdf.Default)
+		if err != nil {
+			return
+		}
+	}
+
+	prefix := historyPrefix(terms[0], terms[1], terms[2])
+	cursor := iter.txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer cursor.Close()
+
+	open := map[string]bool{}
+	for cursor.Seek(prefix); cursor.ValidForPrefix(prefix); cursor.Next() {
+		recorded = true
+		item := cursor.Item()
+		key := item.Key()[len(prefix):]
+		if len(key) < 8 {
+			return false, true, ErrCorruptIndex
+		}
+
+		// Events are sorted by time, so the rest happened after t
+		if time.Unix(0, int64(binary.BigEndian.Uint64(key[:8]))).After(t) {
+			break
+		}
+
+		dataset := string(key[8:])
+		err = item.Value(func(val []byte) error {
+			if len(val) != 1 {
+				return ErrCorruptIndex
+			}
+			open[dataset] = val[0] == historyAsserted
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	for _, asserting := range open {
+		if asserting {
+			return true, recorded, nil
+		}
+	}
+	return false, recorded, nil
+}
+
+// getStatements returns the statements of a triple
+func (iter *Iterator) getStatements(ids [3]ID) (statements []*Statement, err error) {
+	item, err := iter.txn.Get(assembleKey(TernaryPrefixes[0], false, ids[0], ids[1], ids[2]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = item.Value(func(val []byte) (err error) {
+		statements, err = getStatements(val)
+		return
+	})
+	return
+}
+
+// insertedBefore reports whether a dataset was last inserted at or before t.
+// Usage records written before timestamps were added count as inserted before any time.
+func insertedBefore(origin ID, t time.Time, txn KVTxn) bool {
+	item, err := txn.Get(assembleKey(UsagePrefix, false, origin))
+	if err != nil {
+		return false
+	}
+
+	usage, err := parseUsage(item)
+	return err == nil && !usage.Modified.After(t)
+}
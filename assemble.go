@@ -1,21 +1,25 @@
 package styx
 
 import (
+	"context"
 	"fmt"
 	"sort"
 
-	badger "github.com/dgraph-io/badger/v2"
 	rdf "github.com/underlay/go-rdfjs"
 )
 
 // NewIterator populates, scores, sorts, and connects a new constraint graph
 func newIterator(
+	ctx context.Context,
 	query []*rdf.Quad,
 	domain []rdf.Term,
 	index []rdf.Term,
 	tag TagScheme,
-	txn *badger.Txn,
+	txn KVTxn,
 	dictionary Dictionary,
+	prefetch int,
+	types []TypeHint,
+	languages []LanguageHint,
 ) (iter *Iterator, err error) {
 
 	if domain == nil {
@@ -23,6 +27,7 @@ func newIterator(
 	}
 
 	iter = &Iterator{
+		ctx:        ctx,
 		query:      query,
 		domain:     domain,
 		pivot:      len(domain),
@@ -34,6 +39,7 @@ func newIterator(
 		tag:        tag,
 		txn:        txn,
 		dictionary: dictionary,
+		prefetch:   prefetch,
 	}
 
 	var split bool
@@ -59,7 +65,17 @@ func newIterator(
 		return
 	}
 
+	if d, is := dictionary.(*iriDictionary); is {
+		if err = d.preload(query); err != nil {
+			return
+		}
+	}
+
 	for i, quad := range query {
+		if err = contextError(ctx); err != nil {
+			return
+		}
+
 		if quad.Graph().TermType() != rdf.DefaultGraphType {
 			continue
 		}
@@ -83,13 +99,14 @@ func newIterator(
 		}
 
 		if degree == 0 {
-			iter.constants = append(iter.constants, &constraint{index: i, quad: quad})
+			iter.constants = append(iter.constants, &constraint{index: i, quad: quad, cost: &iter.cost})
 		} else if degree == 1 {
 			// Only one of the terms is a blank node, so this is a first-degree constraint.
 			c := &constraint{
 				index: i,
 				quad:  quad,
 				terms: terms,
+				cost:  &iter.cost,
 			}
 
 			for ; c.place < 3; c.place++ {
@@ -123,6 +140,7 @@ func newIterator(
 					place: q,
 					quad:  quad,
 					terms: terms,
+					cost:  &iter.cost,
 				}
 				err = iter.insertDZ(variables[q], c, txn)
 				if err == ErrEndOfSolutions {
@@ -133,8 +151,8 @@ func newIterator(
 				}
 			} else {
 				neighbors := make([]*constraint, 3)
-				a := &constraint{index: i, place: q, quad: quad, terms: terms, neighbors: neighbors}
-				b := &constraint{index: i, place: r, quad: quad, terms: terms, neighbors: neighbors}
+				a := &constraint{index: i, place: q, quad: quad, terms: terms, neighbors: neighbors, cost: &iter.cost}
+				b := &constraint{index: i, place: r, quad: quad, terms: terms, neighbors: neighbors, cost: &iter.cost}
 				neighbors[r], neighbors[q] = b, a
 
 				err = iter.insertD2(variables[q], variables[r], a, txn)
@@ -154,7 +172,8 @@ func newIterator(
 				}
 			}
 		} else if degree == 3 {
-			return nil, fmt.Errorf("Cannot handle all-blank triple: %d", i)
+			err = fmt.Errorf("Cannot handle all-blank triple: %d", i)
+			return
 		}
 	}
 
@@ -167,16 +186,57 @@ func newIterator(
 		}
 	}
 
-	// Score the variables
+	// Narrow the constraints of variables with type hints to the literals of their datatype
+	for _, hint := range types {
+		i, has := iter.ids[hint.Variable.String()]
+		if !has {
+			continue
+		}
+
+		literals, err := newLiteralRange(hint.Datatype, dictionary)
+		if err != nil {
+			return nil, err
+		} else if literals == nil {
+			iter.empty = true
+			return iter, nil
+		}
+
+		for _, c := range iter.variables[i].cs {
+			c.literals = literals
+		}
+	}
+
+	// Intersect the variables with language hints with the literals in their language
+	for _, hint := range languages {
+		i, has := iter.ids[hint.Variable.String()]
+		if !has {
+			continue
+		}
+
+		c, err := iter.languageConstraint(hint, txn)
+		if err != nil {
+			return nil, err
+		} else if c.count == 0 {
+			iter.empty = true
+			return iter, nil
+		}
+
+		iter.variables[i].cs = append(iter.variables[i].cs, c)
+	}
+
+	// Score the variables. The number of values a variable can take is at most
+	// the count of its most selective constraint, so that's its score.
 	for _, u := range iter.variables {
 		u.norm = 0
+		u.score = 0
 
 		for _, c := range u.cs {
 			u.norm += uint64(c.count) * uint64(c.count)
+			if u.score == 0 || float64(c.count) < u.score {
+				u.score = float64(c.count)
+			}
 		}
 
-		u.score = float64(u.norm) / float64(u.cs.Len())
-
 		u.Sort()
 
 		u.root = u.cs.Seek(NIL)
@@ -193,7 +253,10 @@ func newIterator(
 
 	// Sorting keeps variables at indices less than iter.pivot in place
 	if len(domain) < len(iter.domain)+1 {
-		sort.Stable(iter)
+		err = iter.order(txn)
+		if err != nil {
+			return
+		}
 		// Now we're in a tricky spot. iter.domain and iter.variables
 		// have changed, but not iter.ids or the variable constraint maps.
 		transformation := make([]int, len(iter.domain))
@@ -237,10 +300,7 @@ func newIterator(
 				cs.Close()
 				for _, c := range cs {
 					p := TernaryPrefixes[(c.place+1)%3]
-					c.iterator = txn.NewIterator(badger.IteratorOptions{
-						PrefetchValues: false,
-						Prefix:         []byte{p},
-					})
+					c.iterator = iter.indexIterator([]byte{p}, txn)
 				}
 				delete(u.edges, j)
 			}
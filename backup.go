@@ -0,0 +1,148 @@
+package styx
+
+import (
+	"context"
+	"io"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// BackupPendingWrites is the number of pending writes allowed while loading a backup
+const BackupPendingWrites = 256
+
+// A BackupReport summarizes the contents of a backup
+type BackupReport struct {
+	Version uint64 // The highest version of any key, which can be passed to Backup as since
+	Keys    int
+	Graphs  []*GraphRecord
+}
+
+// Backup writes a full (since = 0) or incremental backup of the store to w,
+// and returns the version to pass as since for the next incremental backup.
+func (s *Store) Backup(w io.Writer, since uint64) (uint64, error) {
+	if s.Badger == nil {
+		return 0, ErrUnsupportedBackend
+	}
+	return s.Badger.Backup(w, since)
+}
+
+// VerifyBackup checks a backup by loading it into a temporary in-memory database,
+// and reports the datasets it contains without modifying the store.
+func (s *Store) VerifyBackup(r io.Reader) (*BackupReport, error) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	err = db.Load(r, BackupPendingWrites)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening a store writes to the database, so count the backup's keys first
+	report, err := countKeys(db)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{TagScheme: s.Config.TagScheme, Dictionary: s.Config.Dictionary}
+	if _, is := s.Config.Dictionary.(*iriDictionaryFactory); is {
+		config.Dictionary, err = MakeIriDictionary(s.Config.TagScheme, db)
+		if err != nil {
+			return nil, err
+		}
+		defer config.Dictionary.Close()
+	}
+
+	store, err := NewStore(config, db)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Graphs, err = store.Graphs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Restore loads a backup into the store. With dryRun, the backup is only verified
+// like VerifyBackup. Keys in the backup overwrite existing keys with older versions.
+func (s *Store) Restore(r io.Reader, dryRun bool) (*BackupReport, error) {
+	if dryRun {
+		return s.VerifyBackup(r)
+	} else if s.Badger == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	s.writer.Lock()
+	err := s.loadBackup(r)
+	s.writer.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.report()
+}
+
+// loadBackup loads a backup into the database and drops the caches that might be
+// stale. A backup can hold IDs past the dictionary's current lease of the ID counter,
+// so the counter is reconciled with the dictionary and leased again.
+// The caller has to hold the writer lock.
+func (s *Store) loadBackup(r io.Reader) error {
+	err := s.Badger.Load(r, BackupPendingWrites)
+	s.results.clear()
+	s.clearIDCache()
+	if err != nil {
+		return err
+	}
+
+	if layout, err := getLayout(s.KV); err != nil {
+		return err
+	} else if layout != s.Config.KeyLayout {
+		return ErrKeyLayout
+	}
+
+	if factory, is := s.Config.Dictionary.(*iriDictionaryFactory); is {
+		return factory.reset()
+	}
+	return nil
+}
+
+func (s *Store) report() (*BackupReport, error) {
+	report, err := countKeys(s.Badger)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Graphs, err = s.Graphs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// countKeys reports the number of keys in a database and their highest version
+func countKeys(db *badger.DB) (*BackupReport, error) {
+	report := &BackupReport{}
+	err := db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			report.Keys++
+			if version := iter.Item().Version(); version > report.Version {
+				report.Version = version
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,246 @@
+package styx
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// BulkLoad inserts a single dataset read from a channel into an empty store.
+// Instead of reading and writing the index keys for every quad, it aggregates
+// the triple statements and the binary and unary counts in memory and writes
+// the sorted keys in one batch. It stops when the channel is closed.
+// Stores that require signed datasets can't be bulk loaded. The dataset is checked by
+// the store's detectors like in Set, and rejected datasets fail with ErrRejected.
+//
+// This writes with a WriteBatch rather than a badger StreamWriter, since preparing a
+// StreamWriter drops everything in the database, including the ID sequence and the
+// dictionary entries of vocabulary and dataset IRIs.
+func (s *Store) BulkLoad(ctx context.Context, node rdf.Term, quads <-chan *rdf.Quad) error {
+	if len(s.Config.Signers) > 0 {
+		return ErrUnsigned
+	}
+
+	if node.TermType() == rdf.NamedNodeType {
+		uri := node.Value()
+		if strings.Index(uri, "#") != -1 || !s.Config.TagScheme.Test(uri+"#") {
+			return ErrTagScheme
+		}
+	}
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	if !isEmpty(txn) {
+		return ErrNotEmpty
+	}
+
+	dataset := []*rdf.Quad{}
+	for reading := true; reading; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case quad, ok := <-quads:
+			if ok {
+				dataset = append(dataset, quad)
+			} else {
+				reading = false
+			}
+		}
+	}
+
+	dataset, report := s.detect(node, dataset)
+	if report.Rejected {
+		return ErrRejected
+	}
+
+	dictionary := s.Config.Dictionary.Open(true)
+	committed := false
+	defer func() {
+		if !committed {
+			dictionary.Commit()
+		}
+	}()
+
+	origin, err := dictionary.GetID(node, rdf.Default)
+	if err != nil {
+		return err
+	}
+
+	previous, err := getDatasetUsage(origin, txn)
+	if err != nil {
+		return err
+	}
+
+	usage := getUsage(dataset)
+	if err = s.checkQuota(previous, usage, nil, txn); err != nil {
+		return err
+	}
+
+	total, err := getTotalUsage(txn)
+	if err != nil {
+		return err
+	}
+
+	if previous.usage != nil {
+		total.sub(previous.usage)
+	}
+	total.add(usage)
+
+	ternary := map[string][]byte{}
+	binaries := map[string]uint32{}
+	unary := map[ID]*[6]uint32{}
+	increment := func(p Permutation, a, b ID) {
+		key := string(assembleKey(BinaryPrefixes[p], false, a, b))
+		binaries[key]++
+		if binaries[key] == 1 {
+			if _, has := unary[a]; !has {
+				unary[a] = &[6]uint32{}
+			}
+			unary[a][p]++
+		}
+	}
+
+	ids := make([][4]ID, len(dataset))
+	var terms [3]ID
+	for i, quad := range dataset {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		for j := Permutation(0); j < 4; j++ {
+			ids[i][j], err = dictionary.GetID(quad[j], node)
+			if err != nil {
+				return err
+			}
+			if j < 3 {
+				terms[j] = ids[i][j]
+			}
+		}
+
+		source := &Statement{base: iri(origin), index: uint64(i), graph: ids[i][3]}
+		for p := Permutation(0); p < 3; p++ {
+			a, b, c := major.permute(p, terms)
+			key := string(assembleKey(TernaryPrefixes[p], false, a, b, c))
+			val, has := ternary[key]
+			if !has {
+				increment(p, a, b)
+				increment(((p+1)%3)+3, b, a)
+			}
+			if p == 0 {
+				ternary[key] = append(val, source.String()...)
+			} else if !has {
+				ternary[key] = []byte(source.String())
+			}
+		}
+	}
+
+	entries := make(map[string][]byte, len(ternary)+len(binaries)+len(unary)+2)
+	for key, val := range ternary {
+		if s.Config.Checksums {
+			val = sealStatements(val)
+		}
+		entries[key] = val
+	}
+	for key, count := range binaries {
+		val := make([]byte, 4)
+		binary.BigEndian.PutUint32(val, count)
+		if s.Config.Checksums {
+			val = sealCounts(val)
+		}
+		entries[key] = val
+	}
+	for id, index := range unary {
+		val := make([]byte, 24)
+		for i, c := range index {
+			binary.BigEndian.PutUint32(val[i*4:(i+1)*4], c)
+		}
+		if s.Config.Checksums {
+			val = sealCounts(val)
+		}
+		entries[string(assembleKey(UnaryPrefix, false, id))] = val
+	}
+	entries[string(assembleKey(UsagePrefix, false, origin))] = usage.bytes()
+	entries[string(TotalUsageKey)] = total.bytes()[:16]
+
+	quantities, err := quantityKeys(origin, ids, dictionary, node)
+	if err != nil {
+		return err
+	}
+	for _, key := range quantities {
+		entries[string(key)] = []byte{}
+	}
+
+	points, locations, err := geoKeys(origin, ids, dictionary, node)
+	if err != nil {
+		return err
+	}
+	for i, key := range points {
+		entries[string(key)] = locations[i]
+	}
+
+	for key, val := range languageEntries(ids) {
+		entries[key] = val
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// The index keys can only be written once the IDs they use are persisted
+	committed = true
+	if err = dictionary.Commit(); err != nil {
+		return err
+	}
+
+	wb := newWriteBatch(s.KV)
+	defer wb.Cancel()
+	for _, key := range keys {
+		if err = wb.Set([]byte(key), entries[key]); err != nil {
+			return err
+		}
+	}
+
+	if err = wb.Flush(); err != nil {
+		return err
+	}
+
+	if err = s.Config.QuadStore.Set(origin, ids); err != nil {
+		return err
+	}
+
+	if err = s.logChange("set", node, len(dataset)); err != nil {
+		return err
+	}
+
+	if s.Config.History {
+		if err = s.recordHistory(node, nil, dataset); err != nil {
+			return err
+		}
+	}
+
+	if err = s.propagate(ctx, node, nil, dataset); err != nil {
+		return err
+	}
+
+	s.notify(node, dataset)
+	return nil
+}
+
+// isEmpty reports whether the store has no triples
+func isEmpty(txn KVTxn) bool {
+	prefix := []byte{TernaryPrefixes[0]}
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	defer iter.Close()
+
+	iter.Seek(prefix)
+	return !iter.Valid()
+}
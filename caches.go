@@ -2,9 +2,6 @@ package styx
 
 import (
 	"encoding/binary"
-	"fmt"
-
-	badger "github.com/dgraph-io/badger/v2"
 )
 
 type unaryCache map[ID]*[6]uint32
@@ -15,11 +12,12 @@ func newUnaryCache() unaryCache {
 }
 
 // getUnaryIndex returns the 6-tuple of counts from an item
-func getUnaryIndex(item *badger.Item) (*[6]uint32, error) {
+func getUnaryIndex(item KVItem) (*[6]uint32, error) {
 	result := &[6]uint32{}
-	return result, item.Value(func(val []byte) error {
-		if len(val) != 24 {
-			return fmt.Errorf("Unexpected index value: %v", val)
+	return result, item.Value(func(val []byte) (err error) {
+		val, err = openCounts(val, 6)
+		if err != nil {
+			return err
 		}
 		for i := 0; i < 6; i++ {
 			result[i] = binary.BigEndian.Uint32(val[i*4 : (i+1)*4])
@@ -28,7 +26,7 @@ func getUnaryIndex(item *badger.Item) (*[6]uint32, error) {
 	})
 }
 
-func (uc unaryCache) getIndex(a ID, txn *badger.Txn) (*[6]uint32, error) {
+func (uc unaryCache) getIndex(a ID, txn KVTxn) (*[6]uint32, error) {
 	index, has := uc[a]
 	if has {
 		return index, nil
@@ -41,9 +39,10 @@ func (uc unaryCache) getIndex(a ID, txn *badger.Txn) (*[6]uint32, error) {
 	}
 
 	uc[a] = &[6]uint32{}
-	err = item.Value(func(val []byte) error {
-		if len(val) != 24 {
-			return fmt.Errorf("Unexpected index value: %v", val)
+	err = item.Value(func(val []byte) (err error) {
+		val, err = openCounts(val, 6)
+		if err != nil {
+			return err
 		}
 		for i := 0; i < 6; i++ {
 			uc[a][i] = binary.BigEndian.Uint32(val[i*4 : (i+1)*4])
@@ -56,9 +55,9 @@ func (uc unaryCache) getIndex(a ID, txn *badger.Txn) (*[6]uint32, error) {
 	return uc[a], nil
 }
 
-func (uc unaryCache) Get(p Permutation, a ID, txn *badger.Txn) (uint32, error) {
+func (uc unaryCache) Get(p Permutation, a ID, txn KVTxn) (uint32, error) {
 	index, err := uc.getIndex(a, txn)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		return 0, nil
 	} else if err != nil {
 		return 0, err
@@ -66,9 +65,9 @@ func (uc unaryCache) Get(p Permutation, a ID, txn *badger.Txn) (uint32, error) {
 	return index[p], nil
 }
 
-func (uc unaryCache) Increment(p Permutation, a ID, txn *badger.Txn) error {
+func (uc unaryCache) Increment(p Permutation, a ID, txn KVTxn) error {
 	index, err := uc.getIndex(a, txn)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		index = &[6]uint32{}
 		uc[a] = index
 	} else if err != nil {
@@ -78,9 +77,9 @@ func (uc unaryCache) Increment(p Permutation, a ID, txn *badger.Txn) error {
 	return nil
 }
 
-func (uc unaryCache) Decrement(p Permutation, a ID, txn *badger.Txn) error {
+func (uc unaryCache) Decrement(p Permutation, a ID, txn KVTxn) error {
 	index, err := uc.getIndex(a, txn)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		index = &[6]uint32{}
 		uc[a] = index
 	} else if err != nil {
@@ -93,7 +92,7 @@ func (uc unaryCache) Decrement(p Permutation, a ID, txn *badger.Txn) error {
 }
 
 // Commit writes the contents of the index map to badger
-func (uc unaryCache) Commit(db *badger.DB, t *badger.Txn) (txn *badger.Txn, err error) {
+func (uc unaryCache) Commit(db KV, t KVTxn, checksums bool) (txn KVTxn, err error) {
 	txn = t
 	for term, index := range uc {
 		key := assembleKey(UnaryPrefix, false, term)
@@ -106,7 +105,7 @@ func (uc unaryCache) Commit(db *badger.DB, t *badger.Txn) (txn *badger.Txn, err
 		}
 		if zero {
 			txn, err = deleteSafe(key, txn, db)
-			if err == badger.ErrKeyNotFound {
+			if err == ErrKeyNotFound {
 				return txn, nil
 			}
 		} else {
@@ -114,6 +113,9 @@ func (uc unaryCache) Commit(db *badger.DB, t *badger.Txn) (txn *badger.Txn, err
 			for i, c := range index {
 				binary.BigEndian.PutUint32(val[i*4:(i+1)*4], c)
 			}
+			if checksums {
+				val = sealCounts(val)
+			}
 			txn, err = setSafe(key, val, txn, db)
 			if err != nil {
 				return
@@ -130,7 +132,7 @@ func newBinaryCache() binaryCache {
 	return binaryCache{}
 }
 
-func (bc binaryCache) Get(p Permutation, a, b ID, txn *badger.Txn) (uint32, error) {
+func (bc binaryCache) Get(p Permutation, a, b ID, txn KVTxn) (uint32, error) {
 	key := assembleKey(BinaryPrefixes[p], false, a, b)
 	s := string(key)
 	count, has := bc[s]
@@ -139,15 +141,18 @@ func (bc binaryCache) Get(p Permutation, a, b ID, txn *badger.Txn) (uint32, erro
 	}
 
 	item, err := txn.Get(key)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		return 0, nil
 	} else if err != nil {
 		return 0, err
 	}
 
-	err = item.Value(func(val []byte) error {
-		bc[s] = binary.BigEndian.Uint32(val)
-		return nil
+	err = item.Value(func(val []byte) (err error) {
+		val, err = openCounts(val, 1)
+		if err == nil {
+			bc[s] = binary.BigEndian.Uint32(val)
+		}
+		return
 	})
 	if err != nil {
 		return 0, err
@@ -155,7 +160,7 @@ func (bc binaryCache) Get(p Permutation, a, b ID, txn *badger.Txn) (uint32, erro
 	return bc[s], nil
 }
 
-func (bc binaryCache) delta(p Permutation, a, b ID, increment bool, uc unaryCache, txn *badger.Txn) error {
+func (bc binaryCache) delta(p Permutation, a, b ID, increment bool, uc unaryCache, txn KVTxn) error {
 	key := assembleKey(BinaryPrefixes[p], false, a, b)
 	s := string(key)
 	_, has := bc[s]
@@ -177,19 +182,19 @@ func (bc binaryCache) delta(p Permutation, a, b ID, increment bool, uc unaryCach
 	}
 
 	item, err := txn.Get(key)
-	if err == badger.ErrKeyNotFound && increment { // Hmm
+	if err == ErrKeyNotFound && increment { // Hmm
 		bc[s] = 1
 		return uc.Increment(p, a, txn)
 	} else if err != nil {
 		return err
 	}
 
-	err = item.Value(func(val []byte) error {
-		if len(val) != 4 {
-			return fmt.Errorf("Unexpected binary value: %v", val)
+	err = item.Value(func(val []byte) (err error) {
+		val, err = openCounts(val, 1)
+		if err == nil {
+			bc[s] = binary.BigEndian.Uint32(val)
 		}
-		bc[s] = binary.BigEndian.Uint32(val)
-		return nil
+		return
 	})
 	if err != nil {
 		return err
@@ -208,27 +213,30 @@ func (bc binaryCache) delta(p Permutation, a, b ID, increment bool, uc unaryCach
 	return nil
 }
 
-func (bc binaryCache) Increment(p Permutation, a, b ID, uc unaryCache, txn *badger.Txn) error {
+func (bc binaryCache) Increment(p Permutation, a, b ID, uc unaryCache, txn KVTxn) error {
 	return bc.delta(p, a, b, true, uc, txn)
 }
 
-func (bc binaryCache) Decrement(p Permutation, a, b ID, uc unaryCache, txn *badger.Txn) error {
+func (bc binaryCache) Decrement(p Permutation, a, b ID, uc unaryCache, txn KVTxn) error {
 	return bc.delta(p, a, b, false, uc, txn)
 }
 
 // Commit writes the contents of the index map to badger
-func (bc binaryCache) Commit(db *badger.DB, t *badger.Txn) (txn *badger.Txn, err error) {
+func (bc binaryCache) Commit(db KV, t KVTxn, checksums bool) (txn KVTxn, err error) {
 	txn = t
 	for key, count := range bc {
 		if count == 0 {
 			txn, err = deleteSafe([]byte(key), txn, db)
-			if err == badger.ErrKeyNotFound {
+			if err == ErrKeyNotFound {
 			} else if err != nil {
 				return
 			}
 		} else {
 			val := make([]byte, 4)
 			binary.BigEndian.PutUint32(val, count)
+			if checksums {
+				val = sealCounts(val)
+			}
 			txn, err = setSafe([]byte(key), val, txn, db)
 			if err != nil {
 				return
@@ -0,0 +1,48 @@
+package styx
+
+import (
+	"context"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A GraphRecord describes an ingested dataset
+type GraphRecord struct {
+	Node rdf.Term
+	Usage
+}
+
+// Graphs lists every ingested dataset with its quad count and last ingestion time
+func (s *Store) Graphs(ctx context.Context) ([]*GraphRecord, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte{UsagePrefix}
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer iter.Close()
+
+	records := []*GraphRecord{}
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		item := iter.Item()
+		usage, err := parseUsage(item)
+		if err != nil {
+			return nil, err
+		}
+
+		node, err := dictionary.GetTerm(ID(item.Key()[1:]), rdf.Default)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, &GraphRecord{node, *usage})
+	}
+
+	return records, nil
+}
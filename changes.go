@@ -0,0 +1,120 @@
+package styx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Change is an entry in the store's changelog
+type Change struct {
+	// Event is "set" or "delete"
+	Event   string
+	Dataset rdf.Term
+	Quads   int
+	Time    time.Time
+}
+
+type changeRecord struct {
+	Event   string `json:"event"`
+	Dataset string `json:"dataset"`
+	Quads   int    `json:"quads"`
+}
+
+// changeKey returns the key of the next change, which is the time of the change
+// in nanoseconds, bumped past the previous change if the clock hasn't advanced.
+// It must be called while holding the writer lock.
+func (s *Store) changeKey(txn KVTxn) []byte {
+	if s.lastChange == 0 {
+		iter := txn.NewIterator(KVIteratorOptions{Reverse: true, Prefix: []byte{ChangePrefix}})
+		iter.Seek([]byte{ChangePrefix, 0xFF})
+		if iter.Valid() {
+			if key := iter.Item().Key(); len(key) == 9 {
+				s.lastChange = binary.BigEndian.Uint64(key[1:])
+			}
+		}
+		iter.Close()
+	}
+
+	now := uint64(time.Now().UnixNano())
+	if now <= s.lastChange {
+		now = s.lastChange + 1
+	}
+	s.lastChange = now
+
+	key := make([]byte, 9)
+	key[0] = ChangePrefix
+	binary.BigEndian.PutUint64(key[1:], now)
+	return key
+}
+
+// logChange appends an entry to the changelog.
+// It must be called while holding the writer lock.
+func (s *Store) logChange(event string, node rdf.Term, quads int) error {
+	val, err := json.Marshal(&changeRecord{Event: event, Dataset: node.String(), Quads: quads})
+	if err != nil {
+		return err
+	}
+
+	return updateTxn(s.KV, func(txn KVTxn) error {
+		return txn.Set(s.changeKey(txn), val)
+	})
+}
+
+// A ChangeIterator iterates over the changelog in order
+type ChangeIterator struct {
+	txn  KVTxn
+	iter KVIterator
+}
+
+// Changes returns an iterator over every dataset insertion and deletion after the given time
+func (s *Store) Changes(since time.Time) *ChangeIterator {
+	txn := s.KV.NewTransaction(false)
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: []byte{ChangePrefix}})
+
+	key := make([]byte, 9)
+	key[0] = ChangePrefix
+	if !since.IsZero() {
+		binary.BigEndian.PutUint64(key[1:], uint64(since.UnixNano())+1)
+	}
+	iter.Seek(key)
+
+	return &ChangeIterator{txn: txn, iter: iter}
+}
+
+// Next returns the next change, or nil if there are no more changes
+func (ci *ChangeIterator) Next() (*Change, error) {
+	if !ci.iter.Valid() {
+		return nil, nil
+	}
+
+	item := ci.iter.Item()
+	key := item.Key()
+	if len(key) != 9 {
+		return nil, ErrCorruptIndex
+	}
+
+	change := &Change{Time: time.Unix(0, int64(binary.BigEndian.Uint64(key[1:])))}
+	record := &changeRecord{}
+	err := item.Value(func(val []byte) error { return json.Unmarshal(val, record) })
+	if err != nil {
+		return nil, err
+	}
+
+	change.Event, change.Quads = record.Event, record.Quads
+	change.Dataset, err = rdf.ParseTerm(record.Dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	ci.iter.Next()
+	return change, nil
+}
+
+// Close the iterator
+func (ci *ChangeIterator) Close() {
+	ci.iter.Close()
+	ci.txn.Discard()
+}
@@ -0,0 +1,65 @@
+package styx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+)
+
+// Stores with Config.Checksums write a CRC-32C checksum with every index value, which is
+// verified whenever the value is read. Counts end with the four bytes of the checksum,
+// and statement lists end with a line of checksumPrefix and the hex-encoded checksum.
+// Values without a checksum, like the ones written before it was enabled, are read as they are.
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+const checksumPrefix = '#'
+
+// checksumLength is the length of the checksum line of a statement list
+const checksumLength = 10
+
+// sealCounts appends the checksum of a count value
+func sealCounts(val []byte) []byte {
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.Checksum(val, checksumTable))
+	return append(val, sum...)
+}
+
+// openCounts returns the n counts of a count value, verifying its checksum if it has one
+func openCounts(val []byte, n int) ([]byte, error) {
+	switch len(val) {
+	case 4 * n:
+		return val, nil
+	case 4*n + 4:
+		if binary.BigEndian.Uint32(val[4*n:]) != crc32.Checksum(val[:4*n], checksumTable) {
+			return nil, ErrChecksum
+		}
+		return val[:4*n], nil
+	default:
+		return nil, ErrCorruptIndex
+	}
+}
+
+// sealStatements appends the checksum line to a statement list
+func sealStatements(val []byte) []byte {
+	line := fmt.Sprintf("%c%08x\n", checksumPrefix, crc32.Checksum(val, checksumTable))
+	return append(val, line...)
+}
+
+// openStatements returns a statement list without its checksum line,
+// verifying the checksum if it has one
+func openStatements(val []byte) ([]byte, error) {
+	n := len(val) - checksumLength
+	if n < 0 || val[n] != checksumPrefix || n > 0 && val[n-1] != '\n' {
+		return val, nil
+	}
+
+	sum, err := strconv.ParseUint(string(val[n+1:len(val)-1]), 16, 32)
+	if err != nil || val[len(val)-1] != '\n' {
+		return nil, ErrCorruptIndex
+	} else if uint32(sum) != crc32.Checksum(val[:n], checksumTable) {
+		return nil, ErrChecksum
+	}
+	return val[:n], nil
+}
@@ -0,0 +1,203 @@
+package styx
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+)
+
+// CompactDiscardRatio is the discard ratio used to garbage collect the value log after compaction
+const CompactDiscardRatio = 0.5
+
+// Compact reclaims space after large deletions. It removes unary and binary count keys
+// whose counts have dropped to zero and the dictionary entries of IRIs that no longer
+// occur anywhere in the index, then flattens the LSM tree and garbage collects
+// the value log until there is nothing left to rewrite.
+// The ID space itself is not re-packed, since that would mean rewriting every index key.
+func (s *Store) Compact() error {
+	return s.CompactContext(context.Background())
+}
+
+// CompactContext is like Compact, but stops scanning the index once the context is cancelled
+func (s *Store) CompactContext(ctx context.Context) error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	keys, err := s.emptyCounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, is := s.Config.Dictionary.(*iriDictionaryFactory); is {
+		var orphans [][]byte
+		orphans, err = s.orphanedValues(ctx)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, orphans...)
+	}
+
+	txn := s.KV.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for _, key := range keys {
+		txn, err = deleteSafe(key, txn, s.KV)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return err
+	}
+
+	s.clearIDCache()
+
+	// Other backends reclaim the space of deleted keys themselves
+	if s.Badger == nil {
+		return nil
+	}
+
+	err = s.Badger.Flatten(1)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.RunGC(CompactDiscardRatio)
+	return err
+}
+
+// emptyCounts returns the unary and binary keys whose counts are all zero
+func (s *Store) emptyCounts(ctx context.Context) ([][]byte, error) {
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true})
+	defer iter.Close()
+
+	keys := [][]byte{}
+	for _, prefix := range append([]byte{UnaryPrefix}, BinaryPrefixes[:]...) {
+		for iter.Seek([]byte{prefix}); iter.ValidForPrefix([]byte{prefix}); iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			item := iter.Item()
+			empty, err := zeroCounts(item)
+			if err != nil {
+				return nil, err
+			}
+
+			if empty {
+				keys = append(keys, item.KeyCopy(nil))
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// zeroCounts reports whether the counts of a unary or binary key are all zero
+func zeroCounts(item KVItem) (empty bool, err error) {
+	n := 1
+	if item.Key()[0] == UnaryPrefix {
+		n = 6
+	}
+
+	empty = true
+	err = item.Value(func(val []byte) error {
+		val, err := openCounts(val, n)
+		for i := 0; i+4 <= len(val); i += 4 {
+			empty = empty && binary.BigEndian.Uint32(val[i:i+4]) == 0
+		}
+		return err
+	})
+	return
+}
+
+// orphanedValues returns the dictionary keys of IRIs that aren't referenced by any
+// non-empty unary key, provenance statement, or per-dataset key. It has to run after
+// the empty counts are found, since those unary keys don't count as references.
+func (s *Store) orphanedValues(ctx context.Context) ([][]byte, error) {
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false})
+	defer iter.Close()
+
+	refs := map[iri]bool{}
+	prefixes := []byte{UnaryPrefix, UsagePrefix, SignerPrefix, ViewPrefix, BindingsPrefix, DatasetPrefix}
+	for _, prefix := range prefixes {
+		for iter.Seek([]byte{prefix}); iter.ValidForPrefix([]byte{prefix}); iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			item := iter.Item()
+			if prefix == UnaryPrefix {
+				empty, err := zeroCounts(item)
+				if err != nil {
+					return nil, err
+				} else if empty {
+					continue
+				}
+			}
+			addReferences(ID(item.Key()[1:]), refs)
+		}
+	}
+
+	// The graph terms of quads only occur in the provenance statements
+	prefix := []byte{TernaryPrefixes[0]}
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err := iter.Item().Value(func(val []byte) error {
+			statements, err := getStatements(val)
+			for _, statement := range statements {
+				if statement != nil {
+					refs[statement.base] = true
+					addReferences(statement.graph, refs)
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := [][]byte{}
+	prefix = []byte{IDToValuePrefix}
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		item := iter.Item()
+		if refs[iri(item.Key()[1:])] {
+			continue
+		}
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, item.KeyCopy(nil), append([]byte{ValueToIDPrefix}, value...))
+	}
+
+	return keys, nil
+}
+
+// addReferences adds the IRI IDs that a term ID is composed of to refs
+func addReferences(id ID, refs map[iri]bool) {
+	s := string(id)
+	if match := patternLiteral.FindString(s); match != "" {
+		if datatype := s[len(match):]; strings.HasPrefix(datatype, ":") {
+			addReferences(ID(datatype[1:]), refs)
+		}
+	} else if i := strings.IndexAny(s, "#?"); i != -1 {
+		refs[iri(s[:i])] = true
+	} else {
+		refs[iri(s)] = true
+	}
+}
@@ -0,0 +1,232 @@
+package styx
+
+import (
+	"context"
+	"sync"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// Queries with QueryOptions.Parallel split their pattern into its components, the groups
+// of quads that share variables or blank nodes. Components that share nothing don't
+// constrain each other, so each of them is solved in full on its own goroutine against
+// the same snapshot, and the solutions of the query are the cartesian product of theirs.
+// The product is enumerated lazily, so only the components' solutions are held in memory.
+
+// components splits a pattern into its connected components, in the order of their first
+// quads. Quads without variables or blank nodes join the first component.
+func components(pattern []*rdf.Quad) [][]*rdf.Quad {
+	parents := make([]int, len(pattern))
+	for i := range parents {
+		parents[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	first := map[string]int{}
+	for i, quad := range pattern {
+		for _, term := range quad[:3] {
+			if !isVariable(term) {
+				continue
+			} else if j, has := first[term.String()]; has {
+				a, b := find(i), find(j)
+				if a < b {
+					a, b = b, a
+				}
+				parents[a] = b
+			} else {
+				first[term.String()] = i
+			}
+		}
+	}
+
+	groups := map[int]int{}
+	result := [][]*rdf.Quad{}
+	var constants []*rdf.Quad
+	for i, quad := range pattern {
+		if !isVariable(quad[0]) && !isVariable(quad[1]) && !isVariable(quad[2]) {
+			constants = append(constants, quad)
+			continue
+		}
+
+		root := find(i)
+		g, has := groups[root]
+		if !has {
+			g = len(result)
+			groups[root] = g
+			result = append(result, nil)
+		}
+		result[g] = append(result[g], quad)
+	}
+
+	if len(result) == 0 {
+		return [][]*rdf.Quad{constants}
+	}
+	result[0] = append(result[0], constants...)
+	return result
+}
+
+// queryComponents solves the components of a pattern in parallel and returns an iterator
+// over the product of their solutions, with the query's filters, pipelines, and redactions.
+func (s *Store) queryComponents(ctx context.Context, txn KVTxn, pattern []*rdf.Quad, groups [][]*rdf.Quad, domain []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	// Every component is solved against the same snapshot, which is read until the iterator is closed
+	shared := txn != nil
+	if !shared {
+		txn = s.KV.NewTransaction(false)
+	}
+
+	results := make([]*cachedResult, len(groups))
+	errs := make([]error, len(groups))
+	costs := make([]Cost, len(groups))
+
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, group []*rdf.Quad) {
+			defer wg.Done()
+			iter, err := s.internalQuery(ctx, txn, group, nil, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			results[i], errs[i] = solveAll(iter)
+			costs[i] = iter.cost
+			iter.Close()
+		}(i, group)
+	}
+	wg.Wait()
+
+	fail := func(err error) (*Iterator, error) {
+		if !shared {
+			txn.Discard()
+		}
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+
+	var cost Cost
+	for i, err := range errs {
+		if err != nil {
+			return fail(err)
+		}
+		cost.Keys += costs[i].Keys
+		cost.Bytes += costs[i].Bytes
+	}
+
+	var columns []rdf.Term
+	ids := map[string]int{}
+	for _, result := range results {
+		for _, term := range result.domain {
+			ids[term.String()] = len(columns)
+			columns = append(columns, term)
+		}
+	}
+
+	order, result, err := domainOrder(domain, columns, ids)
+	if err != nil {
+		return fail(err)
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	iter := replayIterator(ctx, pattern, result, nil)
+	iter.txn, iter.shared, iter.dictionary, iter.cancel = txn, shared, dictionary, cancel
+	iter.cost, iter.meter = cost, s.Config.Meter
+	iter.source = &product{
+		ctx:    ctx,
+		groups: results,
+		order:  order,
+		filter: s.solutionFilter(ctx, txn, dictionary, pattern, result, opts),
+		offset: opts.Offset,
+		limit:  opts.Limit,
+	}
+	return iter, nil
+}
+
+// A product enumerates the cartesian product of the solutions of a pattern's components
+type product struct {
+	ctx     context.Context
+	groups  []*cachedResult
+	order   []int
+	filter  *Iterator
+	offset  int
+	limit   int
+	indices []int
+	skipped int
+	count   int
+	done    bool
+}
+
+func (p *product) reset() {
+	p.indices, p.skipped, p.count, p.done = nil, 0, 0, false
+}
+
+// advance moves to the next combination of the components' solutions,
+// with the last component varying fastest
+func (p *product) advance() bool {
+	if p.indices == nil {
+		p.indices = make([]int, len(p.groups))
+		for _, group := range p.groups {
+			if len(group.solutions) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := len(p.indices) - 1; i >= 0; i-- {
+		if p.indices[i]++; p.indices[i] < len(p.groups[i].solutions) {
+			return true
+		}
+		p.indices[i] = 0
+	}
+	return false
+}
+
+func (p *product) next() ([]rdf.Term, error) {
+	for !p.done && (p.limit <= 0 || p.count < p.limit) {
+		if err := contextError(p.ctx); err != nil {
+			return nil, err
+		} else if !p.advance() {
+			p.done = true
+			return nil, nil
+		}
+
+		row := make([]rdf.Term, 0, len(p.order))
+		for i, group := range p.groups {
+			row = append(row, group.solutions[p.indices[i]]...)
+		}
+
+		sorted := make([]rdf.Term, len(p.order))
+		for i, j := range p.order {
+			sorted[i] = row[j]
+		}
+
+		index, err := p.filter.filterSolution(sorted)
+		if err != nil {
+			return nil, err
+		} else if index == nil {
+			continue
+		} else if p.skipped < p.offset {
+			p.skipped++
+			continue
+		}
+
+		p.count++
+		return index, nil
+	}
+	return nil, nil
+}
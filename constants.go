@@ -3,6 +3,7 @@ package styx
 import (
 	"errors"
 
+	badger "github.com/dgraph-io/badger/v2"
 	ld "github.com/piprate/json-gold/ld"
 )
 
@@ -44,6 +45,18 @@ var constants = []string{
 	ld.RDFList,
 }
 
+// ErrKeyNotFound is returned by KV transactions for keys that aren't set
+var ErrKeyNotFound = badger.ErrKeyNotFound
+
+// ErrConflict is returned by KV transactions that read a key that another transaction wrote
+var ErrConflict = badger.ErrConflict
+
+// ErrTxnTooBig is returned by KV transactions that can't hold any more writes
+var ErrTxnTooBig = badger.ErrTxnTooBig
+
+// ErrUnsupportedBackend means that an operation is specific to badger, and the store uses another KV
+var ErrUnsupportedBackend = errors.New("Not supported by the storage backend")
+
 // ErrInvalidInput indicates that a given dataset was invalid
 var ErrInvalidInput = errors.New("Invalid dataset")
 
@@ -62,6 +75,102 @@ var ErrInvalidDomain = errors.New("Invalid domain")
 // ErrInvalidIndex means that provided index included blank nodes or that it was too long
 var ErrInvalidIndex = errors.New("Invalid index")
 
+// ErrInvalidPath means that a transitive property path had no endpoint that is a constant or bound by the rest of the query
+var ErrInvalidPath = errors.New("Invalid property path")
+
+// ErrRejected means that a dataset was refused by one of the store's detection rules
+var ErrRejected = errors.New("Dataset rejected by detection rule")
+
+// ErrUnsupportedDictionary means that an operation needs the store to use an IRI dictionary
+var ErrUnsupportedDictionary = errors.New("Unsupported dictionary")
+
+// ErrDictionaryConflict means that an imported dictionary assigned a different ID to a value
+var ErrDictionaryConflict = errors.New("Conflicting dictionary entry")
+
+// ErrSequenceBehind means that the ID counter is behind IDs that are already in the dictionary
+var ErrSequenceBehind = errors.New("ID sequence is behind the dictionary")
+
+// ErrQuotaExceeded means that inserting a dataset would exceed the store's quota
+var ErrQuotaExceeded = errors.New("Quota exceeded")
+
+// ErrNotEmpty means that a bulk load was attempted on a store that already has data
+var ErrNotEmpty = errors.New("Store is not empty")
+
+// ErrWebhookFailed means that a webhook endpoint responded with a server error
+var ErrWebhookFailed = errors.New("Webhook delivery failed")
+
+// ErrFetchFailed means that a source URL did not respond with 200 OK
+var ErrFetchFailed = errors.New("Fetching source failed")
+
+// ErrInvalidQuantity means that the bounds of a quantity filter had unknown units or different dimensions
+var ErrInvalidQuantity = errors.New("Invalid quantity")
+
+// ErrInvalidGeometry means that the bounds of a geo filter weren't valid coordinates
+var ErrInvalidGeometry = errors.New("Invalid geometry")
+
+// ErrInvalidInterval means that a polling interval wasn't positive
+var ErrInvalidInterval = errors.New("Invalid interval")
+
+// ErrFetchTooLarge means that a source URL responded with more than MaxFetchSize bytes
+var ErrFetchTooLarge = errors.New("Fetched source too large")
+
+// ErrCorruptIndex means that an index value read from the database was malformed
+var ErrCorruptIndex = errors.New("Corrupt index value")
+
+// ErrChecksum means that an index value read from the database didn't match its checksum
+var ErrChecksum = errors.New("Index value checksum mismatch")
+
+// ErrQueryTooComplex means that a query pattern exceeded the store's limits
+var ErrQueryTooComplex = errors.New("Query pattern too complex")
+
+// ErrUnsupportedPlatform means that an operation isn't available on this platform
+var ErrUnsupportedPlatform = errors.New("Unsupported platform")
+
+// ErrInvalidUsage means that a stored usage record could not be parsed
+var ErrInvalidUsage = errors.New("Invalid usage record")
+
+// ErrInvalidQueryURI means that a URI was not a registered query URI
+var ErrInvalidQueryURI = errors.New("Invalid query URI")
+
+// ErrCachedResults means that an operation isn't supported by iterators over cached results
+var ErrCachedResults = errors.New("Not supported for cached results")
+
+// ErrUnsigned means that the store requires datasets to be signed with SetSigned
+var ErrUnsigned = errors.New("Dataset signature required")
+
+// ErrUntrustedSigner means that a dataset was signed with a key that isn't one of the store's signers
+var ErrUntrustedSigner = errors.New("Untrusted signer")
+
+// ErrInvalidSignature means that a dataset's signature didn't verify
+var ErrInvalidSignature = errors.New("Invalid signature")
+
+// ErrUnsupportedDID means that a DID used a method other than did:key or did:web
+var ErrUnsupportedDID = errors.New("Unsupported DID method")
+
+// ErrInvalidDID means that a DID was malformed
+var ErrInvalidDID = errors.New("Invalid DID")
+
+// ErrNoSnapshotDir means that the store wasn't configured with a SnapshotDir
+var ErrNoSnapshotDir = errors.New("No snapshot directory")
+
+// ErrInvalidSnapshot means that a snapshot name was empty or contained a path separator
+var ErrInvalidSnapshot = errors.New("Invalid snapshot name")
+
+// ErrInvalidGraphQL means that a GraphQL query couldn't be parsed or had a field name that isn't an IRI
+var ErrInvalidGraphQL = errors.New("Invalid GraphQL query")
+
+// ErrUnsupportedGraphQL means that a GraphQL query used a feature that isn't supported, like fragments
+var ErrUnsupportedGraphQL = errors.New("Unsupported GraphQL feature")
+
+// ErrReservedVariable means that a JSON-LD query named a variable with the prefix reserved for generated variables
+var ErrReservedVariable = errors.New("Reserved variable name")
+
+// ErrKeyLayout means that a store already has data in a different key layout than the one it was opened with
+var ErrKeyLayout = errors.New("Incompatible key layout")
+
+// ErrQueryTimeout means that a query's deadline passed before it finished
+var ErrQueryTimeout = errors.New("Query timed out")
+
 // Algorithm has to be URDNA2015
 const Algorithm = "URDNA2015"
 
@@ -80,6 +189,51 @@ const ValueToIDPrefix = byte('>')
 // IDToValuePrefix keys translate uint64 ids to string IRIs
 const IDToValuePrefix = byte('<')
 
+// ViewPrefix keys store the query patterns of materialized views
+const ViewPrefix = byte('v')
+
+// BindingsPrefix keys store the solutions of materialized views
+const BindingsPrefix = byte('w')
+
+// ChangePrefix keys store the changelog by the time of each change
+const ChangePrefix = byte('@')
+
+// SignerPrefix keys store the public keys that signed datasets
+const SignerPrefix = byte('s')
+
+// ContextPrefix keys cache remote JSON-LD documents by URL
+const ContextPrefix = byte('x')
+
+// HistoryPrefix keys record when datasets asserted and retracted each triple
+const HistoryPrefix = byte('h')
+
+// QueryPrefix keys store the patterns of registered queries by their hash
+const QueryPrefix = byte('q')
+
+// QueryURIScheme is the scheme of registered query URIs
+const QueryURIScheme = "q:"
+
+// UsagePrefix keys store the number of quads and bytes used by each dataset
+const UsagePrefix = byte('%')
+
+// PeerPrefix keys store the number of quads and bytes used by the datasets that each key signed
+const PeerPrefix = byte('&')
+
+// TotalUsageKey stores the number of quads and bytes used by every dataset
+var TotalUsageKey = []byte("=")
+
+// QuantityPrefix keys index quantitative values by dimension and value in canonical units
+const QuantityPrefix = byte('y')
+
+// GeoPrefix keys index points by geohash
+const GeoPrefix = byte('g')
+
+// LanguagePrefix keys index language-tagged literals by their lowercase language tag
+const LanguagePrefix = byte('t')
+
+// LayoutKey stores the key layout of the indices, unless it's the default TabKeyLayout
+var LayoutKey = []byte("!")
+
 // UnaryPrefix keys translate ld.Node values to uint64 ids
 const UnaryPrefix = byte('u')
 
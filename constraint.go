@@ -5,20 +5,22 @@ import (
 	"encoding/binary"
 	"fmt"
 
-	badger "github.com/dgraph-io/badger/v2"
 	rdf "github.com/underlay/go-rdfjs"
 )
 
 // A constraint to an occurrence of a variable in a query
 type constraint struct {
-	index     int         // The index of the triple within the query
+	index     int         // The index of the triple within the query, or -1 for language constraints
 	place     Permutation // The term (subject = 0, predicate = 1, object = 2) within the triple
 	count     uint32      // The number of unique triples that satisfy the constraint
 	prefix    []byte
-	iterator  *badger.Iterator
+	iterator  KVIterator
 	quad      *rdf.Quad
 	terms     [3]ID
 	neighbors []*constraint
+	cost      *Cost         // The cost of the constraint's iterator, which is shared by the query
+	seek      []byte        // A reusable buffer for the keys passed to Seek
+	literals  *literalRange // The literals that a type hint narrows the constraint to, if any
 }
 
 // cache is a struct for holding cached value states
@@ -40,8 +42,8 @@ func (c *constraint) print(p Permutation) string {
 	return c.quad[p].String()
 }
 
-func (c *constraint) Sources(value ID, txn *badger.Txn) (statements []*Statement, err error) {
-	var item *badger.Item
+func (c *constraint) Sources(value ID, txn KVTxn) (statements []*Statement, err error) {
+	var item KVItem
 	if c.place == 0 {
 		item = c.iterator.Item()
 	} else {
@@ -95,18 +97,31 @@ func (c *constraint) Close() {
 	}
 }
 
-func (c *constraint) value() (v ID) {
-	if c.iterator.ValidForPrefix(c.prefix) {
+func (c *constraint) value() ID {
+	for c.iterator.ValidForPrefix(c.prefix) {
+		// The key is only valid until the iterator moves, but
+		// converting it to an ID copies it anyway.
 		item := c.iterator.Item()
-		key := item.KeyCopy(nil)
+		key := item.Key()
+		if c.cost != nil {
+			c.cost.Keys++
+			c.cost.Bytes += uint64(item.EstimatedSize())
+		}
 		i := bytes.LastIndexByte(key, '\t')
 		if i == -1 {
 			i = 0
 		}
-		v = ID(key[i+1:])
+
+		v := ID(key[i+1:])
+		if c.literals == nil || c.literals.match(v) {
+			return v
+		} else if !c.literals.contains(v) {
+			return NIL
+		}
+		c.iterator.Next()
 	}
 
-	return
+	return NIL
 }
 
 // Next advances the iterator and returns the next value
@@ -118,16 +133,15 @@ func (c *constraint) Next() ID {
 // Seek advances the iterator to the first value equal to
 // or greater than given byte slice.
 func (c *constraint) Seek(v ID) ID {
-	key := make([]byte, len(c.prefix)+len(v))
-	copy(key, c.prefix)
-	if v != NIL {
-		copy(key[len(c.prefix):], v)
+	if c.literals != nil && v < literalStart {
+		v = literalStart
 	}
-	c.iterator.Seek(key)
+	c.seek = append(append(c.seek[:0], c.prefix...), v...)
+	c.iterator.Seek(c.seek)
 	return c.value()
 }
 
-func (c *constraint) getCount(uc unaryCache, bc binaryCache, txn *badger.Txn) (uint32, error) {
+func (c *constraint) getCount(uc unaryCache, bc binaryCache, txn KVTxn) (uint32, error) {
 	j, k := (c.place+1)%3, (c.place+2)%3
 	v, w := c.terms[j], c.terms[k]
 	if v == NIL && w == NIL {
@@ -142,6 +156,33 @@ func (c *constraint) getCount(uc unaryCache, bc binaryCache, txn *badger.Txn) (u
 	}
 }
 
+// getJoinCount estimates the count of a second-degree constraint once its other variable
+// is bound, as the number of triples with its constant term over the number of distinct
+// values the other variable takes with it. The number of triples is at least the number of
+// distinct values in either position, which is what the unary keys count.
+func (c *constraint) getJoinCount(uc unaryCache, txn KVTxn) (uint32, error) {
+	v, w := (c.place+1)%3, (c.place+2)%3
+	if c.terms[v] != NIL {
+		v, w = w, v
+	}
+
+	p := w
+	if v != (w+1)%3 {
+		p = w + 3
+	}
+
+	n, err := uc.Get(p, c.terms[w], txn)
+	if err != nil || n == 0 {
+		return c.count, err
+	}
+
+	triples := c.count
+	if n > triples {
+		triples = n
+	}
+	return (triples + n - 1) / n, nil
+}
+
 // A constraintSet is just a slice of Constraints.
 type constraintSet []*constraint
 
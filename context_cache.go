@@ -0,0 +1,152 @@
+package styx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+	ld "github.com/piprate/json-gold/ld"
+)
+
+// DefaultContextTTL is how long cached contexts are served before they are fetched again
+const DefaultContextTTL = 24 * time.Hour
+
+// DefaultContextCacheSize is the default maximum number of cached contexts
+const DefaultContextCacheSize = 1024
+
+// A ContextCache is a document loader that caches remote documents (like the
+// schema.org and PROV contexts) in Badger. Cached documents are fetched again once
+// they're older than the TTL, but are still served if that fails, so ingestion
+// works offline after the cache is warm. When the cache is full, the document
+// fetched longest ago is evicted.
+type ContextCache struct {
+	Next    ld.DocumentLoader
+	TTL     time.Duration
+	MaxSize int
+	kv      KV
+}
+
+// NewContextCache returns a ContextCache in the given database that loads uncached documents with next
+func NewContextCache(db *badger.DB, next ld.DocumentLoader) *ContextCache {
+	return NewContextCacheKV(BadgerKV(db), next)
+}
+
+// NewContextCacheKV is like NewContextCache, but caches documents in any KV
+func NewContextCacheKV(kv KV, next ld.DocumentLoader) *ContextCache {
+	return &ContextCache{Next: next, TTL: DefaultContextTTL, MaxSize: DefaultContextCacheSize, kv: kv}
+}
+
+type cachedDocument struct {
+	DocumentURL string      `json:"documentUrl"`
+	ContextURL  string      `json:"contextUrl,omitempty"`
+	Document    interface{} `json:"document"`
+}
+
+// LoadDocument satisfies the ld.DocumentLoader interface
+func (cc *ContextCache) LoadDocument(u string) (*ld.RemoteDocument, error) {
+	key := append([]byte{ContextPrefix}, u...)
+
+	var cached *ld.RemoteDocument
+	var fetched time.Time
+	err := viewTxn(cc.kv, func(txn KVTxn) error {
+		item, err := txn.Get(key)
+		if err == ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) (err error) {
+			cached, fetched, err = parseCachedDocument(val)
+			return
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && time.Since(fetched) < cc.TTL {
+		return cached, nil
+	}
+
+	document, err := cc.Next.LoadDocument(u)
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	val, err := json.Marshal(&cachedDocument{document.DocumentURL, document.ContextURL, document.Document})
+	if err != nil {
+		return nil, err
+	}
+
+	val = append(make([]byte, 8, 8+len(val)), val...)
+	binary.BigEndian.PutUint64(val, uint64(time.Now().UnixNano()))
+	err = updateTxn(cc.kv, func(txn KVTxn) error {
+		if cached == nil {
+			if err := cc.evict(txn); err != nil {
+				return err
+			}
+		}
+		return txn.Set(key, val)
+	})
+	if err == ErrConflict {
+		// Another load cached the same document concurrently
+		err = nil
+	}
+
+	return document, err
+}
+
+// evict deletes the document fetched longest ago if the cache is full
+func (cc *ContextCache) evict(txn KVTxn) error {
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: []byte{ContextPrefix}})
+	defer iter.Close()
+
+	var size int
+	var oldest []byte
+	var oldestTime time.Time
+	for iter.Seek([]byte{ContextPrefix}); iter.Valid(); iter.Next() {
+		size++
+		item := iter.Item()
+		err := item.Value(func(val []byte) error {
+			if len(val) < 8 {
+				return ErrCorruptIndex
+			}
+			fetched := time.Unix(0, int64(binary.BigEndian.Uint64(val)))
+			if oldest == nil || fetched.Before(oldestTime) {
+				oldest, oldestTime = item.KeyCopy(nil), fetched
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if size < cc.MaxSize || oldest == nil {
+		return nil
+	}
+	return txn.Delete(oldest)
+}
+
+func parseCachedDocument(val []byte) (*ld.RemoteDocument, time.Time, error) {
+	if len(val) < 8 {
+		return nil, time.Time{}, ErrCorruptIndex
+	}
+
+	fetched := time.Unix(0, int64(binary.BigEndian.Uint64(val)))
+	document := &cachedDocument{}
+	err := json.Unmarshal(val[8:], document)
+	if err != nil {
+		return nil, fetched, err
+	}
+
+	return &ld.RemoteDocument{
+		DocumentURL: document.DocumentURL,
+		ContextURL:  document.ContextURL,
+		Document:    document.Document,
+	}, fetched, nil
+}
@@ -0,0 +1,28 @@
+package styx
+
+import "context"
+
+// Cost measures the work done by a query: the number of index keys it scanned
+// and their estimated size in bytes
+type Cost struct {
+	Keys  uint64
+	Bytes uint64
+}
+
+// A Meter records the cost of every query when its iterator is closed.
+// The context is the one passed to QueryContext, so host applications can
+// attach an API token to it and bill per token.
+type Meter interface {
+	Record(ctx context.Context, cost Cost)
+}
+
+// MeterFunc is a function that satisfies the Meter interface
+type MeterFunc func(ctx context.Context, cost Cost)
+
+// Record satisfies the Meter interface
+func (f MeterFunc) Record(ctx context.Context, cost Cost) { f(ctx, cost) }
+
+// Cost returns the cost of the query so far
+func (iter *Iterator) Cost() Cost {
+	return iter.cost
+}
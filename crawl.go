@@ -0,0 +1,127 @@
+package styx
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const provWasDerivedFrom = "http://www.w3.org/ns/prov#wasDerivedFrom"
+
+var patternScript = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']application/ld\+json["'][^>]*>(.*?)</script>`)
+var patternHref = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*["']([^"'#]+)`)
+
+// DefaultCrawlLimit is the number of pages a crawl fetches if its options don't set a Limit
+const DefaultCrawlLimit = 100
+
+// CrawlOptions bound a crawl
+type CrawlOptions struct {
+	// Limit is the maximum number of pages to fetch, or DefaultCrawlLimit if it is zero
+	Limit int
+	// SameHost restricts the crawl to the hosts of the seed URLs
+	SameHost bool
+	// Node names the dataset of a page. By default it's the page URL itself,
+	// which has to satisfy the store's tag scheme.
+	Node func(page string) rdf.Term
+}
+
+// Crawl fetches pages breadth-first from the seed URLs, following links, and
+// ingests the JSON-LD embedded in their script tags. Each page's dataset also
+// gets a prov:wasDerivedFrom quad linking the dataset to the page URL.
+// Pages that fail to load or parse are logged and skipped. The options can be nil.
+func (s *Store) Crawl(ctx context.Context, seeds []string, opts *CrawlOptions) error {
+	if opts == nil {
+		opts = &CrawlOptions{}
+	}
+
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultCrawlLimit
+	}
+
+	hosts := map[string]bool{}
+	queue := []string{}
+	visited := map[string]bool{}
+	for _, seed := range seeds {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return err
+		}
+		hosts[u.Host] = true
+		queue = append(queue, u.String())
+		visited[u.String()] = true
+	}
+
+	for fetched := 0; len(queue) > 0 && fetched < limit; fetched++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page := queue[0]
+		queue = queue[1:]
+
+		body, _, err := fetch(ctx, page)
+		if err != nil {
+			s.Config.Logger.Warn("Fetching page failed", Field{"url", page}, Field{"error", err})
+			continue
+		}
+
+		var node rdf.Term = rdf.NewNamedNode(page)
+		if opts.Node != nil {
+			node = opts.Node(page)
+		}
+
+		dataset := []*rdf.Quad{}
+		for i, match := range patternScript.FindAllSubmatch(body, -1) {
+			result, err := getDataset(match[1], s.jsonldOptions(page))
+			if err != nil {
+				s.Config.Logger.Warn("Parsing JSON-LD failed", Field{"url", page}, Field{"error", err})
+				continue
+			}
+			dataset = append(dataset, prefixBlankNodes(fromLdDataset(result, ""), fmt.Sprintf("s%d-", i))...)
+		}
+
+		if len(dataset) > 0 {
+			dataset = append(dataset, rdf.NewQuad(node, rdf.NewNamedNode(provWasDerivedFrom), rdf.NewNamedNode(page), rdf.Default))
+			if _, err := s.write(ctx, node, dataset, true, nil); err != nil {
+				s.Config.Logger.Warn("Ingesting page failed", Field{"url", page}, Field{"error", err})
+			}
+		}
+
+		base, _ := url.Parse(page)
+		for _, match := range patternHref.FindAllSubmatch(body, -1) {
+			link, err := base.Parse(html.UnescapeString(string(match[1])))
+			if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+				continue
+			} else if opts.SameHost && !hosts[link.Host] {
+				continue
+			} else if href := link.String(); !visited[href] {
+				visited[href] = true
+				queue = append(queue, href)
+			}
+		}
+	}
+
+	return nil
+}
+
+// prefixBlankNodes prefixes the labels of the blank nodes of a dataset, so that the blank nodes
+// of JSON-LD documents that were parsed separately don't collide in one dataset
+func prefixBlankNodes(dataset []*rdf.Quad, prefix string) []*rdf.Quad {
+	result := make([]*rdf.Quad, len(dataset))
+	for i, quad := range dataset {
+		var terms [4]rdf.Term
+		for j, term := range quad {
+			terms[j] = term
+			if term.TermType() == rdf.BlankNodeType {
+				terms[j] = rdf.NewBlankNode(prefix + term.Value())
+			}
+		}
+		result[i] = rdf.NewQuad(terms[0], terms[1], terms[2], terms[3])
+	}
+	return result
+}
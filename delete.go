@@ -1,14 +1,44 @@
 package styx
 
 import (
-	badger "github.com/dgraph-io/badger/v2"
+	"context"
+
 	rdf "github.com/underlay/go-rdfjs"
 )
 
 // Delete a dataset from the database
-func (s *Store) Delete(node rdf.Term) (err error) {
+func (s *Store) Delete(node rdf.Term) error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	dataset, err := s.Get(node)
+	if err != nil {
+		return err
+	}
+
+	err = retry(func() error { return s.delete(node) })
+	if err != nil {
+		return err
+	}
+
+	err = s.logChange("delete", node, len(dataset))
+	if err != nil {
+		return err
+	}
+
+	if s.Config.History {
+		err = s.recordHistory(node, dataset, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.propagate(context.Background(), node, dataset, nil)
+}
+
+func (s *Store) delete(node rdf.Term) (err error) {
 	dictionary := s.Config.Dictionary.Open(false)
-	txn := s.Badger.NewTransaction(true)
+	txn := s.KV.NewTransaction(true)
 	defer func() { txn.Discard(); dictionary.Commit() }()
 
 	origin, err := dictionary.GetID(node, rdf.Default)
@@ -21,7 +51,30 @@ func (s *Store) Delete(node rdf.Term) (err error) {
 		return
 	}
 
-	txn, err = deleteQuads(origin, quads, dictionary, txn, s.Badger)
+	txn, err = deleteQuads(origin, quads, dictionary, txn, s.KV, s.Config.Checksums)
+	if err != nil {
+		return
+	}
+
+	txn, err = indexQuantities(origin, quads, dictionary, node, true, txn, s.KV)
+	if err != nil {
+		return
+	}
+	txn, err = indexGeometries(origin, quads, dictionary, node, true, txn, s.KV)
+	if err != nil {
+		return
+	}
+	txn, err = indexLanguages(quads, true, txn, s.KV)
+	if err != nil {
+		return
+	}
+
+	previous, err := getDatasetUsage(origin, txn)
+	if err != nil {
+		return
+	}
+
+	txn, err = setUsage(origin, previous, nil, nil, txn, s.KV)
 	if err != nil {
 		return
 	}
@@ -35,7 +88,7 @@ func (s *Store) Delete(node rdf.Term) (err error) {
 }
 
 // Delete removes a dataset from the database
-func deleteQuads(origin ID, quads [][4]ID, dictionary Dictionary, t *badger.Txn, db *badger.DB) (txn *badger.Txn, err error) {
+func deleteQuads(origin ID, quads [][4]ID, dictionary Dictionary, t KVTxn, db KV, checksums bool) (txn KVTxn, err error) {
 	txn = t
 
 	bc := newBinaryCache()
@@ -43,11 +96,11 @@ func deleteQuads(origin ID, quads [][4]ID, dictionary Dictionary, t *badger.Txn,
 
 	for _, quad := range quads {
 		terms := [3]ID{quad[0], quad[1], quad[2]}
-		var item *badger.Item
+		var item KVItem
 		p := TernaryPrefixes[0]
 		key := assembleKey(p, false, quad[:3]...)
 		item, err = txn.Get(key)
-		if err == badger.ErrKeyNotFound {
+		if err == ErrKeyNotFound {
 			// This might happen because we filter everything from the given
 			// origin, and there could be duplicate triples in a dataset.
 			// No action needed.
@@ -70,6 +123,9 @@ func deleteQuads(origin ID, quads [][4]ID, dictionary Dictionary, t *badger.Txn,
 			}
 		}
 		if len(val) > 0 {
+			if checksums {
+				val = sealStatements(val)
+			}
 			txn, err = setSafe(key, val, txn, db)
 			if err != nil {
 				return
@@ -104,7 +160,7 @@ func deleteQuads(origin ID, quads [][4]ID, dictionary Dictionary, t *badger.Txn,
 
 				key := assembleKey(TernaryPrefixes[p], false, a, b, c)
 				txn, err = deleteSafe(key, txn, db)
-				if err == badger.ErrKeyNotFound {
+				if err == ErrKeyNotFound {
 					// ???
 					// This is more concerning...
 				} else if err != nil {
@@ -114,12 +170,12 @@ func deleteQuads(origin ID, quads [][4]ID, dictionary Dictionary, t *badger.Txn,
 		}
 	}
 
-	txn, err = bc.Commit(db, txn)
+	txn, err = bc.Commit(db, txn, checksums)
 	if err != nil {
 		return
 	}
 
-	txn, err = uc.Commit(db, txn)
+	txn, err = uc.Commit(db, txn, checksums)
 	if err != nil {
 		return
 	}
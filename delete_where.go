@@ -0,0 +1,107 @@
+package styx
+
+import (
+	"context"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// DeleteWhere removes every quad that matches the pattern in any solution, and returns
+// the number of quads removed. Each affected dataset is rewritten without its matching
+// quads, so provenance stays consistent. Datasets are recovered from the triple index
+// if the QuadStore doesn't keep them. The rewrites are internal: they skip the ingest
+// hooks, detectors and signature check, and since a rewritten dataset no longer matches
+// its signature, it loses its signer.
+func (s *Store) DeleteWhere(ctx context.Context, pattern []*rdf.Quad) (int, error) {
+	iter, err := s.QueryContext(ctx, pattern, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := map[string]rdf.Term{}
+	matches := map[string]map[uint64]bool{}
+	for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+
+		sources, err := iter.Sources()
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+
+		for _, quad := range sources {
+			for _, source := range quad {
+				key := source.Dataset.String()
+				if matches[key] == nil {
+					nodes[key] = source.Dataset
+					matches[key] = map[uint64]bool{}
+				}
+				matches[key][source.Index] = true
+			}
+		}
+	}
+	iter.Close()
+
+	removed := 0
+	for key, node := range nodes {
+		dataset, err := s.getDataset(node)
+		if err != nil {
+			return removed, err
+		}
+
+		remaining := make([]*rdf.Quad, 0, len(dataset))
+		for i, quad := range dataset {
+			if !matches[key][uint64(i)] {
+				remaining = append(remaining, quad)
+			}
+		}
+
+		err = s.ingest(ctx, node, remaining, true, nil)
+		if err != nil {
+			return removed, err
+		}
+		removed += len(dataset) - len(remaining)
+	}
+
+	return removed, nil
+}
+
+// getDataset is like Get, but falls back to scanning the triple index
+// if the QuadStore doesn't keep the dataset
+func (s *Store) getDataset(node rdf.Term) ([]*rdf.Quad, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	origin, err := dictionary.GetID(node, rdf.Default)
+	if err != nil {
+		return nil, err
+	}
+
+	quads, err := s.Config.QuadStore.Get(origin)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	} else if quads == nil {
+		txn := s.KV.NewTransaction(false)
+		quads, err = scanQuads(context.Background(), origin, txn)
+		txn.Discard()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dataset := make([]*rdf.Quad, len(quads))
+	for i, quad := range quads {
+		var terms [4]rdf.Term
+		for j, id := range quad {
+			terms[j], err = dictionary.GetTerm(id, node)
+			if err != nil {
+				return nil, err
+			}
+		}
+		dataset[i] = rdf.NewQuad(terms[0], terms[1], terms[2], terms[3])
+	}
+	return dataset, nil
+}
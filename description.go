@@ -0,0 +1,85 @@
+package styx
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Description holds the VoID statistics of the store
+type Description struct {
+	Triples          uint64
+	DistinctSubjects uint64
+	DistinctObjects  uint64
+	Properties       uint64
+	Vocabularies     []string
+	Modified         time.Time
+}
+
+// Describe computes the store's VoID statistics from its indices. Vocabularies are
+// the namespaces of the predicates, up to and including their last '#' or '/'.
+func (s *Store) Describe() (*Description, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	description := &Description{Vocabularies: []string{}}
+	vocabularies := map[string]bool{}
+
+	prefix := []byte{TernaryPrefixes[SPO]}
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		description.Triples++
+	}
+	iter.Close()
+
+	prefix = []byte{UnaryPrefix}
+	iter = txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer iter.Close()
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		index, err := getUnaryIndex(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if index[SPO] > 0 {
+			description.DistinctSubjects++
+		}
+		if index[OSP] > 0 {
+			description.DistinctObjects++
+		}
+		if index[POS] > 0 {
+			description.Properties++
+			term, err := dictionary.GetTerm(ID(item.Key()[1:]), rdf.Default)
+			if err != nil {
+				return nil, err
+			}
+			if i := strings.LastIndexAny(term.Value(), "#/"); i != -1 {
+				vocabularies[term.Value()[:i+1]] = true
+			}
+		}
+	}
+
+	for vocabulary := range vocabularies {
+		description.Vocabularies = append(description.Vocabularies, vocabulary)
+	}
+	sort.Strings(description.Vocabularies)
+
+	graphs, err := s.Graphs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, graph := range graphs {
+		if graph.Modified.After(description.Modified) {
+			description.Modified = graph.Modified
+		}
+	}
+
+	return description, nil
+}
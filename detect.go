@@ -0,0 +1,94 @@
+package styx
+
+import (
+	"regexp"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Detector scans literals for sensitive content such as email addresses or phone numbers
+type Detector interface {
+	Detect(literal *rdf.Literal) bool
+}
+
+// A PatternDetector detects literals whose values match a regular expression
+type PatternDetector struct{ *regexp.Regexp }
+
+// Detect satisfies the Detector interface
+func (pd PatternDetector) Detect(literal *rdf.Literal) bool {
+	return pd.MatchString(literal.Value())
+}
+
+// EmailDetector detects literals containing email addresses
+var EmailDetector Detector = PatternDetector{regexp.MustCompile("[a-zA-Z0-9._%+\\-]+@[a-zA-Z0-9.\\-]+\\.[a-zA-Z]{2,}")}
+
+// PhoneDetector detects literals containing (loosely formatted) phone numbers
+var PhoneDetector Detector = PatternDetector{regexp.MustCompile("\\+?[0-9][0-9 ().\\-]{7,}[0-9]")}
+
+// A DetectionAction is what happens to a dataset when a detector matches one of its literals
+type DetectionAction uint8
+
+const (
+	// Tag records the finding in the report without modifying the dataset
+	Tag DetectionAction = iota
+	// Mask replaces the value of the literal with the rule's label in brackets
+	Mask
+	// Reject refuses to insert the dataset at all
+	Reject
+)
+
+// A DetectionRule pairs a labelled detector with an action
+type DetectionRule struct {
+	Label    string
+	Detector Detector
+	Action   DetectionAction
+}
+
+// A Finding is a literal that matched a detection rule
+type Finding struct {
+	Index  int // The index of the quad within the dataset
+	Label  string
+	Action DetectionAction
+}
+
+// A Report lists the findings of the detection rules for a single dataset
+type Report struct {
+	Node     rdf.Term
+	Findings []*Finding
+	Rejected bool
+}
+
+// detect runs the store's detection rules over the dataset's object literals
+// and returns the dataset with masked literals replaced.
+func (s *Store) detect(node rdf.Term, dataset []*rdf.Quad) ([]*rdf.Quad, *Report) {
+	report := &Report{Node: node, Findings: []*Finding{}}
+	if len(s.Config.Detectors) == 0 {
+		return dataset, report
+	}
+
+	result := make([]*rdf.Quad, len(dataset))
+	for i, quad := range dataset {
+		result[i] = quad
+		literal, is := quad[2].(*rdf.Literal)
+		if !is {
+			continue
+		}
+
+		for _, rule := range s.Config.Detectors {
+			if !rule.Detector.Detect(literal) {
+				continue
+			}
+
+			report.Findings = append(report.Findings, &Finding{i, rule.Label, rule.Action})
+			if rule.Action == Reject {
+				report.Rejected = true
+			} else if rule.Action == Mask {
+				datatype, _ := literal.Datatype().(*rdf.NamedNode)
+				masked := rdf.NewLiteral("["+rule.Label+"]", literal.Language(), datatype)
+				result[i] = rdf.NewQuad(quad[0], quad[1], masked, quad[3])
+			}
+		}
+	}
+
+	return result, report
+}
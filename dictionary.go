@@ -1,9 +1,11 @@
 package styx
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"regexp"
+	"sort"
 	"strings"
 
 	badger "github.com/dgraph-io/badger/v2"
@@ -82,53 +84,153 @@ func (s stringDictionary) GetTerm(id ID, origin rdf.Term) (rdf.Term, error) {
 	return term, nil
 }
 
-// SequenceBandwidth sets the lease block size of the ID counter
+// SequenceBandwidth is the default lease block size of the ID counter
 const SequenceBandwidth = 512
 
 type iriDictionaryFactory struct {
-	tags     TagScheme
-	db       *badger.DB
-	sequence *badger.Sequence
+	tags      TagScheme
+	kv        KV
+	sequence  *sequence
+	bandwidth uint64
+	cache     idCache
 }
 
 type iriDictionary struct {
-	update  bool
-	factory *iriDictionaryFactory
-	txn     *badger.Txn
-	values  map[iri]string
-	ids     map[string]iri
+	update     bool
+	factory    *iriDictionaryFactory
+	txn        KVTxn
+	values     map[iri]string
+	ids        map[string]iri
+	generation uint64
 }
 
 // MakeIriDictionary returns a new dictionary factory that compacts IRIs with base64 IDs
 func MakeIriDictionary(tags TagScheme, db *badger.DB) (DictionaryFactory, error) {
-	factory := &iriDictionaryFactory{tags: tags, db: db}
+	return MakeIriDictionaryWithBandwidth(tags, db, SequenceBandwidth)
+}
 
-	txn := db.NewTransaction(true)
-	defer txn.Discard()
-	_, err := txn.Get(SequenceKey)
-	if err == badger.ErrKeyNotFound {
-		// Yay! Now we have to write an initial one
-		val := make([]byte, 8)
-		binary.BigEndian.PutUint64(val, 128)
-		err = txn.Set(SequenceKey, val)
+// MakeIriDictionaryWithBandwidth is like MakeIriDictionary, but leases IDs from the
+// counter in blocks of the given size. Larger blocks mean fewer writes to the counter,
+// but up to a whole block of IDs is skipped whenever the process exits uncleanly.
+func MakeIriDictionaryWithBandwidth(tags TagScheme, db *badger.DB, bandwidth uint64) (DictionaryFactory, error) {
+	return MakeIriDictionaryKV(tags, BadgerKV(db), bandwidth)
+}
+
+// MakeIriDictionaryKV is like MakeIriDictionaryWithBandwidth, but keeps the dictionary in any KV
+func MakeIriDictionaryKV(tags TagScheme, kv KV, bandwidth uint64) (DictionaryFactory, error) {
+	factory := &iriDictionaryFactory{tags: tags, kv: kv, bandwidth: bandwidth}
+	err := factory.reset()
+	if err != nil {
+		return nil, err
+	}
+	return factory, nil
+}
+
+// reset releases the factory's lease on the ID counter, if it has one,
+// reconciles the counter with the dictionary, and leases it again.
+// This is needed whenever the dictionary is replaced, like in Restore.
+func (factory *iriDictionaryFactory) reset() (err error) {
+	replaced := factory.sequence != nil
+	if replaced {
+		err = factory.sequence.Release()
 		if err != nil {
-			return nil, err
+			return
+		}
+		factory.sequence = nil
+	}
+
+	err = reconcileSequence(factory.kv, replaced)
+	if err != nil {
+		return
+	}
+
+	factory.sequence, err = getSequence(factory.kv, SequenceKey, factory.bandwidth)
+	return
+}
+
+// reconcileSequence makes sure that the ID counter is past every ID in the dictionary
+// and the unary index (or at its initial value of 128 for a new store). The counter is
+// never moved back: the index is committed before the dictionary, so after a crash the
+// index can reference IDs whose dictionary entries were lost, and handing those out again
+// would give two terms the same ID. If the counter is behind an ID, it would hand it out
+// again, so this fails with ErrSequenceBehind instead, unless the dictionary was just
+// replaced with one that is expected to be ahead of the counter. IDs that can't be
+// parsed fail with ErrCorruptIndex.
+func reconcileSequence(kv KV, replaced bool) error {
+	kv, _, err := openLayout(kv, TabKeyLayout)
+	if err != nil {
+		return err
+	}
+
+	txn := kv.NewTransaction(true)
+	defer txn.Discard()
+
+	next := uint64(128)
+	for _, prefix := range []byte{IDToValuePrefix, UnaryPrefix} {
+		iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: []byte{prefix}})
+		for iter.Seek([]byte{prefix}); iter.Valid(); iter.Next() {
+			id := iri(iter.Item().Key()[1:])
+			if prefix == UnaryPrefix {
+				id = termIRI(ID(id))
+				if id == "" {
+					continue
+				}
+			}
+
+			n, err := toUint64(id)
+			if err != nil {
+				iter.Close()
+				return ErrCorruptIndex
+			} else if n >= next {
+				next = n + 1
+			}
 		}
+		iter.Close()
+	}
 
-		err = txn.Commit()
+	item, err := txn.Get(SequenceKey)
+	if err == nil {
+		var val []byte
+		val, err = item.ValueCopy(nil)
 		if err != nil {
-			return nil, err
+			return err
+		} else if len(val) != 8 {
+			return ErrCorruptIndex
 		}
-	} else if err != nil {
-		return nil, err
+
+		lease := binary.BigEndian.Uint64(val)
+		if lease >= next {
+			return nil
+		} else if !replaced {
+			return ErrSequenceBehind
+		}
+	} else if err != ErrKeyNotFound {
+		return err
 	}
 
-	factory.sequence, err = db.GetSequence(SequenceKey, SequenceBandwidth)
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, next)
+	err = txn.Set(SequenceKey, val)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return factory, nil
+	return txn.Commit()
+}
+
+// termIRI returns the counter ID that a term ID is made of: the IRI of named nodes,
+// the dataset of blank nodes, or the datatype of literals, if they have one
+func termIRI(id ID) iri {
+	if strings.HasPrefix(string(id), "\"") {
+		i := strings.LastIndexByte(string(id), '"')
+		if i < len(id)-1 && id[i+1] == ':' {
+			return iri(id[i+2:])
+		}
+		return ""
+	} else if i := strings.IndexAny(string(id), "#?"); i != -1 {
+		return iri(id[:i])
+	}
+	return iri(id)
 }
 
 func (factory *iriDictionaryFactory) Close() (err error) {
@@ -139,13 +241,14 @@ func (factory *iriDictionaryFactory) Close() (err error) {
 }
 
 func (factory *iriDictionaryFactory) Open(update bool) Dictionary {
-	txn := factory.db.NewTransaction(update)
+	txn := factory.kv.NewTransaction(update)
 	d := &iriDictionary{
-		txn:     txn,
-		update:  update,
-		values:  map[iri]string{"": ""},
-		ids:     map[string]iri{"": ""},
-		factory: factory,
+		txn:        txn,
+		update:     update,
+		values:     map[iri]string{"": ""},
+		ids:        map[string]iri{"": ""},
+		factory:    factory,
+		generation: factory.cache.current(),
 	}
 
 	for value, id := range vocabulary {
@@ -162,11 +265,18 @@ func (d *iriDictionary) getIRI(value string) (iri, error) {
 		return id, nil
 	}
 
+	id, has = d.factory.cache.get(value)
+	if has {
+		d.ids[value] = id
+		d.values[id] = value
+		return id, nil
+	}
+
 	key := make([]byte, len(value)+1)
 	key[0] = ValueToIDPrefix
 	copy(key[1:], value)
 	item, err := d.txn.Get(key)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		if d.factory.sequence != nil && d.update {
 			next, err := d.factory.sequence.Next()
 			if err != nil {
@@ -177,7 +287,7 @@ func (d *iriDictionary) getIRI(value string) (iri, error) {
 			idKey := make([]byte, 1+len(id))
 			idKey[0] = IDToValuePrefix
 			copy(idKey[1:], id)
-			d.txn, err = setSafe(idKey, []byte(value), d.txn, d.factory.db)
+			d.txn, err = setSafe(idKey, []byte(value), d.txn, d.factory.kv)
 			if err != nil {
 				return "", err
 			}
@@ -185,7 +295,7 @@ func (d *iriDictionary) getIRI(value string) (iri, error) {
 			valueKey := make([]byte, 1+len(value))
 			valueKey[0] = ValueToIDPrefix
 			copy(valueKey[1:], value)
-			d.txn, err = setSafe(valueKey, []byte(id), d.txn, d.factory.db)
+			d.txn, err = setSafe(valueKey, []byte(id), d.txn, d.factory.kv)
 			if err != nil {
 				return "", err
 			}
@@ -199,6 +309,7 @@ func (d *iriDictionary) getIRI(value string) (iri, error) {
 		if err != nil {
 			return "", err
 		}
+		d.factory.cache.add(value, id, d.generation)
 	}
 
 	d.ids[value] = id
@@ -206,6 +317,73 @@ func (d *iriDictionary) getIRI(value string) (iri, error) {
 	return id, nil
 }
 
+// preload looks up the IDs of the IRIs in a query pattern's default graph that
+// aren't cached yet. Instead of one Get per IRI, it seeks a single iterator
+// through the sorted value keys.
+func (d *iriDictionary) preload(pattern []*rdf.Quad) error {
+	values := []string{}
+	for _, quad := range pattern {
+		if quad[3].TermType() != rdf.DefaultGraphType {
+			continue
+		}
+		for _, term := range quad[:3] {
+			var value string
+			switch term := term.(type) {
+			case *rdf.NamedNode:
+				value = term.Value()
+				if d.factory.tags.Test(value) {
+					value, _ = d.factory.tags.Parse(value)
+				}
+			case *rdf.Literal:
+				if datatype := term.Datatype(); datatype != nil {
+					value = datatype.Value()
+				}
+			}
+			if _, has := d.ids[value]; has || value == "" {
+				continue
+			} else if id, has := d.factory.cache.get(value); has {
+				d.ids[value] = id
+				d.values[id] = value
+			} else {
+				values = append(values, value)
+			}
+		}
+	}
+
+	if len(values) < 2 {
+		return nil
+	}
+
+	sort.Strings(values)
+	prefix := []byte{ValueToIDPrefix}
+	iter := d.txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	defer iter.Close()
+
+	for i, value := range values {
+		if i > 0 && value == values[i-1] {
+			continue
+		}
+
+		key := append([]byte{ValueToIDPrefix}, value...)
+		iter.Seek(key)
+		if !iter.Valid() || !bytes.Equal(iter.Item().Key(), key) {
+			continue
+		}
+
+		var id iri
+		err := iter.Item().Value(func(val []byte) error { id = iri(val); return nil })
+		if err != nil {
+			return err
+		}
+
+		d.ids[value] = id
+		d.values[id] = value
+		d.factory.cache.add(value, id, d.generation)
+	}
+
+	return nil
+}
+
 func (d *iriDictionary) GetID(term rdf.Term, origin rdf.Term) (ID, error) {
 	var base string
 	if origin.TermType() == rdf.NamedNodeType {
@@ -269,19 +447,17 @@ func (d *iriDictionary) getValue(id iri) (string, error) {
 	key[0] = IDToValuePrefix
 	copy(key[1:], id)
 	item, err := d.txn.Get(key)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		return "", ErrNotFound
 	} else if err != nil {
 		return "", err
 	}
 
-	var val []byte
-	val, err = item.ValueCopy(nil)
+	err = item.Value(func(val []byte) error { value = string(val); return nil })
 	if err != nil {
 		return "", err
 	}
 
-	value = string(val)
 	d.values[id] = value
 	d.ids[value] = id
 	return value, nil
@@ -361,10 +537,12 @@ func (d *iriDictionary) Commit() error {
 		return nil
 	}
 
+	txn := d.txn
+	d.txn = nil
 	if d.update {
-		return d.txn.Commit()
+		return txn.Commit()
 	}
 
-	d.txn.Discard()
+	txn.Discard()
 	return nil
 }
@@ -0,0 +1,143 @@
+package styx
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+)
+
+type dictionaryEntry struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
+// toUint64 is the inverse of fromUint64
+func toUint64(id iri) (uint64, error) {
+	val, err := base64.StdEncoding.DecodeString(string(id))
+	if err != nil {
+		return 0, err
+	} else if len(val) > 8 {
+		return 0, ErrInvalidTerm
+	}
+
+	tmp := make([]byte, 8)
+	copy(tmp[8-len(val):], val)
+	return binary.BigEndian.Uint64(tmp), nil
+}
+
+// ExportDictionary writes the store's term dictionary as a stream of
+// newline-delimited JSON objects with "id" and "value" properties.
+func (s *Store) ExportDictionary(w io.Writer) error {
+	if _, is := s.Config.Dictionary.(*iriDictionaryFactory); !is {
+		return ErrUnsupportedDictionary
+	}
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte{ValueToIDPrefix}
+	iter := txn.NewIterator(KVIteratorOptions{
+		PrefetchValues: true,
+		Prefix:         prefix,
+	})
+	defer iter.Close()
+
+	encoder := json.NewEncoder(w)
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		entry := &dictionaryEntry{Value: string(item.KeyCopy(nil)[1:])}
+		err := item.Value(func(val []byte) error {
+			entry.ID = string(val)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = encoder.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportDictionary pre-loads a term dictionary written by ExportDictionary, so that
+// stores built from the same corpus assign identical IDs. It fails with
+// ErrDictionaryConflict if the store already maps any of the values or IDs differently.
+func (s *Store) ImportDictionary(r io.Reader) error {
+	factory, is := s.Config.Dictionary.(*iriDictionaryFactory)
+	if !is {
+		return ErrUnsupportedDictionary
+	}
+
+	txn := s.KV.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	var max uint64
+	decoder := json.NewDecoder(r)
+	for {
+		entry := &dictionaryEntry{}
+		err := decoder.Decode(entry)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		n, err := toUint64(iri(entry.ID))
+		if err != nil {
+			return err
+		} else if n > max {
+			max = n
+		}
+
+		valueKey := make([]byte, 1+len(entry.Value))
+		valueKey[0] = ValueToIDPrefix
+		copy(valueKey[1:], entry.Value)
+
+		idKey := make([]byte, 1+len(entry.ID))
+		idKey[0] = IDToValuePrefix
+		copy(idKey[1:], entry.ID)
+
+		for _, pair := range [][2][]byte{{valueKey, []byte(entry.ID)}, {idKey, []byte(entry.Value)}} {
+			item, err := txn.Get(pair[0])
+			if err == ErrKeyNotFound {
+				txn, err = setSafe(pair[0], pair[1], txn, s.KV)
+				if err != nil {
+					return err
+				}
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			err = item.Value(func(val []byte) error {
+				if string(val) != string(pair[1]) {
+					return ErrDictionaryConflict
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := txn.Commit()
+	if err != nil {
+		return err
+	}
+
+	// Advance the sequence past the imported IDs so that new terms don't collide
+	for next := uint64(0); next <= max; {
+		next, err = factory.sequence.Next()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package styx
+
+import (
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Plan describes how a query will be evaluated: the order in which its variables
+// are solved, and the constraints on each of them
+type Plan struct {
+	Variables []*PlanVariable
+	Empty     bool // Whether the query was found to have no solutions during planning
+}
+
+// A PlanVariable is one variable of a plan
+type PlanVariable struct {
+	Node        rdf.Term
+	Score       float64 // Lower scores are solved earlier
+	Norm        uint64
+	Constraints []*PlanConstraint
+	In          []int // The earlier variables this variable's constraints depend on
+	Out         []int // The later variables that depend on this variable
+}
+
+// A PlanConstraint is an occurrence of a variable in a quad of the pattern
+type PlanConstraint struct {
+	Quad  int // The index of the quad within the pattern
+	Place int // Subject = 0, predicate = 1, object = 2
+	Count uint32
+}
+
+// Explain assembles a query without running it and returns its plan
+func (s *Store) Explain(pattern []*rdf.Quad) (*Plan, error) {
+	iter, err := s.Query(pattern, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+
+	plan := &Plan{Variables: []*PlanVariable{}, Empty: iter.empty || iter.top}
+	if plan.Empty {
+		return plan, nil
+	}
+
+	for i, u := range iter.variables {
+		if i >= len(iter.domain) {
+			break
+		}
+
+		v := &PlanVariable{
+			Node:        iter.domain[i],
+			Score:       u.score,
+			Norm:        u.norm,
+			Constraints: make([]*PlanConstraint, len(u.cs)),
+			In:          iter.in[i],
+			Out:         iter.out[i],
+		}
+
+		for j, c := range u.cs {
+			v.Constraints[j] = &PlanConstraint{Quad: c.index, Place: int(c.place), Count: c.count}
+		}
+
+		plan.Variables = append(plan.Variables, v)
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,252 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	websocket "github.com/gorilla/websocket"
+	styx "github.com/underlay/styx"
+)
+
+// Fixtures are the sample datasets that conformance cases can load, by name
+var Fixtures = map[string]*Fixture{
+	Person.Name:    Person,
+	Appleseed.Name: Appleseed,
+}
+
+// A Case is a conformance test case: a sequence of exchanges with a server
+// whose store has the named fixtures loaded. Cases are JSON files in the
+// conformance directory, so that clients in any language can replay them.
+//
+// The protocol is either "rpc", where each request is a JSON-RPC 2.0 message sent
+// over a websocket with the "rpc" subprotocol and the response is the reply with
+// the same id, or "http", where each request and response is an HTTPExchange.
+// Responses only list the fields that a server has to return: a response matches
+// if every field it has is present in the actual response with a matching value.
+// Arrays have to have the same length and match element by element.
+type Case struct {
+	Description string      `json:"description"`
+	Protocol    string      `json:"protocol"`
+	Fixtures    []string    `json:"fixtures"`
+	Exchanges   []*Exchange `json:"exchanges"`
+}
+
+// An Exchange is a request and the expected response
+type Exchange struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// An HTTPExchange is an HTTP request or response of an "http" case. Responses are compared
+// on their listed headers, and on their body either exactly or, if given as JSON, with Matches.
+type HTTPExchange struct {
+	Method  string            `json:"method,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    *string           `json:"body,omitempty"`
+	JSON    json.RawMessage   `json:"json,omitempty"`
+}
+
+// LoadCases reads the conformance cases in a directory, by file name
+func LoadCases(dir string) (map[string]*Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	cases := make(map[string]*Case, len(paths))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &Case{}
+		if err = json.Unmarshal(data, c); err != nil {
+			return nil, err
+		}
+		cases[strings.TrimSuffix(filepath.Base(path), ".json")] = c
+	}
+	return cases, nil
+}
+
+// Conform runs every conformance case in a directory as a subtest, against test servers
+// that serve a fresh in-memory store with the case's fixtures using the given handler
+func Conform(t *testing.T, dir string, handler func(store *styx.Store) http.Handler) {
+	cases, err := LoadCases(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(cases) == 0 {
+		t.Fatal("No conformance cases in", dir)
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			fixtures := make([]*Fixture, len(c.Fixtures))
+			for i, name := range c.Fixtures {
+				if fixtures[i] = Fixtures[name]; fixtures[i] == nil {
+					t.Fatal("Unknown fixture", name)
+				}
+			}
+
+			store := Load(t, fixtures...)
+			defer store.Close()
+
+			server := httptest.NewServer(handler(store))
+			defer server.Close()
+
+			switch c.Protocol {
+			case "rpc":
+				conformRPC(t, server, c)
+			case "http":
+				conformHTTP(t, server, c)
+			default:
+				t.Fatal("Unknown protocol", c.Protocol)
+			}
+		})
+	}
+}
+
+func conformRPC(t *testing.T, server *httptest.Server, c *Case) {
+	dialer := &websocket.Dialer{Subprotocols: []string{"rpc"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	for i, exchange := range c.Exchanges {
+		request := struct {
+			ID interface{} `json:"id"`
+		}{}
+		if err := json.Unmarshal(exchange.Request, &request); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, exchange.Request); err != nil {
+			t.Fatal(err)
+		}
+
+		// Skip notifications until the reply to the request arrives
+		var reply map[string]interface{}
+		for {
+			reply = nil
+			if err := conn.ReadJSON(&reply); err != nil {
+				t.Fatal(err)
+			} else if id, has := reply["id"]; has && reflect.DeepEqual(id, request.ID) {
+				break
+			}
+		}
+
+		var expected interface{}
+		if err := json.Unmarshal(exchange.Response, &expected); err != nil {
+			t.Fatal(err)
+		} else if !Matches(expected, reply) {
+			t.Errorf("Exchange %d: expected %s, got %v", i, exchange.Response, reply)
+		}
+	}
+}
+
+func conformHTTP(t *testing.T, server *httptest.Server, c *Case) {
+	for i, exchange := range c.Exchanges {
+		request, expected := &HTTPExchange{}, &HTTPExchange{}
+		if err := json.Unmarshal(exchange.Request, request); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(exchange.Response, expected); err != nil {
+			t.Fatal(err)
+		}
+
+		body := []byte{}
+		if request.Body != nil {
+			body = []byte(*request.Body)
+		} else if request.JSON != nil {
+			body = request.JSON
+		}
+
+		req, err := http.NewRequest(request.Method, server.URL+request.Path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for key, value := range request.Headers {
+			req.Header.Set(key, value)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected.Status != 0 && res.StatusCode != expected.Status {
+			t.Errorf("Exchange %d: expected status %d, got %d", i, expected.Status, res.StatusCode)
+		}
+
+		for key, value := range expected.Headers {
+			if actual := res.Header.Get(key); actual != value {
+				t.Errorf("Exchange %d: expected %s header %q, got %q", i, key, value, actual)
+			}
+		}
+
+		if expected.Body != nil && string(data) != *expected.Body {
+			t.Errorf("Exchange %d: expected body %q, got %q", i, *expected.Body, data)
+		}
+
+		if expected.JSON != nil {
+			var e, a interface{}
+			if err := json.Unmarshal(expected.JSON, &e); err != nil {
+				t.Fatal(err)
+			} else if err := json.Unmarshal(data, &a); err != nil {
+				t.Errorf("Exchange %d: expected JSON, got %q", i, data)
+			} else if !Matches(e, a) {
+				t.Errorf("Exchange %d: expected %s, got %s", i, expected.JSON, data)
+			}
+		}
+	}
+}
+
+// Matches reports whether every field of the expected JSON value is in the actual value
+// with a matching value. Arrays have to have the same length and match element by element.
+func Matches(expected, actual interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, is := actual.(map[string]interface{})
+		if !is {
+			return false
+		}
+		for key, value := range e {
+			if v, has := a[key]; !has || !Matches(value, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, is := actual.([]interface{})
+		if !is || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !Matches(e[i], a[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(expected, actual)
+	}
+}
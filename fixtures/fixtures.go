@@ -0,0 +1,160 @@
+// Package fixtures loads canonical sample datasets into in-memory stores and
+// compares query results against golden files, for writing regression tests.
+package fixtures
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+	rdf "github.com/underlay/go-rdfjs"
+	styx "github.com/underlay/styx"
+)
+
+// Prefix is the tag scheme prefix of the fixture datasets
+const Prefix = "http://example.com/"
+
+var update = flag.Bool("update", false, "rewrite golden files with the current results")
+
+// A Fixture is a named JSON-LD sample dataset
+type Fixture struct {
+	Name     string
+	Document string
+}
+
+// URI is the dataset URI the fixture is loaded under
+func (fixture *Fixture) URI() string {
+	return Prefix + fixture.Name
+}
+
+// Person is a person who knows another person, with typed and language-tagged literals
+var Person = &Fixture{"person", `{
+	"@context": {
+		"@vocab": "http://schema.org/",
+		"xsd": "http://www.w3.org/2001/XMLSchema#",
+		"prov": "http://www.w3.org/ns/prov#",
+		"prov:generatedAtTime": { "@type": "xsd:dateTime" },
+		"birthDate": { "@type": "xsd:date" }
+	},
+	"prov:generatedAtTime": "2019-07-24T16:46:05.751Z",
+	"@graph": {
+		"@type": "Person",
+		"name": ["John Doe", "Johnny Doe"],
+		"birthDate": "1996-02-02",
+		"knows": {
+			"@id": "http://people.com/jane",
+			"@type": "Person",
+			"name": "Jane Doe",
+			"familyName": { "@value": "Doe", "@language": "en" },
+			"birthDate": "1995-01-01"
+		}
+	}
+}`}
+
+// Appleseed is a second person who knows the same person as Person
+var Appleseed = &Fixture{"appleseed", `{
+	"@context": {
+		"@vocab": "http://schema.org/",
+		"xsd": "http://www.w3.org/2001/XMLSchema#",
+		"birthDate": { "@type": "xsd:date" }
+	},
+	"@type": "Person",
+	"name": "Johnanthan Appleseed",
+	"birthDate": "1780-01-10",
+	"knows": { "@id": "http://people.com/jane" }
+}`}
+
+// Open returns an empty in-memory store, which the caller has to close
+func Open(t testing.TB) *styx.Store {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := styx.NewPrefixTagScheme(Prefix)
+	dictionary, err := styx.MakeIriDictionary(tags, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := styx.NewStore(&styx.Config{
+		TagScheme:  tags,
+		Dictionary: dictionary,
+		QuadStore:  styx.MakeBadgerStore(db),
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+// Load opens an in-memory store with the given fixtures inserted
+func Load(t testing.TB, fixtures ...*Fixture) *styx.Store {
+	store := Open(t)
+	for _, fixture := range fixtures {
+		err := store.SetJSONLD(fixture.URI(), fixture.Document, true)
+		if err != nil {
+			store.Close()
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// Solutions collects every solution to a pattern as sorted, tab-separated lines of N-Quads terms
+func Solutions(t testing.TB, store *styx.Store, pattern []*rdf.Quad) string {
+	iter, err := store.Query(pattern, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer iter.Close()
+
+	lines := []string{}
+	for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		index := iter.Index()
+		values := make([]string, len(index))
+		for i, term := range index {
+			if term != nil {
+				values[i] = term.String()
+			}
+		}
+		lines = append(lines, strings.Join(values, "\t"))
+	}
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Golden compares a result with the contents of testdata/{name}.golden,
+// or rewrites the file if the tests are run with -update
+func Golden(t testing.TB, name string, result string) {
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.MkdirAll("testdata", 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(result), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(expected) != result {
+		t.Errorf("%s doesn't match the golden file:\n--- expected\n%s--- got\n%s", name, expected, result)
+	}
+}
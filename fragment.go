@@ -0,0 +1,117 @@
+package styx
+
+import (
+	"encoding/binary"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Fragment is a page of the triples that match a single triple pattern,
+// together with the total number of matching triples
+type Fragment struct {
+	Triples []*rdf.Quad
+	Count   uint64
+}
+
+// fragmentPermutations picks the triple index whose key prefix covers the bound
+// terms of a pattern, indexed by a bitmask of bound subject (1), predicate (2) and object (4)
+var fragmentPermutations = [8]Permutation{SPO, SPO, POS, SPO, OSP, OSP, POS, SPO}
+
+// Fragment returns the triples matching a triple pattern, skipping offset triples
+// and returning at most limit. Nil terms, variables and blank nodes are unbound.
+func (s *Store) Fragment(subject, predicate, object rdf.Term, offset, limit int) (*Fragment, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	var terms [3]ID
+	var mask int
+	for i, term := range []rdf.Term{subject, predicate, object} {
+		if term == nil || term.TermType() == rdf.VariableType || term.TermType() == rdf.BlankNodeType {
+			continue
+		}
+
+		id, err := dictionary.GetID(term, rdf.Default)
+		if err == ErrNotFound {
+			return &Fragment{Triples: []*rdf.Quad{}}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		terms[i] = id
+		mask |= 1 << uint(i)
+	}
+
+	p := fragmentPermutations[mask]
+	a, b, c := major.permute(p, terms)
+	bound := []ID{}
+	for _, id := range []ID{a, b, c} {
+		if id == NIL {
+			break
+		}
+		bound = append(bound, id)
+	}
+
+	prefix := assembleKey(TernaryPrefixes[p], len(bound) < 3, bound...)
+	if len(bound) == 0 {
+		prefix = []byte{TernaryPrefixes[p]}
+	}
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	fragment := &Fragment{Triples: []*rdf.Quad{}}
+
+	// With two bound terms, the binary index has the exact count
+	if len(bound) == 2 {
+		item, err := txn.Get(assembleKey(BinaryPrefixes[p], false, bound...))
+		if err == ErrKeyNotFound {
+			return fragment, nil
+		} else if err != nil {
+			return nil, err
+		}
+		err = item.Value(func(val []byte) (err error) {
+			val, err = openCounts(val, 1)
+			if err == nil {
+				fragment.Count = uint64(binary.BigEndian.Uint32(val))
+			}
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	defer iter.Close()
+
+	row := major[p]
+	i := 0
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		if len(bound) != 2 {
+			fragment.Count++
+		}
+
+		if i >= offset && len(fragment.Triples) < limit {
+			ids := strings.Split(string(iter.Item().Key()[1:]), "\t")
+			if len(ids) != 3 {
+				return nil, ErrCorruptIndex
+			}
+
+			var triple [3]rdf.Term
+			for j, id := range ids {
+				term, err := dictionary.GetTerm(ID(id), rdf.Default)
+				if err != nil {
+					return nil, err
+				}
+				triple[row[j]] = term
+			}
+			fragment.Triples = append(fragment.Triples, rdf.NewQuad(triple[0], triple[1], triple[2], rdf.Default))
+		} else if len(bound) == 2 && len(fragment.Triples) == limit {
+			break
+		}
+		i++
+	}
+
+	return fragment, nil
+}
@@ -0,0 +1,84 @@
+package styx
+
+import (
+	"container/heap"
+	"sort"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Frequency is the usage count of a term, taken from its unary index.
+// Counts holds the six raw counters, and Count is the sum of the three major ones:
+// the number of distinct predicates the term has as a subject, plus the number of
+// distinct objects it has as a predicate, plus the number of distinct subjects it has
+// as an object.
+type Frequency struct {
+	Term   rdf.Term
+	Count  uint64
+	Counts [6]uint32
+}
+
+type frequencyHeap []*Frequency
+
+func (h frequencyHeap) Len() int            { return len(h) }
+func (h frequencyHeap) Less(a, b int) bool  { return h[a].Count < h[b].Count }
+func (h frequencyHeap) Swap(a, b int)       { h[a], h[b] = h[b], h[a] }
+func (h *frequencyHeap) Push(x interface{}) { *h = append(*h, x.(*Frequency)) }
+func (h *frequencyHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Frequencies returns the n most frequently used terms (IRIs and literals alike),
+// most frequent first. Near-duplicate literals near the top of this list are
+// often a sign of data quality issues that will pollute joins.
+func (s *Store) Frequencies(n int) ([]*Frequency, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte{UnaryPrefix}
+	iter := txn.NewIterator(KVIteratorOptions{
+		PrefetchValues: true,
+		Prefix:         prefix,
+	})
+	defer iter.Close()
+
+	h := &frequencyHeap{}
+	ids := map[*Frequency]ID{}
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		index, err := getUnaryIndex(item)
+		if err != nil {
+			return nil, err
+		}
+
+		f := &Frequency{Counts: *index}
+		f.Count = uint64(index[0]) + uint64(index[1]) + uint64(index[2])
+		if h.Len() < n {
+			heap.Push(h, f)
+		} else if n > 0 && (*h)[0].Count < f.Count {
+			delete(ids, heap.Pop(h).(*Frequency))
+			heap.Push(h, f)
+		} else {
+			continue
+		}
+		ids[f] = ID(item.KeyCopy(nil)[1:])
+	}
+
+	result := []*Frequency(*h)
+	sort.Slice(result, func(a, b int) bool { return result[a].Count > result[b].Count })
+	for _, f := range result {
+		term, err := dictionary.GetTerm(ids[f], rdf.Default)
+		if err != nil {
+			return nil, err
+		}
+		f.Term = term
+	}
+
+	return result, nil
+}
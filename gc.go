@@ -0,0 +1,72 @@
+package styx
+
+import (
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// GCStats are the results of value log garbage collection. Reclaimed is the
+// decrease in the size of the value log, which badger only updates periodically,
+// so it is an estimate.
+type GCStats struct {
+	Runs      int   // The number of value log files that were rewritten
+	Reclaimed int64 // The number of bytes reclaimed
+}
+
+// RunGC garbage collects the value log until there is nothing left to rewrite.
+// Files are rewritten if at least discardRatio of their space can be discarded.
+func (s *Store) RunGC(discardRatio float64) (*GCStats, error) {
+	if s.Badger == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	_, before := s.Badger.Size()
+
+	stats := &GCStats{}
+	var err error
+	for err == nil {
+		err = s.Badger.RunValueLogGC(discardRatio)
+		if err == nil {
+			stats.Runs++
+		}
+	}
+
+	_, after := s.Badger.Size()
+	if before > after {
+		stats.Reclaimed = before - after
+	}
+
+	s.lock.Lock()
+	s.gc.Runs += stats.Runs
+	s.gc.Reclaimed += stats.Reclaimed
+	s.lock.Unlock()
+
+	if err == badger.ErrNoRewrite || err == badger.ErrGCInMemoryMode {
+		return stats, nil
+	}
+	return stats, err
+}
+
+// GCStats returns the total results of every garbage collection since the store was opened
+func (s *Store) GCStats() GCStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.gc
+}
+
+// collect runs the garbage collector every interval until the store is closed
+func (s *Store) collect(interval time.Duration, discardRatio float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.RunGC(discardRatio); err != nil {
+				s.Config.Logger.Error("Value log GC failed", Field{"error", err})
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// geohashPrecision is the number of geohash characters in geo index keys, about 4cm
+const geohashPrecision = 12
+
+// geohashCells is the most geohash cells that a bounding box is scanned as
+const geohashCells = 32
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// earthRadius is the mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+var patternPoint = regexp.MustCompile(`(?i)^\s*(?:<[^>]*>\s*)?POINT\s*\(\s*(\S+)\s+(\S+)\s*\)\s*$`)
+
+// A Point is a location in WGS84 degrees
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (p Point) valid() bool {
+	return -90 <= p.Latitude && p.Latitude <= 90 && -180 <= p.Longitude && p.Longitude <= 180
+}
+
+// A BoundingBox is the area between two corners. Boxes whose
+// West is greater than their East cross the antimeridian.
+type BoundingBox struct {
+	South, West, North, East float64
+}
+
+// parsePoint parses a WKT point literal, which is written longitude first
+func parsePoint(wkt string) (Point, bool) {
+	match := patternPoint.FindStringSubmatch(wkt)
+	if match == nil {
+		return Point{}, false
+	}
+	longitude, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Point{}, false
+	}
+	latitude, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return Point{}, false
+	}
+	p := Point{latitude, longitude}
+	return p, p.valid()
+}
+
+// geohash encodes a point as a geohash with the given number of characters
+func geohash(p Point, precision int) []byte {
+	lat, lon := [2]float64{-90, 90}, [2]float64{-180, 180}
+	hash := make([]byte, precision)
+	for i, bit := 0, 0; i < precision; i++ {
+		var c byte
+		for j := 0; j < 5; j, bit = j+1, bit+1 {
+			c <<= 1
+			r, v := &lon, p.Longitude
+			if bit%2 == 1 {
+				r, v = &lat, p.Latitude
+			}
+			if mid := (r[0] + r[1]) / 2; v >= mid {
+				c |= 1
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+		}
+		hash[i] = geohashAlphabet[c]
+	}
+	return hash
+}
+
+// geoKeys recognizes the WKT point literals and schema.org GeoCoordinates in a dataset,
+// and returns their keys in the geo index. Points are indexed under the subject of the
+// literal, and coordinates under the subject with both a latitude and a longitude.
+func geoKeys(origin ID, quads [][4]ID, dictionary Dictionary, node rdf.Term) ([][]byte, [][]byte, error) {
+	points := map[ID]Point{}
+	latitudes, longitudes := map[ID]float64{}, map[ID]float64{}
+	for _, quad := range quads {
+		object, err := dictionary.GetTerm(quad[2], node)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		literal, is := object.(*rdf.Literal)
+		if !is {
+			continue
+		}
+
+		if datatype := literal.Datatype(); datatype != nil && datatype.Value() == geoWktLiteral {
+			if p, ok := parsePoint(literal.Value()); ok {
+				points[quad[0]] = p
+			}
+			continue
+		}
+
+		predicate, err := dictionary.GetTerm(quad[1], node)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := schemaProperty(predicate.Value())
+		if name != "latitude" && name != "longitude" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(literal.Value()), 64)
+		if err != nil {
+			continue
+		} else if name == "latitude" {
+			latitudes[quad[0]] = value
+		} else {
+			longitudes[quad[0]] = value
+		}
+	}
+
+	for subject, latitude := range latitudes {
+		if longitude, has := longitudes[subject]; has {
+			if p := (Point{latitude, longitude}); p.valid() {
+				points[subject] = p
+			}
+		}
+	}
+
+	keys, values := make([][]byte, 0, len(points)), make([][]byte, 0, len(points))
+	for subject, p := range points {
+		key := append([]byte{GeoPrefix}, geohash(p, geohashPrecision)...)
+		key = append(key, subject...)
+		key = append(key, '\t')
+		keys = append(keys, append(key, origin...))
+
+		val := make([]byte, 16)
+		binary.BigEndian.PutUint64(val[:8], math.Float64bits(p.Latitude))
+		binary.BigEndian.PutUint64(val[8:], math.Float64bits(p.Longitude))
+		values = append(values, val)
+	}
+	return keys, values, nil
+}
+
+// indexGeometries adds the points of a dataset to the geo index, or removes them
+func indexGeometries(origin ID, quads [][4]ID, dictionary Dictionary, node rdf.Term, remove bool, t KVTxn, db KV) (txn KVTxn, err error) {
+	txn = t
+	keys, values, err := geoKeys(origin, quads, dictionary, node)
+	if err != nil {
+		return
+	}
+
+	for i, key := range keys {
+		if remove {
+			txn, err = deleteSafe(key, txn, db)
+		} else {
+			txn, err = setSafe(key, values[i], txn, db)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FilterBoundingBox returns a transformer that keeps the solutions binding the variable
+// to the subject of a point (a geo:wktLiteral POINT, or a schema.org latitude and longitude)
+// inside the box. The matching subjects are read from the geo index once per query.
+func FilterBoundingBox(variable rdf.Term, box BoundingBox) (Transformer, error) {
+	if !(Point{box.South, box.West}).valid() || !(Point{box.North, box.East}).valid() || box.South > box.North {
+		return nil, ErrInvalidGeometry
+	}
+
+	return geoFilter(variable, box, func(Point) bool { return true }), nil
+}
+
+// FilterRadius returns a transformer that keeps the solutions binding the variable to the
+// subject of a point within radius meters of the center, by great-circle distance.
+// The matching subjects are read from the geo index once per query.
+func FilterRadius(variable rdf.Term, center Point, radius float64) (Transformer, error) {
+	if !center.valid() || !(radius >= 0) {
+		return nil, ErrInvalidGeometry
+	}
+
+	// The box around the circle covers every longitude if it reaches a pole
+	d := radius / earthRadius * 180 / math.Pi
+	box := BoundingBox{math.Max(center.Latitude-d, -90), -180, math.Min(center.Latitude+d, 90), 180}
+	if box.South > -90 && box.North < 90 {
+		w := d / math.Cos(center.Latitude*math.Pi/180)
+		if w < 180 {
+			box.West, box.East = center.Longitude-w, center.Longitude+w
+			if box.West < -180 {
+				box.West += 360
+			}
+			if box.East > 180 {
+				box.East -= 360
+			}
+		}
+	}
+
+	return geoFilter(variable, box, func(p Point) bool { return distance(center, p) <= radius }), nil
+}
+
+func geoFilter(variable rdf.Term, box BoundingBox, keep func(Point) bool) Transformer {
+	var subjects map[ID]bool
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		if subjects == nil {
+			subjects = map[ID]bool{}
+			if scanGeometries(iter.txn, box, keep, subjects) != nil {
+				return nil
+			}
+		}
+
+		if !subjects[iter.lookup(variable)] {
+			return nil
+		}
+		return index
+	})
+}
+
+// distance returns the great-circle distance between two points in meters
+func distance(a, b Point) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat, dLon := lat2-lat1, (b.Longitude-a.Longitude)*math.Pi/180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// scanGeometries collects the subjects of the points inside the box that keep accepts.
+// The box is scanned as the geohash cells of the finest precision with at most
+// geohashCells cells covering it, and the points in them are checked exactly.
+func scanGeometries(txn KVTxn, box BoundingBox, keep func(Point) bool, subjects map[ID]bool) error {
+	boxes := []BoundingBox{box}
+	if box.West > box.East {
+		boxes = []BoundingBox{{box.South, box.West, box.North, 180}, {box.South, -180, box.North, box.East}}
+	}
+
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true})
+	defer iter.Close()
+
+	for _, box := range boxes {
+		for _, cell := range geohashCover(box) {
+			prefix := append([]byte{GeoPrefix}, cell...)
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+				item := iter.Item()
+				rest := item.Key()[1+geohashPrecision:]
+				i := bytes.IndexByte(rest, '\t')
+				if i == -1 {
+					return ErrCorruptIndex
+				}
+
+				var p Point
+				err := item.Value(func(val []byte) error {
+					if len(val) != 16 {
+						return ErrCorruptIndex
+					}
+					p.Latitude = math.Float64frombits(binary.BigEndian.Uint64(val[:8]))
+					p.Longitude = math.Float64frombits(binary.BigEndian.Uint64(val[8:]))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+
+				if box.South <= p.Latitude && p.Latitude <= box.North &&
+					box.West <= p.Longitude && p.Longitude <= box.East && keep(p) {
+					subjects[ID(rest[:i])] = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// geohashCover returns the geohash cells that cover a box that doesn't cross the antimeridian
+func geohashCover(box BoundingBox) [][]byte {
+	cell := func(v, min, size float64, n int) int {
+		i := int(math.Floor((v - min) / size))
+		if i >= n {
+			i = n - 1
+		}
+		return i
+	}
+
+	var cells [][]byte
+	for precision := 1; precision <= geohashPrecision; precision++ {
+		bits := 5 * precision
+		lons, lats := 1<<uint((bits+1)/2), 1<<uint(bits/2)
+		width, height := 360/float64(lons), 180/float64(lats)
+		x0, x1 := cell(box.West, -180, width, lons), cell(box.East, -180, width, lons)
+		y0, y1 := cell(box.South, -90, height, lats), cell(box.North, -90, height, lats)
+		if precision > 1 && (x1-x0+1)*(y1-y0+1) > geohashCells {
+			break
+		}
+
+		cells = cells[:0]
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				center := Point{-90 + (float64(y)+0.5)*height, -180 + (float64(x)+0.5)*width}
+				cells = append(cells, geohash(center, precision))
+			}
+		}
+	}
+	return cells
+}
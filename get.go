@@ -19,6 +19,69 @@ func (s *Store) Get(node rdf.Term) ([]*rdf.Quad, error) {
 		return nil, err
 	}
 
+	return getQuadTerms(quads, dictionary, node)
+}
+
+// readDataset is like getDataset, but also reports whether the dataset has been written
+func (s *Store) readDataset(node rdf.Term) ([]*rdf.Quad, bool, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	origin, err := dictionary.GetID(node, rdf.Default)
+	if err == ErrNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	// Every write records the usage of its dataset, even if it's empty
+	item, err := txn.Get(assembleKey(UsagePrefix, false, origin))
+	if err == ErrKeyNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	usage, err := parseUsage(item)
+	if err != nil {
+		return nil, false, err
+	} else if usage.Quads == 0 {
+		return nil, true, nil
+	}
+
+	dataset, err := s.getDataset(node)
+	return dataset, true, err
+}
+
+// skolemize names the terms of the quads of a dataset the way that queries return them,
+// with the dataset's blank nodes as IRIs, in the default graph
+func (s *Store) skolemize(node rdf.Term, quads []*rdf.Quad) ([]*rdf.Quad, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	result := make([]*rdf.Quad, len(quads))
+	for i, quad := range quads {
+		var terms [3]rdf.Term
+		for j, term := range quad[:3] {
+			id, err := dictionary.GetID(term, node)
+			if err != nil {
+				return nil, err
+			}
+			terms[j], err = dictionary.GetTerm(id, rdf.Default)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result[i] = rdf.NewQuad(terms[0], terms[1], terms[2], rdf.Default)
+	}
+	return result, nil
+}
+
+// getQuadTerms translates the quads of a dataset from IDs into terms
+func getQuadTerms(quads [][4]ID, dictionary Dictionary, node rdf.Term) ([]*rdf.Quad, error) {
 	dataset := make([]*rdf.Quad, len(quads))
 	for i, quad := range quads {
 		s, err := dictionary.GetTerm(quad[0], node)
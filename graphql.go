@@ -0,0 +1,722 @@
+package styx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ld "github.com/piprate/json-gold/ld"
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// GraphQL queries are translated into query patterns. Each top-level field selects the
+// nodes whose rdf:type is the field's name, and each nested field is a predicate from its
+// parent node, with names expanded like the terms of Config.GraphQLContext. Fields with
+// selections of their own are nodes, and the "id" field is the IRI of a node. Arguments are
+// values that the node's fields have to have, and the "id" argument is the node itself:
+//
+//	{ Person(name: "Jane Doe") { id knows(id: "http://people.com/john") { name } } }
+//
+// Every selected field has to match, like the quads of a pattern, and fields with more than
+// one value are lists, like in compacted JSON-LD. Top-level fields are always lists, and take
+// a "first" argument that limits the number of nodes. Fragments, directives, list and object
+// values, mutations, subscriptions, and introspection aren't supported.
+
+type graphqlField struct {
+	alias      string
+	name       string
+	arguments  []graphqlArgument
+	selections []*graphqlField
+	term       rdf.Term
+}
+
+type graphqlArgument struct {
+	name  string
+	value interface{}
+}
+
+// graphqlEnum is an enum value, which is expanded as a vocabulary IRI
+type graphqlEnum string
+
+func (field *graphqlField) argument(name string) (interface{}, bool) {
+	for _, argument := range field.arguments {
+		if argument.name == name {
+			return argument.value, true
+		}
+	}
+	return nil, false
+}
+
+type graphqlParser struct {
+	query     string
+	offset    int
+	variables map[string]interface{}
+}
+
+// parseGraphQL parses the selections of a query document with a single operation
+func parseGraphQL(query string, variables map[string]interface{}) ([]*graphqlField, error) {
+	p := &graphqlParser{query: query, variables: make(map[string]interface{}, len(variables))}
+	for name, value := range variables {
+		p.variables[name] = value
+	}
+
+	if p.peek() != '{' {
+		operation, err := p.name()
+		if err != nil {
+			return nil, err
+		} else if operation != "query" {
+			return nil, ErrUnsupportedGraphQL
+		}
+
+		if isNameStart(p.peek()) {
+			p.name()
+		}
+
+		if p.consume('(') {
+			if err = p.definitions(); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.peek() == '@' {
+			return nil, ErrUnsupportedGraphQL
+		}
+	}
+
+	selections, err := p.selections()
+	if err != nil {
+		return nil, err
+	} else if c := p.peek(); isNameStart(c) || c == '{' {
+		return nil, ErrUnsupportedGraphQL
+	} else if c != 0 {
+		return nil, ErrInvalidGraphQL
+	}
+	return selections, nil
+}
+
+// skip moves past whitespace, commas, and comments
+func (p *graphqlParser) skip() {
+	for p.offset < len(p.query) {
+		switch p.query[p.offset] {
+		case ' ', '\t', '\n', '\r', ',':
+			p.offset++
+		case '#':
+			for p.offset < len(p.query) && p.query[p.offset] != '\n' {
+				p.offset++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next character after whitespace, or 0 at the end of the query
+func (p *graphqlParser) peek() byte {
+	p.skip()
+	if p.offset == len(p.query) {
+		return 0
+	}
+	return p.query[p.offset]
+}
+
+func (p *graphqlParser) consume(c byte) bool {
+	if p.peek() == c {
+		p.offset++
+		return true
+	}
+	return false
+}
+
+func (p *graphqlParser) expect(c byte) error {
+	if !p.consume(c) {
+		return ErrInvalidGraphQL
+	}
+	return nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (p *graphqlParser) name() (string, error) {
+	if !isNameStart(p.peek()) {
+		return "", ErrInvalidGraphQL
+	}
+
+	start := p.offset
+	for p.offset < len(p.query) && (isNameStart(p.query[p.offset]) || '0' <= p.query[p.offset] && p.query[p.offset] <= '9') {
+		p.offset++
+	}
+	return p.query[start:p.offset], nil
+}
+
+// definitions parses variable definitions, whose types are ignored,
+// and uses their default values for the variables that weren't given
+func (p *graphqlParser) definitions() error {
+	for !p.consume(')') {
+		if err := p.expect('$'); err != nil {
+			return err
+		}
+
+		name, err := p.name()
+		if err != nil {
+			return err
+		} else if err = p.expect(':'); err != nil {
+			return err
+		} else if err = p.typeReference(); err != nil {
+			return err
+		}
+
+		if p.consume('=') {
+			value, err := p.value(true)
+			if err != nil {
+				return err
+			} else if _, has := p.variables[name]; !has {
+				p.variables[name] = value
+			}
+		}
+
+		if p.peek() == '@' {
+			return ErrUnsupportedGraphQL
+		}
+	}
+	return nil
+}
+
+func (p *graphqlParser) typeReference() error {
+	if p.consume('[') {
+		if err := p.typeReference(); err != nil {
+			return err
+		} else if err := p.expect(']'); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	p.consume('!')
+	return nil
+}
+
+func (p *graphqlParser) selections() ([]*graphqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	var fields []*graphqlField
+	for !p.consume('}') {
+		if p.peek() == '.' {
+			return nil, ErrUnsupportedGraphQL
+		}
+
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrInvalidGraphQL
+	}
+	return fields, nil
+}
+
+func (p *graphqlParser) field() (*graphqlField, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	field := &graphqlField{alias: name, name: name}
+	if p.consume(':') {
+		field.name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.consume('(') {
+		for !p.consume(')') {
+			argument, err := p.name()
+			if err != nil {
+				return nil, err
+			} else if err = p.expect(':'); err != nil {
+				return nil, err
+			}
+
+			value, err := p.value(false)
+			if err != nil {
+				return nil, err
+			}
+			field.arguments = append(field.arguments, graphqlArgument{argument, value})
+		}
+	}
+
+	if p.peek() == '@' {
+		return nil, ErrUnsupportedGraphQL
+	} else if p.peek() == '{' {
+		field.selections, err = p.selections()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// value parses an argument value, or a default value if constant is true.
+// Variables that weren't given and don't have a default are null.
+func (p *graphqlParser) value(constant bool) (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '$' && !constant:
+		p.offset++
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return p.variables[name], nil
+	case c == '"':
+		return p.string()
+	case c == '-' || '0' <= c && c <= '9':
+		return p.number()
+	case c == '[' || c == '{':
+		return nil, ErrUnsupportedGraphQL
+	case isNameStart(c):
+		name, _ := p.name()
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return graphqlEnum(name), nil
+	}
+	return nil, ErrInvalidGraphQL
+}
+
+// string parses a string value, whose escapes are the same as JSON's
+func (p *graphqlParser) string() (interface{}, error) {
+	if strings.HasPrefix(p.query[p.offset:], `"""`) {
+		return nil, ErrUnsupportedGraphQL
+	}
+
+	start := p.offset
+	for p.offset++; p.offset < len(p.query); p.offset++ {
+		switch p.query[p.offset] {
+		case '\\':
+			p.offset++
+		case '\n':
+			return nil, ErrInvalidGraphQL
+		case '"':
+			p.offset++
+			var value string
+			if json.Unmarshal([]byte(p.query[start:p.offset]), &value) != nil {
+				return nil, ErrInvalidGraphQL
+			}
+			return value, nil
+		}
+	}
+	return nil, ErrInvalidGraphQL
+}
+
+func (p *graphqlParser) number() (interface{}, error) {
+	start := p.offset
+	for p.offset < len(p.query) && strings.IndexByte("+-.0123456789eE", p.query[p.offset]) != -1 {
+		p.offset++
+	}
+
+	lexical := p.query[start:p.offset]
+	if i, err := strconv.ParseInt(lexical, 10, 64); err == nil {
+		return i, nil
+	} else if f, err := strconv.ParseFloat(lexical, 64); err == nil {
+		return f, nil
+	}
+	return nil, ErrInvalidGraphQL
+}
+
+// A graphqlPattern is the pattern that a top-level field is translated into
+type graphqlPattern struct {
+	context   *ld.Context
+	pattern   []*rdf.Quad
+	variables int
+}
+
+func (g *graphqlPattern) variable() rdf.Term {
+	g.variables++
+	return rdf.NewVariable(fmt.Sprintf("graphql%d", g.variables))
+}
+
+// iri expands a field name or a vocabulary value with the context
+func (g *graphqlPattern) iri(name string, vocab bool) (rdf.Term, error) {
+	value, err := g.context.ExpandIri(name, !vocab, vocab, nil, nil)
+	if err != nil {
+		return nil, err
+	} else if !ld.IsAbsoluteIri(value) {
+		return nil, ErrInvalidGraphQL
+	}
+	return rdf.NewNamedNode(value), nil
+}
+
+// root translates a top-level field into the nodes of its type
+func (g *graphqlPattern) root(field *graphqlField) (err error) {
+	field.term = g.variable()
+	if id, has := field.argument("id"); has {
+		field.term, err = g.value("id", id)
+		if err != nil {
+			return
+		}
+	}
+
+	class, err := g.iri(field.name, true)
+	if err != nil {
+		return
+	}
+
+	g.pattern = append(g.pattern, rdf.NewQuad(field.term, rdf.NewNamedNode(ld.RDFType), class, nil))
+	return g.node(field, true)
+}
+
+// node adds the arguments and selections of a field whose values are nodes
+func (g *graphqlPattern) node(field *graphqlField, root bool) error {
+	for _, argument := range field.arguments {
+		if argument.name == "id" || root && argument.name == "first" {
+			continue
+		}
+
+		object, err := g.value(argument.name, argument.value)
+		if err != nil {
+			return err
+		} else if err = g.edge(field.term, argument.name, object); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range field.selections {
+		if child.name == "id" {
+			child.term = field.term
+			continue
+		} else if child.name == "__typename" {
+			continue
+		} else if strings.HasPrefix(child.name, "__") {
+			return ErrUnsupportedGraphQL
+		}
+
+		child.term = g.variable()
+		if id, has := child.argument("id"); has {
+			term, err := g.value("id", id)
+			if err != nil {
+				return err
+			}
+			child.term = term
+		}
+
+		if err := g.edge(field.term, child.name, child.term); err != nil {
+			return err
+		} else if err = g.node(child, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// edge adds the quad of a field, which points from the object to the subject for reverse properties
+func (g *graphqlPattern) edge(subject rdf.Term, name string, object rdf.Term) error {
+	predicate, err := g.iri(name, true)
+	if err != nil {
+		return err
+	} else if g.context.IsReverseProperty(name) {
+		subject, object = object, subject
+	}
+	g.pattern = append(g.pattern, rdf.NewQuad(subject, predicate, object, nil))
+	return nil
+}
+
+// value translates an argument into a term with the type mapping of the field in the context,
+// the same way that JSON-LD values are. Numbers are integers if they don't have a fraction.
+func (g *graphqlPattern) value(name string, value interface{}) (rdf.Term, error) {
+	mapping := g.context.GetTypeMapping(name)
+	switch value := value.(type) {
+	case string:
+		if name == "id" || mapping == "@id" {
+			return g.iri(value, false)
+		} else if mapping == "@vocab" {
+			return g.iri(value, true)
+		} else if mapping != "" {
+			return rdf.NewLiteral(value, "", rdf.NewNamedNode(mapping)), nil
+		} else if language, is := g.context.GetLanguageMapping(name).(string); is {
+			return rdf.NewLiteral(value, strings.ToLower(language), rdf.RDFLangString), nil
+		}
+		return rdf.NewLiteral(value, "", nil), nil
+	case graphqlEnum:
+		return g.iri(string(value), true)
+	case bool:
+		return rdf.NewLiteral(strconv.FormatBool(value), "", rdf.NewNamedNode(ld.XSDBoolean)), nil
+	case int64:
+		return rdf.NewLiteral(strconv.FormatInt(value, 10), "", rdf.NewNamedNode(ld.XSDInteger)), nil
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1e21 {
+			return rdf.NewLiteral(strconv.FormatFloat(value, 'f', -1, 64), "", rdf.NewNamedNode(ld.XSDInteger)), nil
+		}
+		return rdf.NewLiteral(ld.GetCanonicalDouble(value), "", rdf.NewNamedNode(ld.XSDDouble)), nil
+	}
+	return nil, ErrInvalidGraphQL
+}
+
+// graphqlValues are the distinct values of a field, in the order that they were first solved
+type graphqlValues struct {
+	field  *graphqlField
+	keys   []string
+	values map[string]map[string]*graphqlValues
+}
+
+func newGraphQLValues(field *graphqlField) *graphqlValues {
+	return &graphqlValues{field: field, values: map[string]map[string]*graphqlValues{}}
+}
+
+// add collects the values of the field and its selections in the iterator's current solution,
+// ignoring new values once there are limit of them if limit is positive
+func (values *graphqlValues) add(iter *Iterator, limit int) {
+	term := iter.Get(values.field.term)
+	if term == nil {
+		return
+	}
+
+	key := term.String()
+	children, has := values.values[key]
+	if !has {
+		if limit > 0 && len(values.keys) >= limit {
+			return
+		}
+
+		children = make(map[string]*graphqlValues, len(values.field.selections))
+		for _, child := range values.field.selections {
+			children[child.alias] = newGraphQLValues(child)
+		}
+		values.keys = append(values.keys, key)
+		values.values[key] = children
+	}
+
+	for _, child := range values.field.selections {
+		if child.term != nil {
+			children[child.alias].add(iter, 0)
+		}
+	}
+}
+
+// data returns the values as they appear in the response, where fields with a single value
+// are that value unless they are top-level fields or have a @set or @list container
+func (values *graphqlValues) data(context *ld.Context, list bool) interface{} {
+	result := make([]interface{}, len(values.keys))
+	for i, key := range values.keys {
+		if values.field.selections == nil {
+			result[i] = graphqlScalar(key)
+			continue
+		}
+
+		object := make(map[string]interface{}, len(values.field.selections))
+		for _, child := range values.field.selections {
+			if child.name == "__typename" {
+				object[child.alias] = values.field.name
+				continue
+			}
+
+			set := context.HasContainerMapping(child.name, "@set") || context.HasContainerMapping(child.name, "@list")
+			object[child.alias] = values.values[key][child.alias].data(context, set)
+		}
+		result[i] = object
+	}
+
+	if len(result) == 1 && !list {
+		return result[0]
+	}
+	return result
+}
+
+// graphqlScalar returns the JSON value of a solved term: numbers and booleans for
+// literals with numeric and boolean datatypes, and the value of other terms
+func graphqlScalar(key string) interface{} {
+	term, err := rdf.ParseTerm(key)
+	if err != nil {
+		return nil
+	} else if literal, is := term.(*rdf.Literal); is {
+		switch value := ParseValue(literal); value.Kind {
+		case NumberValue:
+			return value.Number
+		case BooleanValue:
+			return value.Boolean
+		}
+	}
+	return term.Value()
+}
+
+// GraphQL runs a GraphQL query, and returns the data of its response
+func (s *Store) GraphQL(ctx context.Context, query string, variables map[string]interface{}) (map[string]interface{}, error) {
+	fields, err := parseGraphQL(query, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := ld.NewJsonLdOptions("")
+	opts.DocumentLoader = s.Config.DocumentLoader
+	terms := ld.NewContext(nil, opts)
+	if s.Config.GraphQLContext != nil {
+		terms, err = terms.Parse(s.Config.GraphQLContext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if strings.HasPrefix(field.name, "__") {
+			return nil, ErrUnsupportedGraphQL
+		}
+
+		data[field.alias], err = s.graphqlNodes(ctx, terms, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// graphqlNodes solves a top-level field and returns the list of its nodes
+func (s *Store) graphqlNodes(ctx context.Context, terms *ld.Context, field *graphqlField) (interface{}, error) {
+	limit := 0
+	if first, has := field.argument("first"); has {
+		switch first := first.(type) {
+		case int64:
+			limit = int(first)
+		case float64:
+			limit = int(first)
+		}
+		if limit <= 0 {
+			return nil, ErrInvalidGraphQL
+		}
+	}
+
+	g := &graphqlPattern{context: terms}
+	err := g.root(field)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &QueryOptions{}
+	if constants := constantQuads(g.pattern); len(constants) > 0 {
+		opts.Pipeline = []TransformerFactory{func() Transformer { return assertedFilter(constants) }}
+	}
+
+	iter, err := s.QueryContext(ctx, g.pattern, nil, nil, opts)
+	if err == ErrNotFound {
+		return []interface{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+
+	values := newGraphQLValues(field)
+	d, err := iter.Next(nil)
+	for ; d != nil; d, err = iter.Next(nil) {
+		values.add(iter, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return values.data(terms, true), nil
+}
+
+// constantQuads returns the quads of a pattern without variables or blank nodes
+func constantQuads(pattern []*rdf.Quad) []*rdf.Quad {
+	var constants []*rdf.Quad
+	for _, quad := range pattern {
+		if !isVariable(quad[0]) && !isVariable(quad[1]) && !isVariable(quad[2]) {
+			constants = append(constants, quad)
+		}
+	}
+	return constants
+}
+
+// assertedFilter drops every solution if one of the quads isn't in the store,
+// since solving a pattern doesn't check its quads without variables
+func assertedFilter(quads []*rdf.Quad) Transformer {
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		for _, quad := range quads {
+			statements, err := iter.getStatements([3]ID{iter.lookup(quad[0]), iter.lookup(quad[1]), iter.lookup(quad[2])})
+			if err != nil || len(statements) == 0 {
+				return nil
+			}
+		}
+		return index
+	})
+}
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+}
+
+type graphqlResponse struct {
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Errors []*graphqlError        `json:"errors,omitempty"`
+}
+
+// GraphQLHandler serves GraphQL queries over HTTP, as GET requests with "query" and
+// "variables" parameters, or POST requests with a JSON object with the same keys
+func (s *Store) GraphQLHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &graphqlRequest{}
+		if r.Method == http.MethodGet {
+			request.Query = r.URL.Query().Get("query")
+			if variables := r.URL.Query().Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+					w.WriteHeader(400)
+					w.Write([]byte(err.Error()))
+					return
+				}
+			}
+		} else if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		} else {
+			w.WriteHeader(405)
+			return
+		}
+
+		response := &graphqlResponse{}
+		data, err := s.GraphQL(r.Context(), request.Query, request.Variables)
+		if err != nil {
+			response.Errors = []*graphqlError{{err.Error()}}
+		} else {
+			response.Data = data
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		if err == ErrInvalidGraphQL || err == ErrUnsupportedGraphQL {
+			w.WriteHeader(400)
+		} else {
+			w.WriteHeader(200)
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
+
+// ServeGraphQL serves GraphQL queries at /graphql on the given port
+func (s *Store) ServeGraphQL(port string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", s.GraphQLHandler())
+	return http.ListenAndServe(":"+port, mux)
+}
@@ -0,0 +1,171 @@
+package styx
+
+import (
+	"fmt"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A TypeHint declares that a variable of a query only binds literals with the given datatype
+type TypeHint struct {
+	Variable rdf.Term
+	Datatype *rdf.NamedNode
+}
+
+// literalStart is the first byte of every literal's ID. Every other kind of ID starts
+// with a byte after it, so the literals of an index range are contiguous at its start.
+const literalStart ID = "\""
+
+// A literalRange is the set of literal IDs with one datatype, recognized by the suffix
+// that follows their quoted lexical value (or by a language tag for rdf:langString)
+type literalRange struct {
+	suffix   string
+	language bool
+}
+
+// newLiteralRange returns the literal range of a datatype, or nil if the dictionary
+// has never seen the datatype, so that no literal can have it
+func newLiteralRange(datatype *rdf.NamedNode, dictionary Dictionary) (*literalRange, error) {
+	if datatype.Equal(rdf.RDFLangString) {
+		return &literalRange{language: true}, nil
+	}
+
+	id, err := dictionary.GetID(rdf.NewLiteral("", "", datatype), rdf.Default)
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &literalRange{suffix: string(id[2:])}, nil
+}
+
+// contains reports whether a value is a literal at all; constraints narrowed to a
+// literal range are exhausted once they reach one that isn't
+func (r *literalRange) contains(value ID) bool {
+	return len(value) > 0 && value[:1] == literalStart
+}
+
+func (r *literalRange) match(value ID) bool {
+	quoted := patternLiteral.FindString(string(value))
+	if quoted == "" {
+		return false
+	}
+
+	suffix := string(value[len(quoted):])
+	if r.language {
+		return strings.HasPrefix(suffix, "@")
+	}
+	return suffix == r.suffix
+}
+
+// typeFilter returns a transformer that drops solutions binding a hinted variable to
+// anything other than a literal of its datatype. Queries push the hints into their
+// constraints instead, so this only checks solutions that were solved without them.
+func typeFilter(hints []TypeHint) Transformer {
+	var ranges []*literalRange
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		if ranges == nil {
+			ranges = make([]*literalRange, len(hints))
+			for i, hint := range hints {
+				ranges[i], _ = newLiteralRange(hint.Datatype, iter.dictionary)
+			}
+		}
+
+		for i, hint := range hints {
+			j, has := iter.ids[hint.Variable.String()]
+			if !has {
+				continue
+			} else if ranges[i] == nil || !ranges[i].match(iter.variables[j].value) {
+				return nil
+			}
+		}
+		return index
+	})
+}
+
+// A LanguageHint declares that a variable of a query only binds literals tagged with the
+// given language, or one of its subtags (so "en" matches "en-US")
+type LanguageHint struct {
+	Variable rdf.Term
+	Language string
+}
+
+// languageHintFilter returns a transformer that drops solutions binding a hinted variable
+// to anything other than a literal in its language. Queries intersect hinted variables
+// with the language index instead, so this only checks solutions solved without it.
+// Language tags are read from the IDs of the literals, so no values are resolved.
+func languageHintFilter(hints []LanguageHint) Transformer {
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		for _, hint := range hints {
+			i, has := iter.ids[hint.Variable.String()]
+			if !has {
+				continue
+			}
+
+			language, tagged := literalLanguage(iter.variables[i].value)
+			if !tagged || languageRank([]string{hint.Language}, language) != 0 {
+				return nil
+			}
+		}
+		return index
+	})
+}
+
+// generatedVariablePrefix starts the names of the variables that JSON-LD queries
+// generate for themselves. It's reserved: queries can't name their own variables with it.
+const generatedVariablePrefix = "styx:"
+
+// languageVariables replaces the value objects of a JSON-LD query that have a "@language"
+// but no "@value" with IRIs in the generated namespace, and returns a hint for each of them.
+// generatedVariables turns the IRIs into variables once the query is expanded.
+func languageVariables(query interface{}, namespace string, hints []LanguageHint) (interface{}, []LanguageHint) {
+	switch query := query.(type) {
+	case map[string]interface{}:
+		if language, is := query["@language"].(string); is && len(query) == 1 {
+			name := fmt.Sprintf("language%d", len(hints))
+			variable := rdf.NewVariable(generatedVariablePrefix + name)
+			hints = append(hints, LanguageHint{Variable: variable, Language: language})
+			return map[string]interface{}{"@id": namespace + name}, hints
+		}
+
+		result := make(map[string]interface{}, len(query))
+		for key, value := range query {
+			if key == "@context" {
+				result[key] = value
+			} else {
+				result[key], hints = languageVariables(value, namespace, hints)
+			}
+		}
+		return result, hints
+	case []interface{}:
+		result := make([]interface{}, len(query))
+		for i, value := range query {
+			result[i], hints = languageVariables(value, namespace, hints)
+		}
+		return result, hints
+	default:
+		return query, hints
+	}
+}
+
+// generatedVariables replaces the IRIs in the generated namespace of a query with
+// variables with reserved names, and fails if the query names a variable with one itself
+func generatedVariables(quads []*rdf.Quad, namespace string) error {
+	for _, quad := range quads {
+		for i, term := range quad {
+			switch term.TermType() {
+			case rdf.VariableType:
+				if strings.HasPrefix(term.Value(), generatedVariablePrefix) {
+					return ErrReservedVariable
+				}
+			case rdf.NamedNodeType:
+				if value := term.Value(); strings.HasPrefix(value, namespace) {
+					quad[i] = rdf.NewVariable(generatedVariablePrefix + value[len(namespace):])
+				}
+			}
+		}
+	}
+	return nil
+}
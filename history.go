@@ -0,0 +1,117 @@
+package styx
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// An Assertion is a period of time during which a dataset asserted a triple.
+// Retracted is zero if the dataset still asserts it.
+type Assertion struct {
+	Dataset   rdf.Term
+	Asserted  time.Time
+	Retracted time.Time
+}
+
+const (
+	historyAsserted  = byte('+')
+	historyRetracted = byte('-')
+)
+
+// historyPrefix returns the key prefix of the history of a triple
+func historyPrefix(subject, predicate, object rdf.Term) []byte {
+	return []byte(string(HistoryPrefix) + strings.Join([]string{subject.String(), predicate.String(), object.String(), ""}, "\t"))
+}
+
+// recordHistory records that a dataset replaced the previous triples with the next ones.
+// It must be called while holding the writer lock.
+func (s *Store) recordHistory(node rdf.Term, previous, next []*rdf.Quad) error {
+	now := make([]byte, 8)
+	binary.BigEndian.PutUint64(now, uint64(time.Now().UnixNano()))
+
+	triples := func(quads []*rdf.Quad) map[string]*rdf.Quad {
+		result := make(map[string]*rdf.Quad, len(quads))
+		for _, quad := range quads {
+			result[string(historyPrefix(quad[0], quad[1], quad[2]))] = quad
+		}
+		return result
+	}
+
+	before, after := triples(previous), triples(next)
+
+	wb := newWriteBatch(s.KV)
+	defer wb.Cancel()
+
+	for prefix, events := range map[byte][2]map[string]*rdf.Quad{
+		historyRetracted: {before, after},
+		historyAsserted:  {after, before},
+	} {
+		for key := range events[0] {
+			if _, has := events[1][key]; has {
+				continue
+			}
+			err := wb.Set(append(append([]byte(key), now...), node.String()...), []byte{prefix})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return wb.Flush()
+}
+
+// History returns the periods during which each dataset asserted the given triple,
+// ordered by when they started. History is only recorded while Config.History is set,
+// and retractions are only recorded if the store's QuadStore keeps datasets.
+func (s *Store) History(subject, predicate, object rdf.Term) ([]*Assertion, error) {
+	prefix := historyPrefix(subject, predicate, object)
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer iter.Close()
+
+	assertions := []*Assertion{}
+	open := map[string]*Assertion{}
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		item := iter.Item()
+		key := item.Key()[len(prefix):]
+		if len(key) < 8 {
+			return nil, ErrCorruptIndex
+		}
+
+		t := time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+		dataset := string(key[8:])
+
+		var event byte
+		err := item.Value(func(val []byte) error {
+			if len(val) != 1 {
+				return ErrCorruptIndex
+			}
+			event = val[0]
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if assertion, has := open[dataset]; has && event == historyRetracted {
+			assertion.Retracted = t
+			delete(open, dataset)
+		} else if !has && event == historyAsserted {
+			node, err := rdf.ParseTerm(dataset)
+			if err != nil {
+				return nil, err
+			}
+			assertion := &Assertion{Dataset: node, Asserted: t}
+			assertions = append(assertions, assertion)
+			open[dataset] = assertion
+		}
+	}
+
+	return assertions, nil
+}
@@ -0,0 +1,69 @@
+package styx
+
+import (
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// An IngestHook is called with every dataset before it is inserted, and returns the dataset
+// to insert in its place. Hooks can rewrite IRIs or strip quads, or return an error to reject
+// the dataset, in which case the error is returned from Set.
+type IngestHook func(node rdf.Term, dataset []*rdf.Quad) ([]*rdf.Quad, error)
+
+// A PostIngestHook is called with every dataset after it has been inserted and the
+// store's writer lock has been released, so it may write to the store itself
+type PostIngestHook func(node rdf.Term, dataset []*rdf.Quad)
+
+type ingestHooks struct {
+	pre  IngestHook
+	post PostIngestHook
+}
+
+// OnIngest registers hooks that run before and after datasets are inserted with Set,
+// Update, or Watch. Either hook can be nil. Hooks run in the order they were registered,
+// each receiving the dataset returned by the one before. The returned function removes them.
+func (s *Store) OnIngest(pre IngestHook, post PostIngestHook) func() {
+	hooks := &ingestHooks{pre, post}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hooks = append(s.hooks, hooks)
+
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		for i, h := range s.hooks {
+			if h == hooks {
+				s.hooks = append(s.hooks[:i:i], s.hooks[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// getHooks returns the registered hooks, so that they can be called without holding the lock
+func (s *Store) getHooks() []*ingestHooks {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.hooks
+}
+
+func (s *Store) preIngest(node rdf.Term, dataset []*rdf.Quad) (result []*rdf.Quad, err error) {
+	result = dataset
+	for _, hooks := range s.getHooks() {
+		if hooks.pre != nil {
+			result, err = hooks.pre(node, result)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
+func (s *Store) postIngest(node rdf.Term, dataset []*rdf.Quad) {
+	for _, hooks := range s.getHooks() {
+		if hooks.post != nil {
+			hooks.post(node, dataset)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package styx
+
+import (
+	lru "container/list"
+	"sync"
+)
+
+// IDCacheSize is the number of IRI IDs that an IRI dictionary factory keeps across transactions
+const IDCacheSize = 4096
+
+type idEntry struct {
+	value string
+	id    iri
+}
+
+// idCache is an LRU cache of committed IRI IDs shared by the dictionaries of a factory,
+// so that compiling a query doesn't need a Get for every term it has seen before.
+// The generation is incremented whenever IDs are removed or reassigned, so that
+// IDs read from older transactions aren't cached after that.
+type idCache struct {
+	sync.Mutex
+	generation uint64
+	order      *lru.List
+	entries    map[string]*lru.Element
+}
+
+func (c *idCache) current() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.generation
+}
+
+func (c *idCache) get(value string) (iri, bool) {
+	c.Lock()
+	defer c.Unlock()
+	element, has := c.entries[value]
+	if !has {
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*idEntry).id, true
+}
+
+// add caches an ID read in the given generation
+func (c *idCache) add(value string, id iri, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if generation != c.generation {
+		return
+	} else if c.entries == nil {
+		c.order, c.entries = lru.New(), map[string]*lru.Element{}
+	} else if element, has := c.entries[value]; has {
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[value] = c.order.PushFront(&idEntry{value, id})
+	if c.order.Len() > IDCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*idEntry).value)
+	}
+}
+
+func (c *idCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.order, c.entries = nil, nil
+}
+
+// clearIDCache drops the cached IDs of the store's dictionary after IDs were removed or reassigned
+func (s *Store) clearIDCache() {
+	if factory, is := s.Config.Dictionary.(*iriDictionaryFactory); is {
+		factory.cache.clear()
+	}
+}
@@ -0,0 +1,425 @@
+package styx
+
+import (
+	"context"
+
+	ld "github.com/piprate/json-gold/ld"
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const (
+	rdfsSubClassOf    = "http://www.w3.org/2000/01/rdf-schema#subClassOf"
+	rdfsSubPropertyOf = "http://www.w3.org/2000/01/rdf-schema#subPropertyOf"
+	rdfsDomain        = "http://www.w3.org/2000/01/rdf-schema#domain"
+	rdfsRange         = "http://www.w3.org/2000/01/rdf-schema#range"
+)
+
+// A relation maps terms to the terms they're related to,
+// like properties to their domains or classes to their super-classes
+type relation struct {
+	terms  map[string]rdf.Term
+	values map[string][]rdf.Term
+}
+
+func newRelation(pairs [][2]rdf.Term) *relation {
+	r := &relation{terms: map[string]rdf.Term{}, values: map[string][]rdf.Term{}}
+	for _, pair := range pairs {
+		key := pair[0].String()
+		r.terms[key] = pair[0]
+		r.values[key] = append(r.values[key], pair[1])
+	}
+	return r
+}
+
+// closure returns the transitive closure of the relation
+func (r *relation) closure() *relation {
+	c := &relation{terms: r.terms, values: make(map[string][]rdf.Term, len(r.values))}
+	for key := range r.values {
+		seen := map[string]bool{key: true}
+		stack := append([]rdf.Term{}, r.values[key]...)
+		for len(stack) > 0 {
+			term := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if value := term.String(); !seen[value] {
+				seen[value] = true
+				c.values[key] = append(c.values[key], term)
+				stack = append(stack, r.values[value]...)
+			}
+		}
+	}
+	return c
+}
+
+// entailments returns the datasets of entailed triples configured for the store
+func (s *Store) entailments() []rdf.Term {
+	graphs := make([]rdf.Term, 0, 2)
+	for _, graph := range []rdf.Term{s.Config.Inference, s.Config.SameAs} {
+		if graph != nil {
+			graphs = append(graphs, graph)
+		}
+	}
+	return graphs
+}
+
+// asserted returns the quads that match a single-quad pattern and that are asserted
+// by some dataset other than the excluded ones
+func (s *Store) asserted(ctx context.Context, pattern *rdf.Quad, exclude ...rdf.Term) ([]*rdf.Quad, error) {
+	iter, err := s.internalQuery(ctx, nil, []*rdf.Quad{pattern}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+
+	quads := []*rdf.Quad{}
+	d, err := iter.Next(nil)
+	for ; d != nil; d, err = iter.Next(nil) {
+		if len(exclude) > 0 {
+			sources, err := iter.Sources()
+			if err != nil {
+				return nil, err
+			} else if !assertedOutside(sources[0], exclude) {
+				continue
+			}
+		}
+		quads = append(quads, iter.Graph()...)
+	}
+
+	return quads, err
+}
+
+// assertedOutside reports whether any of the sources is outside the given datasets
+func assertedOutside(sources []*Source, datasets []rdf.Term) bool {
+	for _, source := range sources {
+		excluded := false
+		for _, dataset := range datasets {
+			excluded = excluded || source.Dataset.Equal(dataset)
+		}
+		if !excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// assertedOutside reports whether every quad of the current solution
+// is asserted by some dataset outside the given datasets
+func (iter *Iterator) assertedOutside(datasets []rdf.Term) (bool, error) {
+	if len(datasets) == 0 {
+		return true, nil
+	}
+
+	sources, err := iter.Sources()
+	if err != nil {
+		return false, err
+	}
+
+	for _, quad := range sources {
+		if !assertedOutside(quad, datasets) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// match returns the subjects and objects of the quads with the given predicate,
+// and with the given object unless it is nil, that aren't only entailed
+func (s *Store) match(ctx context.Context, predicate rdf.Term, object rdf.Term) ([][2]rdf.Term, error) {
+	subject := rdf.NewVariable("s")
+	if object == nil {
+		object = rdf.NewVariable("o")
+	}
+
+	quads, err := s.asserted(ctx, rdf.NewQuad(subject, predicate, object, rdf.Default), s.entailments()...)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([][2]rdf.Term, len(quads))
+	for i, quad := range quads {
+		pairs[i] = [2]rdf.Term{quad[0], quad[2]}
+	}
+	return pairs, nil
+}
+
+// entail updates the datasets of entailed triples configured for the store
+// after a write to a dataset replaced the removed quads with the added ones
+func (s *Store) entail(ctx context.Context, node rdf.Term, removed, added []*rdf.Quad) (err error) {
+	if s.Config.Inference != nil {
+		err = s.infer(ctx, node, removed, added)
+		if err != nil {
+			return
+		}
+	}
+
+	if s.Config.SameAs != nil {
+		err = s.smush(ctx, node, removed, added)
+	}
+
+	return
+}
+
+// A schema is the RDFS vocabulary asserted in the store
+type schema struct {
+	classes    *relation
+	properties *relation
+	domains    *relation
+	ranges     *relation
+}
+
+var schemaPredicates = map[string]bool{
+	rdfsSubClassOf:    true,
+	rdfsSubPropertyOf: true,
+	rdfsDomain:        true,
+	rdfsRange:         true,
+}
+
+func (s *Store) getSchema(ctx context.Context) (*schema, error) {
+	pairs := make(map[string][][2]rdf.Term, len(schemaPredicates))
+	for predicate := range schemaPredicates {
+		var err error
+		pairs[predicate], err = s.match(ctx, rdf.NewNamedNode(predicate), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &schema{
+		classes:    newRelation(pairs[rdfsSubClassOf]).closure(),
+		properties: newRelation(pairs[rdfsSubPropertyOf]).closure(),
+		domains:    newRelation(pairs[rdfsDomain]),
+		ranges:     newRelation(pairs[rdfsRange]),
+	}, nil
+}
+
+// entailer collects the quads entailed by a schema
+type entailer struct {
+	*schema
+	quads []*rdf.Quad
+}
+
+func (e *entailer) add(subject, predicate, object rdf.Term) {
+	e.quads = append(e.quads, rdf.NewQuad(subject, predicate, object, rdf.Default))
+}
+
+func (e *entailer) typeOf(node rdf.Term, class rdf.Term) {
+	rdfType := rdf.NewNamedNode(ld.RDFType)
+	e.add(node, rdfType, class)
+	for _, super := range e.classes.values[class.String()] {
+		e.add(node, rdfType, super)
+	}
+}
+
+// infer updates the dataset of RDFS entailments: the super-properties of every triple's
+// predicate, the super-classes of every typed node, and the classes implied by the domains
+// and ranges of every triple's predicate and its super-properties. Every entailment has
+// the subject or object of the triple it comes from as its subject, so only the entailments
+// of the nodes in the removed and added quads are re-computed, unless they change the schema.
+func (s *Store) infer(ctx context.Context, node rdf.Term, removed, added []*rdf.Quad) error {
+	previous, exists, err := s.readDataset(s.Config.Inference)
+	if err != nil {
+		return err
+	}
+
+	schema, err := s.getSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	e := &entailer{schema: schema}
+	delta := append(append([]*rdf.Quad{}, removed...), added...)
+	if !exists || changesSchema(delta) {
+		err = s.inferAll(ctx, e)
+		if err != nil {
+			return err
+		}
+	} else {
+		nodes, err := s.deltaNodes(node, delta)
+		if err != nil {
+			return err
+		}
+
+		for _, quad := range previous {
+			if _, has := nodes[quad[0].String()]; !has {
+				e.quads = append(e.quads, quad)
+			}
+		}
+
+		for _, n := range nodes {
+			err = s.inferNode(ctx, e, n)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.setEntailments(ctx, s.Config.Inference, previous, exists, e.quads)
+}
+
+// setEntailments replaces the previous quads of a dataset of entailed triples,
+// unless they're the same
+func (s *Store) setEntailments(ctx context.Context, graph rdf.Term, previous []*rdf.Quad, exists bool, quads []*rdf.Quad) error {
+	quads = sortQuads(quads)
+	if exists && equalQuads(sortQuads(previous), quads) {
+		return nil
+	}
+
+	err := retry(func() error { _, err := s.set(ctx, graph, quads, true, nil, true); return err })
+	if err != nil {
+		return err
+	}
+
+	s.results.invalidate(append(previous, quads...))
+	return nil
+}
+
+// inferAll computes the RDFS entailments of every triple in the store
+func (s *Store) inferAll(ctx context.Context, e *entailer) error {
+	visited := map[string]bool{}
+	for _, terms := range []map[string]rdf.Term{e.properties.terms, e.domains.terms, e.ranges.terms} {
+		for key, predicate := range terms {
+			if visited[key] || predicate.TermType() != rdf.NamedNodeType {
+				continue
+			}
+			visited[key] = true
+
+			pairs, err := s.match(ctx, predicate, nil)
+			if err != nil {
+				return err
+			}
+
+			supers := e.properties.values[key]
+			for _, pair := range pairs {
+				for _, super := range supers {
+					e.add(pair[0], super, pair[1])
+				}
+
+				for _, property := range append([]rdf.Term{predicate}, supers...) {
+					for _, class := range e.domains.values[property.String()] {
+						e.typeOf(pair[0], class)
+					}
+					if pair[1].TermType() != rdf.LiteralType {
+						for _, class := range e.ranges.values[property.String()] {
+							e.typeOf(pair[1], class)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	rdfType := rdf.NewNamedNode(ld.RDFType)
+	for key, class := range e.classes.terms {
+		pairs, err := s.match(ctx, rdfType, class)
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range pairs {
+			for _, super := range e.classes.values[key] {
+				e.add(pair[0], rdfType, super)
+			}
+		}
+	}
+
+	return nil
+}
+
+// inferNode computes the RDFS entailments whose subject is the given node,
+// from the triples that have the node as their subject or object
+func (s *Store) inferNode(ctx context.Context, e *entailer, node rdf.Term) error {
+	exclude := s.entailments()
+	p, o := rdf.NewVariable("p"), rdf.NewVariable("o")
+	outgoing, err := s.asserted(ctx, rdf.NewQuad(node, p, o, rdf.Default), exclude...)
+	if err != nil {
+		return err
+	}
+
+	incoming, err := s.asserted(ctx, rdf.NewQuad(o, p, node, rdf.Default), exclude...)
+	if err != nil {
+		return err
+	}
+
+	rdfType := rdf.NewNamedNode(ld.RDFType)
+	for _, quad := range outgoing {
+		supers := e.properties.values[quad[1].String()]
+		for _, super := range supers {
+			e.add(node, super, quad[2])
+		}
+
+		for _, property := range append([]rdf.Term{quad[1]}, supers...) {
+			for _, class := range e.domains.values[property.String()] {
+				e.typeOf(node, class)
+			}
+		}
+
+		if quad[1].Equal(rdfType) {
+			for _, super := range e.classes.values[quad[2].String()] {
+				e.add(node, rdfType, super)
+			}
+		}
+	}
+
+	for _, quad := range incoming {
+		for _, property := range append([]rdf.Term{quad[1]}, e.properties.values[quad[1].String()]...) {
+			for _, class := range e.ranges.values[property.String()] {
+				e.typeOf(node, class)
+			}
+		}
+	}
+
+	return nil
+}
+
+// changesSchema reports whether any of the quads has an RDFS schema predicate
+func changesSchema(quads []*rdf.Quad) bool {
+	for _, quad := range quads {
+		if quad[1].TermType() == rdf.NamedNodeType && schemaPredicates[quad[1].Value()] {
+			return true
+		}
+	}
+	return false
+}
+
+// deltaNodes returns the subjects and objects of the quads of a dataset that aren't
+// literals, named the way that queries return them
+func (s *Store) deltaNodes(node rdf.Term, quads []*rdf.Quad) (map[string]rdf.Term, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	nodes := map[string]rdf.Term{}
+	for _, quad := range quads {
+		for _, term := range []rdf.Term{quad[0], quad[2]} {
+			if term.TermType() == rdf.LiteralType {
+				continue
+			}
+
+			id, err := dictionary.GetID(term, node)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			t, err := dictionary.GetTerm(id, rdf.Default)
+			if err != nil {
+				return nil, err
+			}
+			nodes[t.String()] = t
+		}
+	}
+	return nodes, nil
+}
+
+// equalQuads compares two sorted slices of quads
+func equalQuads(a, b []*rdf.Quad) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, quad := range a {
+		if quad.String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
@@ -1,36 +1,55 @@
 package styx
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 	"text/tabwriter"
 
-	badger "github.com/dgraph-io/badger/v2"
 	rdf "github.com/underlay/go-rdfjs"
 )
 
 // An Iterator exposes Next and Seek operations
 type Iterator struct {
-	query      []*rdf.Quad
-	constants  []*constraint
-	variables  []*variable
-	domain     []rdf.Term
-	pivot      int
-	bot        bool
-	top        bool
-	empty      bool
-	ids        map[string]int
-	cache      []*vcache
-	blacklist  []bool
-	in         [][]int
-	out        [][]int
-	binary     binaryCache
-	unary      unaryCache
-	tag        TagScheme
-	txn        *badger.Txn
-	dictionary Dictionary
+	ctx         context.Context
+	query       []*rdf.Quad
+	constants   []*constraint
+	variables   []*variable
+	domain      []rdf.Term
+	pivot       int
+	bot         bool
+	top         bool
+	empty       bool
+	ids         map[string]int
+	cache       []*vcache
+	blacklist   []bool
+	in          [][]int
+	out         [][]int
+	binary      binaryCache
+	unary       unaryCache
+	tag         TagScheme
+	txn         KVTxn
+	dictionary  Dictionary
+	pipeline    []Transformer
+	redact      map[int]Redaction
+	sensitive   map[string]Redaction
+	redactBound [][2]int
+	cost        Cost
+	meter       Meter
+	cancel      context.CancelFunc
+	limit       int
+	offset      int
+	count       int
+	released    bool
+	results     [][]rdf.Term
+	source      solutionSource
+	position    int
+	solution    []rdf.Term
+	current     []rdf.Term
+	shared      bool
+	prefetch    int
 }
 
 // Collect calls Next(nil) on the iterator until there are no more solutions,
@@ -77,27 +96,29 @@ func (iter *Iterator) Log() {
 		values := make([]string, len(domain))
 		start := len(domain) - len(d)
 		for i, node := range d {
-			values[start+i] = node.String()
+			// Omitted and transformed-away values are nil
+			if node != nil {
+				values[start+i] = node.String()
+			}
 		}
 		fmt.Fprintln(w, strings.Join(values, "\t"))
 	}
 	_ = w.Flush()
 }
 
-// Graph returns a []*rdfjs.Quad representation of the iterator's current value
+// Graph returns a []*rdfjs.Quad representation of the iterator's current value.
+// Quads with omitted (redacted) terms are left out.
 func (iter *Iterator) Graph() []*rdf.Quad {
 	if iter.empty {
 		return nil
 	}
 
-	graph := make([]*rdf.Quad, len(iter.query))
-	for i, quad := range iter.query {
-		graph[i] = rdf.NewQuad(
-			iter.variate(quad[0]),
-			iter.variate(quad[1]),
-			iter.variate(quad[2]),
-			rdf.Default,
-		)
+	graph := make([]*rdf.Quad, 0, len(iter.query))
+	for _, quad := range iter.query {
+		s, p, o := iter.variate(quad[0]), iter.variate(quad[1]), iter.variate(quad[2])
+		if s != nil && p != nil && o != nil {
+			graph = append(graph, rdf.NewQuad(s, p, o, rdf.Default))
+		}
 	}
 	return graph
 }
@@ -115,26 +136,71 @@ func (iter *Iterator) variate(term rdf.Term) rdf.Term {
 
 // Prov returns a matrix of graph sources
 func (iter *Iterator) Prov() ([][]rdf.Term, error) {
-	ids := make([][]rdf.Term, len(iter.query))
+	sources, err := iter.Sources()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([][]rdf.Term, len(sources))
+	for i, quad := range sources {
+		if quad != nil {
+			ids[i] = make([]rdf.Term, len(quad))
+			for j, source := range quad {
+				ids[i][j] = source.Graph
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// Sources returns, for each quad of the pattern, the dataset quads that assert
+// it under the current solution. The datasets that justify the whole solution
+// are the ones that appear in the sources of every quad.
+func (iter *Iterator) Sources() ([][]*Source, error) {
+	if iter.results != nil {
+		return nil, ErrCachedResults
+	}
+
+	sources := make([][]*Source, len(iter.query))
 	for _, u := range iter.variables {
 		for _, c := range u.cs {
-			if ids[c.index] == nil &&
-				TernaryPrefixes[0] <= c.prefix[0] &&
-				c.prefix[0] <= TernaryPrefixes[2] {
+			if TernaryPrefixes[0] <= c.prefix[0] &&
+				c.prefix[0] <= TernaryPrefixes[2] &&
+				sources[c.index] == nil {
 				statements, err := c.Sources(u.value, iter.txn)
 				if err != nil {
 					return nil, err
 				}
 
-				ids[c.index] = make([]rdf.Term, len(statements))
-				for i, statement := range statements {
-					ids[c.index][i] = statement.Graph(iter.dictionary)
+				sources[c.index] = make([]*Source, 0, len(statements))
+				for _, statement := range statements {
+					if statement == nil {
+						continue
+					}
+
+					dataset, err := iter.dictionary.GetTerm(ID(statement.base), rdf.Default)
+					if err != nil {
+						return nil, err
+					}
+
+					signer, err := getSigner(ID(statement.base), iter.txn)
+					if err != nil {
+						return nil, err
+					}
+
+					sources[c.index] = append(sources[c.index], &Source{
+						Dataset: dataset,
+						Index:   statement.index,
+						Graph:   statement.Graph(iter.dictionary),
+						Signer:  signer,
+					})
 				}
 			}
 		}
 	}
 
-	return ids, nil
+	return sources, nil
 }
 
 // Get the value for a particular blank node
@@ -156,6 +222,16 @@ func (iter *Iterator) Get(node rdf.Term) rdf.Term {
 	i, has := iter.ids[value]
 	if !has {
 		return nil
+	} else if iter.results != nil {
+		if iter.solution == nil {
+			return nil
+		}
+		return iter.solution[i]
+	} else if len(iter.pipeline) > 0 {
+		if iter.current == nil {
+			return nil
+		}
+		return iter.current[i]
 	}
 
 	v := iter.variables[i]
@@ -163,8 +239,7 @@ func (iter *Iterator) Get(node rdf.Term) rdf.Term {
 		return nil
 	}
 
-	n, _ := iter.dictionary.GetTerm(v.value, rdf.Default)
-	return n
+	return iter.resolve(i, v.value)
 }
 
 // Domain returns the total ordering of variables used by the iterator
@@ -178,15 +253,36 @@ func (iter *Iterator) Domain() []rdf.Term {
 	return domain
 }
 
-// Index returns the iterator's current value as an ordered slice of ld.Nodes
+// Index returns the iterator's current value as an ordered slice of ld.Nodes.
+// If the iterator has a pipeline, this is the solution that the pipeline returned,
+// and it is nil until Next returns a solution.
 func (iter *Iterator) Index() []rdf.Term {
 	if iter.empty {
 		return nil
 	}
 
+	var solution []rdf.Term
+	if iter.results != nil {
+		solution = iter.solution
+	} else if len(iter.pipeline) > 0 {
+		solution = iter.current
+	} else {
+		return iter.resolveAll()
+	}
+
+	if solution == nil {
+		return nil
+	}
+	index := make([]rdf.Term, len(solution))
+	copy(index, solution)
+	return index
+}
+
+// resolveAll translates the values of every variable into terms, before the pipeline
+func (iter *Iterator) resolveAll() []rdf.Term {
 	index := make([]rdf.Term, len(iter.variables))
 	for i, v := range iter.variables {
-		index[i], _ = iter.dictionary.GetTerm(v.value, rdf.Default)
+		index[i] = iter.resolve(i, v.value)
 	}
 	return index
 }
@@ -196,11 +292,53 @@ func (iter *Iterator) Index() []rdf.Term {
 func (iter *Iterator) Next(node rdf.Term) ([]rdf.Term, error) {
 	if iter.top || iter.empty {
 		return nil, nil
+	} else if iter.results != nil {
+		return iter.replay(node)
+	}
+
+	if iter.limit > 0 && iter.count >= iter.limit {
+		iter.top = true
+		iter.release()
+		return nil, nil
+	}
+
+	min := iter.Len()
+
+	// The caller never sees skipped solutions,
+	// so the first one after them is returned in full.
+	for ; iter.offset > 0; iter.offset-- {
+		delta, err := iter.step(nil, min)
+		if delta == nil {
+			return nil, err
+		}
+		min, node = 0, nil
 	}
 
+	delta, err := iter.step(node, min)
+	if delta != nil {
+		iter.count++
+	}
+	return delta, err
+}
+
+// step advances the iterator to its next solution, returning
+// every value that changed at or after the index min
+func (iter *Iterator) step(node rdf.Term, min int) ([]rdf.Term, error) {
+	if iter.top {
+		return nil, nil
+	}
+
+	l := iter.Len()
+
 	if iter.bot {
 		iter.bot = false
-		return iter.Index(), nil
+		if index := iter.transform(iter.resolveAll()); index != nil {
+			iter.current = index
+			return index, nil
+		}
+		// The first solution was dropped by the pipeline,
+		// so the caller hasn't seen any values yet.
+		min = 0
 	}
 
 	i := iter.pivot - 1
@@ -214,34 +352,57 @@ func (iter *Iterator) Next(node rdf.Term) ([]rdf.Term, error) {
 		return nil, nil
 	}
 
-	tail, err := iter.next(i)
-	if err != nil {
-		return nil, err
-	}
+	for {
+		tail, err := iter.next(i)
+		if err != nil {
+			return nil, err
+		}
 
-	l := iter.Len()
-	if tail == l {
-		iter.top = true
-		return nil, nil
-	}
+		if tail == l {
+			iter.top = true
+			return nil, nil
+		}
 
-	result := make([]rdf.Term, l-tail)
-	for i, u := range iter.variables[tail:] {
-		result[i], _ = iter.dictionary.GetTerm(u.value, rdf.Default)
-	}
+		// Solutions dropped by the pipeline still advance the iterator,
+		// so we return every value that changed since the last solution.
+		if tail < min {
+			min = tail
+		}
 
-	return result, nil
+		if len(iter.pipeline) == 0 {
+			result := make([]rdf.Term, l-min)
+			for i, u := range iter.variables[min:] {
+				result[i] = iter.resolve(min+i, u.value)
+			}
+			return result, nil
+		}
+
+		if index := iter.transform(iter.resolveAll()); index != nil {
+			iter.current = index
+			return index[min:], nil
+		}
+	}
 }
 
 // Seek advances the iterator to the first result
 // greater than or equal to the given index path
 func (iter *Iterator) Seek(index []rdf.Term) (err error) {
-	if iter.empty {
+	if iter.empty || iter.released {
+		return
+	} else if iter.results != nil {
+		if len(index) > 0 {
+			return ErrCachedResults
+		}
+		iter.top, iter.position, iter.solution = false, 0, nil
+		if iter.source != nil {
+			iter.source.reset()
+		}
 		return
 	}
 
 	iter.bot = true
 	iter.top = false
+	iter.current = nil
 
 	terms := make([]ID, len(index))
 	for i, node := range index {
@@ -254,6 +415,13 @@ func (iter *Iterator) Seek(index []rdf.Term) (err error) {
 	l := iter.Len()
 	var ok bool
 
+	// Without an index, even the first variable can be advanced past a root
+	// that the other variables can't be satisfied with
+	min := 0
+	if len(terms) == 0 {
+		min = -1
+	}
+
 	for _, u := range iter.variables {
 		u.value = u.root
 	}
@@ -268,11 +436,10 @@ func (iter *Iterator) Seek(index []rdf.Term) (err error) {
 
 		if root != NIL {
 			for u.value = u.Seek(root); u.value == NIL; u.value = u.Seek(root) {
-				ok, err = iter.tick(i, 0, iter.cache)
-				if err != nil || !ok {
+				ok, err = iter.tick(i, min, iter.cache)
+				if err != nil {
 					return
-				}
-				if !ok {
+				} else if !ok {
 					iter.top = true
 					return
 				}
@@ -303,12 +470,19 @@ func (iter *Iterator) Seek(index []rdf.Term) (err error) {
 // Close the iterator
 func (iter *Iterator) Close() {
 	if iter != nil {
+		if iter.cancel != nil {
+			defer iter.cancel()
+		}
+		if iter.meter != nil {
+			iter.meter.Record(iter.ctx, iter.cost)
+			iter.meter = nil
+		}
 		if iter.variables != nil {
 			for _, u := range iter.variables {
 				u.Close()
 			}
 		}
-		if iter.txn != nil {
+		if iter.txn != nil && !iter.shared {
 			iter.txn.Discard()
 		}
 		if iter.dictionary != nil {
@@ -317,6 +491,18 @@ func (iter *Iterator) Close() {
 	}
 }
 
+// release closes the iterator's index iterators once no more solutions
+// will be read, without waiting for the caller to Close it
+func (iter *Iterator) release() {
+	if iter.released {
+		return
+	}
+	iter.released = true
+	for _, u := range iter.variables {
+		u.Close()
+	}
+}
+
 func (iter *Iterator) String() string {
 	s := "----- Constraint Graph -----\n"
 	for i, id := range iter.domain {
@@ -337,10 +523,8 @@ func (iter *Iterator) Swap(a, b int) {
 	iter.domain[a], iter.domain[b] = iter.domain[b], iter.domain[a]
 }
 
-// TODO: put more thought into the sorting heuristic.
-// Right now the variables are sorted their norm: in
-// increasing order of their length-normalized sum of
-// the squares of the counts of all their constraints (of any degree).
+// Less orders variables before blank nodes, and then by increasing score:
+// the count of their most selective constraint.
 func (iter *Iterator) Less(a, b int) bool {
 	// So pivot right now is the length of the provided domain.
 	// We keep those in order...
@@ -361,7 +545,7 @@ func (iter *Iterator) Less(a, b int) bool {
 	return A.score < B.score
 }
 
-func (iter *Iterator) insertDZ(u *variable, c *constraint, txn *badger.Txn) (err error) {
+func (iter *Iterator) insertDZ(u *variable, c *constraint, txn KVTxn) (err error) {
 	if u.cs == nil {
 		u.cs = constraintSet{c}
 	} else {
@@ -379,15 +563,12 @@ func (iter *Iterator) insertDZ(u *variable, c *constraint, txn *badger.Txn) (err
 	c.prefix = assembleKey(BinaryPrefixes[p], true, c.terms[p])
 
 	// Create a new badger.Iterator for the constraint
-	c.iterator = txn.NewIterator(badger.IteratorOptions{
-		PrefetchValues: false,
-		Prefix:         c.prefix,
-	})
+	c.iterator = iter.indexIterator(c.prefix, txn)
 
 	return
 }
 
-func (iter *Iterator) insertD1(u *variable, c *constraint, txn *badger.Txn) (err error) {
+func (iter *Iterator) insertD1(u *variable, c *constraint, txn KVTxn) (err error) {
 	if u.cs == nil {
 		u.cs = constraintSet{c}
 	} else {
@@ -406,15 +587,12 @@ func (iter *Iterator) insertD1(u *variable, c *constraint, txn *badger.Txn) (err
 	c.prefix = assembleKey(TernaryPrefixes[p], true, v, w)
 
 	// Create a new badger.Iterator for the constraint
-	c.iterator = txn.NewIterator(badger.IteratorOptions{
-		PrefetchValues: false,
-		Prefix:         c.prefix,
-	})
+	c.iterator = iter.indexIterator(c.prefix, txn)
 
 	return
 }
 
-func (iter *Iterator) insertD2(u, v *variable, c *constraint, txn *badger.Txn) (err error) {
+func (iter *Iterator) insertD2(u, v *variable, c *constraint, txn KVTxn) (err error) {
 	// For second-degree constraints we get the *count* with an index key
 	// and set the *prefix* to either a major or minor key
 
@@ -452,14 +630,21 @@ func (iter *Iterator) insertD2(u, v *variable, c *constraint, txn *badger.Txn) (
 	c.prefix = assembleKey(BinaryPrefixes[p], true, c.terms[p%3])
 
 	// Create a new badger.Iterator for the constraint
-	c.iterator = txn.NewIterator(badger.IteratorOptions{
-		PrefetchValues: false,
-		Prefix:         c.prefix,
-	})
+	c.iterator = iter.indexIterator(c.prefix, txn)
 
 	return
 }
 
+// indexIterator opens an iterator over an index prefix. Constraints only read keys
+// and counts, so values are prefetched only if the query asked for it.
+func (iter *Iterator) indexIterator(prefix []byte, txn KVTxn) KVIterator {
+	return txn.NewIterator(KVIteratorOptions{
+		PrefetchValues: iter.prefetch > 0,
+		PrefetchSize:   iter.prefetch,
+		Prefix:         prefix,
+	})
+}
+
 func (iter *Iterator) getIndex(u *variable) int {
 	for i, v := range iter.variables {
 		if u == v {
@@ -469,3 +654,83 @@ func (iter *Iterator) getIndex(u *variable) int {
 	log.Fatalln("Invalid variable index")
 	return -1
 }
+
+// order sorts the variables after the pivot greedily. Variables still come before blank
+// nodes, but at each position it prefers the remaining variables that are joined to one
+// already placed, so that each new variable is bound through a two-term index rather than
+// enumerated on its own, and only then the lowest score. After each pick the remaining
+// variables are re-scored, since the constraints joining them to the placed variables
+// will be solved with two-term keys. Like sort.Stable, it only uses Swap, so iter.ids
+// still has the original indices.
+func (iter *Iterator) order(txn KVTxn) error {
+	joined := func(u *variable, placed []*variable) bool {
+		i := iter.ids[u.node.String()]
+		for _, v := range placed {
+			if _, has := u.edges[iter.ids[v.node.String()]]; has {
+				return true
+			} else if _, has := v.edges[i]; has {
+				return true
+			}
+		}
+		return false
+	}
+
+	rank := func(u *variable, placed []*variable) [2]int {
+		r := [2]int{}
+		if u.node.TermType() == rdf.BlankNodeType {
+			r[0] = 1
+		}
+		if !joined(u, placed) {
+			r[1] = 1
+		}
+		return r
+	}
+
+	rescore := func(u *variable, placed []*variable) error {
+		bound := map[*constraint]bool{}
+		for _, v := range placed {
+			for _, c := range u.edges[iter.ids[v.node.String()]] {
+				bound[c] = true
+			}
+		}
+
+		u.score = 0
+		for _, c := range u.cs {
+			count := c.count
+			if bound[c] {
+				n, err := c.getJoinCount(iter.unary, txn)
+				if err != nil {
+					return err
+				}
+				count = n
+			}
+			if u.score == 0 || float64(count) < u.score {
+				u.score = float64(count)
+			}
+		}
+		return nil
+	}
+
+	for k := iter.pivot; k < iter.Len(); k++ {
+		placed := iter.variables[:k]
+		for j := k; j < iter.Len() && k > 0; j++ {
+			if err := rescore(iter.variables[j], placed); err != nil {
+				return err
+			}
+		}
+
+		best := k
+		bestRank := rank(iter.variables[k], placed)
+		for j := k + 1; j < iter.Len(); j++ {
+			r := rank(iter.variables[j], placed)
+			if r[0] < bestRank[0] || (r[0] == bestRank[0] && r[1] < bestRank[1]) ||
+				(r == bestRank && iter.variables[j].score < iter.variables[best].score) {
+				best, bestRank = j, r
+			}
+		}
+		for j := best; j > k; j-- {
+			iter.Swap(j, j-1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package styx
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// A KV is an ordered key/value store with snapshot transactions, which a Store keeps its
+// dictionary, indices, and metadata in. Badger is the default, through BadgerKV, and other
+// stores can be used with NewStoreKV. Backups, snapshots, compaction, and value log garbage
+// collection are specific to badger, and fail with ErrUnsupportedBackend for other stores.
+//
+// A KV can also have a NewWriteBatch() KVWriteBatch method for writing many keys without
+// reading them, which is otherwise done in ordinary transactions.
+type KV interface {
+	// NewTransaction opens a transaction that reads from a consistent snapshot
+	// of the store, and that can write if update is true
+	NewTransaction(update bool) KVTxn
+	Close() error
+}
+
+// A KVTxn is a transaction of a KV. Get returns ErrKeyNotFound for keys that aren't set,
+// Set and Delete return ErrTxnTooBig when the transaction can't hold any more writes,
+// and Commit returns ErrConflict if another transaction wrote a key that this one read.
+//
+// Transactions that also have a SetWithTTL(key, val []byte, ttl time.Duration) error
+// method are used to expire registered queries after Config.QueryTTL.
+type KVTxn interface {
+	Get(key []byte) (KVItem, error)
+	Set(key, val []byte) error
+	Delete(key []byte) error
+	NewIterator(opts KVIteratorOptions) KVIterator
+	Commit() error
+	Discard()
+}
+
+// A KVItem is a key and its value. Its key and value are only
+// valid until the iterator that returned it is moved.
+type KVItem interface {
+	Key() []byte
+	KeyCopy(dst []byte) []byte
+	Value(fn func(val []byte) error) error
+	ValueCopy(dst []byte) ([]byte, error)
+	EstimatedSize() int64
+}
+
+// A KVIterator iterates over the keys of a transaction in order, or in reverse order.
+// Seek moves to the first key at or after the given key, or at or before it in reverse.
+type KVIterator interface {
+	Rewind()
+	Seek(key []byte)
+	Valid() bool
+	ValidForPrefix(prefix []byte) bool
+	Next()
+	Item() KVItem
+	Close()
+}
+
+// KVIteratorOptions are the options of a KVIterator. Iterators only visit keys with the
+// Prefix, and PrefetchValues hints that the values will be read, PrefetchSize at a time.
+type KVIteratorOptions struct {
+	PrefetchValues bool
+	PrefetchSize   int
+	Reverse        bool
+	Prefix         []byte
+}
+
+// A KVWriteBatch writes keys without reading them, committing as often as it needs to
+type KVWriteBatch interface {
+	Set(key, val []byte) error
+	Delete(key []byte) error
+	Flush() error
+	Cancel()
+}
+
+// BadgerKV returns the KV of a badger database
+func BadgerKV(db *badger.DB) KV { return badgerKV{db} }
+
+type badgerKV struct{ db *badger.DB }
+
+func (kv badgerKV) NewTransaction(update bool) KVTxn { return badgerTxn{kv.db.NewTransaction(update)} }
+func (kv badgerKV) Close() error                     { return kv.db.Close() }
+func (kv badgerKV) NewWriteBatch() KVWriteBatch      { return kv.db.NewWriteBatch() }
+
+type badgerTxn struct{ *badger.Txn }
+
+func (txn badgerTxn) Get(key []byte) (KVItem, error) {
+	item, err := txn.Txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (txn badgerTxn) NewIterator(opts KVIteratorOptions) KVIterator {
+	return badgerIterator{txn.Txn.NewIterator(badger.IteratorOptions{
+		PrefetchValues: opts.PrefetchValues,
+		PrefetchSize:   opts.PrefetchSize,
+		Reverse:        opts.Reverse,
+		Prefix:         opts.Prefix,
+	})}
+}
+
+func (txn badgerTxn) SetWithTTL(key, val []byte, ttl time.Duration) error {
+	return txn.SetEntry(badger.NewEntry(key, val).WithTTL(ttl))
+}
+
+type badgerIterator struct{ *badger.Iterator }
+
+func (iter badgerIterator) Item() KVItem { return iter.Iterator.Item() }
+
+// viewTxn runs f in a read-only transaction
+func viewTxn(kv KV, f func(txn KVTxn) error) error {
+	txn := kv.NewTransaction(false)
+	defer txn.Discard()
+	return f(txn)
+}
+
+// updateTxn runs f in a transaction and commits it if f succeeds
+func updateTxn(kv KV, f func(txn KVTxn) error) error {
+	txn := kv.NewTransaction(true)
+	defer txn.Discard()
+	if err := f(txn); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// newWriteBatch returns the store's write batch if it has one, or else
+// a batch that writes in transactions that are committed whenever they fill up
+func newWriteBatch(kv KV) KVWriteBatch {
+	if batcher, is := kv.(interface{ NewWriteBatch() KVWriteBatch }); is {
+		return batcher.NewWriteBatch()
+	}
+	return &txnBatch{kv: kv, txn: kv.NewTransaction(true)}
+}
+
+type txnBatch struct {
+	kv  KV
+	txn KVTxn
+}
+
+func (b *txnBatch) Set(key, val []byte) (err error) {
+	b.txn, err = setSafe(key, val, b.txn, b.kv)
+	return
+}
+
+func (b *txnBatch) Delete(key []byte) (err error) {
+	b.txn, err = deleteSafe(key, b.txn, b.kv)
+	return
+}
+
+func (b *txnBatch) Flush() error { return b.txn.Commit() }
+func (b *txnBatch) Cancel()      { b.txn.Discard() }
+
+// A sequence leases blocks of IDs from a counter key, like a badger.Sequence,
+// whose format it shares. The key holds the end of the current lease.
+type sequence struct {
+	sync.Mutex
+	kv        KV
+	key       []byte
+	next      uint64
+	leased    uint64
+	bandwidth uint64
+}
+
+func getSequence(kv KV, key []byte, bandwidth uint64) (*sequence, error) {
+	seq := &sequence{kv: kv, key: key, bandwidth: bandwidth}
+	return seq, seq.updateLease()
+}
+
+func (seq *sequence) updateLease() error {
+	var next uint64
+	err := updateTxn(seq.kv, func(txn KVTxn) error {
+		item, err := txn.Get(seq.key)
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				if len(val) != 8 {
+					return ErrCorruptIndex
+				}
+				next = binary.BigEndian.Uint64(val)
+				return nil
+			})
+		} else if err == ErrKeyNotFound {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		return txn.Set(seq.key, counterValue(next+seq.bandwidth))
+	})
+	if err != nil {
+		return err
+	}
+	seq.next, seq.leased = next, next+seq.bandwidth
+	return nil
+}
+
+// Next returns the next ID, leasing another block if the current one is used up
+func (seq *sequence) Next() (uint64, error) {
+	seq.Lock()
+	defer seq.Unlock()
+	if seq.next >= seq.leased {
+		if err := seq.updateLease(); err != nil {
+			return 0, err
+		}
+	}
+	n := seq.next
+	seq.next++
+	return n, nil
+}
+
+// Release returns the unused IDs of the current lease. The sequence can still be used
+// afterwards, which leases a new block.
+func (seq *sequence) Release() error {
+	seq.Lock()
+	defer seq.Unlock()
+	err := updateTxn(seq.kv, func(txn KVTxn) error { return txn.Set(seq.key, counterValue(seq.next)) })
+	if err != nil {
+		return err
+	}
+	seq.leased = seq.next
+	return nil
+}
+
+func counterValue(n uint64) []byte {
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, n)
+	return val
+}
@@ -0,0 +1,225 @@
+package styx
+
+import (
+	"encoding/binary"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// literalLanguage returns the language tag of a language-tagged literal ID
+func literalLanguage(id ID) (string, bool) {
+	s := string(id)
+	li := patternLiteral.FindStringIndex(s)
+	if li == nil || li[0] != 0 || len(s) == li[1] || s[li[1]] != '@' {
+		return "", false
+	}
+	return s[li[1]+1:], true
+}
+
+// languageRank returns the index of the first preference that matches the language tag,
+// either exactly or as a primary subtag (so "en" matches "en-US"), or len(languages).
+func languageRank(languages []string, language string) int {
+	language = strings.ToLower(language)
+	for i, preference := range languages {
+		preference = strings.ToLower(preference)
+		if language == preference || strings.HasPrefix(language, preference+"-") {
+			return i
+		}
+	}
+	return len(languages)
+}
+
+// languageFilter returns a transformer that drops solutions that bind a language-tagged
+// literal when the same subject and predicate also have a literal in a preferred language.
+func languageFilter(languages []string) Transformer {
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		for _, quad := range iter.query {
+			i, has := iter.ids[quad[2].String()]
+			if !has {
+				continue
+			}
+
+			language, tagged := literalLanguage(iter.variables[i].value)
+			if !tagged {
+				continue
+			}
+
+			rank := languageRank(languages, language)
+			if rank == 0 {
+				continue
+			}
+
+			s, p := iter.lookup(quad[0]), iter.lookup(quad[1])
+			if s == NIL || p == NIL {
+				continue
+			}
+
+			if iter.preferred(s, p, languages, rank) {
+				return nil
+			}
+		}
+		return index
+	})
+}
+
+// preferred reports whether the subject and predicate have any literal
+// object with a language ranked better than the given rank.
+func (iter *Iterator) preferred(s, p ID, languages []string, rank int) bool {
+	prefix := assembleKey(TernaryPrefixes[0], true, s, p)
+	i := iter.txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	defer i.Close()
+
+	for i.Seek(prefix); i.ValidForPrefix(prefix); i.Next() {
+		o := ID(i.Item().Key()[len(prefix):])
+		if language, tagged := literalLanguage(o); tagged && languageRank(languages, language) < rank {
+			return true
+		}
+	}
+	return false
+}
+
+// languageTags returns the lowercase language tag and each of its prefixes that ends
+// at a subtag, so that literals tagged "en-US" are indexed under "en" and "en-us"
+func languageTags(language string) []string {
+	language = strings.ToLower(language)
+	tags := []string{}
+	for i := range language {
+		if language[i] == '-' {
+			tags = append(tags, language[:i])
+		}
+	}
+	return append(tags, language)
+}
+
+// languageCounts counts the quads that have each language-tagged literal as their
+// object, by the keys of the literal in the language index
+func languageCounts(quads [][4]ID) map[string]uint32 {
+	counts := map[string]uint32{}
+	for _, quad := range quads {
+		if language, tagged := literalLanguage(quad[2]); tagged {
+			for _, tag := range languageTags(language) {
+				counts[string(assembleKey(LanguagePrefix, false, ID(tag), quad[2]))]++
+			}
+		}
+	}
+	return counts
+}
+
+// languageEntries returns the language index of a dataset: the number of quads that
+// have each literal as their object, and the number of distinct literals in each tag
+func languageEntries(quads [][4]ID) map[string][]byte {
+	counts := languageCounts(quads)
+	tags := map[string]uint32{}
+	entries := make(map[string][]byte, len(counts))
+	for key, count := range counts {
+		entries[key] = languageCount(count)
+		tags[key[:strings.IndexByte(key, '\t')]]++
+	}
+	for key, count := range tags {
+		entries[key] = languageCount(count)
+	}
+	return entries
+}
+
+func languageCount(count uint32) []byte {
+	val := make([]byte, 4)
+	binary.BigEndian.PutUint32(val, count)
+	return val
+}
+
+// getLanguageCount returns the count stored at a key of the language index, or zero
+func getLanguageCount(key []byte, txn KVTxn) (count uint32, err error) {
+	item, err := txn.Get(key)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return
+	}
+
+	err = item.Value(func(val []byte) error {
+		if len(val) != 4 {
+			return ErrCorruptIndex
+		}
+		count = binary.BigEndian.Uint32(val)
+		return nil
+	})
+	return
+}
+
+// setLanguageCount writes a count to a key of the language index, or deletes the key if it's zero
+func setLanguageCount(key []byte, count uint32, txn KVTxn, db KV) (KVTxn, error) {
+	if count == 0 {
+		return deleteSafe(key, txn, db)
+	}
+	return setSafe(key, languageCount(count), txn, db)
+}
+
+// indexLanguages adds the language-tagged literals of a dataset to the language index,
+// or removes them. Literals are counted by the quads that use them, and are only
+// removed from the index once no dataset uses them.
+func indexLanguages(quads [][4]ID, remove bool, t KVTxn, db KV) (txn KVTxn, err error) {
+	txn = t
+	tags := map[string]int64{}
+	for key, n := range languageCounts(quads) {
+		var previous uint32
+		previous, err = getLanguageCount([]byte(key), txn)
+		if err != nil {
+			return
+		}
+
+		count := previous + n
+		if remove {
+			count = 0
+			if n < previous {
+				count = previous - n
+			}
+		}
+
+		txn, err = setLanguageCount([]byte(key), count, txn, db)
+		if err != nil {
+			return
+		}
+
+		tag := key[:strings.IndexByte(key, '\t')]
+		if previous == 0 && count > 0 {
+			tags[tag]++
+		} else if previous > 0 && count == 0 {
+			tags[tag]--
+		}
+	}
+
+	for tag, delta := range tags {
+		var count uint32
+		count, err = getLanguageCount([]byte(tag), txn)
+		if err != nil {
+			return
+		}
+
+		next := int64(count) + delta
+		if next < 0 {
+			next = 0
+		}
+
+		txn, err = setLanguageCount([]byte(tag), uint32(next), txn, db)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// languageConstraint returns a constraint over the literals in the language index with
+// the hint's language tag, for intersecting with the other constraints of its variable
+func (iter *Iterator) languageConstraint(hint LanguageHint, txn KVTxn) (c *constraint, err error) {
+	tag := ID(strings.ToLower(hint.Language))
+	c = &constraint{index: -1, place: 2, cost: &iter.cost}
+	c.count, err = getLanguageCount(assembleKey(LanguagePrefix, false, tag), txn)
+	if err != nil || c.count == 0 {
+		return
+	}
+
+	c.prefix = assembleKey(LanguagePrefix, true, tag)
+	c.iterator = iter.indexIterator(c.prefix, txn)
+	return
+}
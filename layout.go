@@ -0,0 +1,326 @@
+package styx
+
+import (
+	"bytes"
+	"time"
+)
+
+// A KeyLayout is the encoding of the keys of the ternary, binary, and unary indices.
+// A store keeps the layout it was created with, which is saved at LayoutKey.
+type KeyLayout byte
+
+const (
+	// TabKeyLayout is the default layout, which separates the IDs of index keys with tabs
+	TabKeyLayout KeyLayout = iota
+	// VarintKeyLayout stores the base64 IDs of an IRI dictionary as varints of their
+	// uint64 values, and elides the prefix that the middle ID of each ternary key shares
+	// with the first. Other terms, like literals, are escaped and terminated instead.
+	VarintKeyLayout
+)
+
+// Terms in the varint layout start with a tag byte. Escaped terms sort before varints,
+// so the literals of an index range are still at its start.
+const (
+	layoutEscaped  byte = 0x01
+	layoutVarint   byte = 0x02 // Varints of n bytes are tagged layoutVarint + n - 1
+	layoutFragment byte = 0x0A // Varints of n bytes with an escaped fragment are tagged layoutFragment + n - 1
+)
+
+// openLayout returns the KV of a store's indices in the layout saved at LayoutKey, and
+// the layout. The given layout is saved if the store doesn't have one and is still empty,
+// and stores that already have data in the default layout fail with ErrKeyLayout.
+func openLayout(kv KV, layout KeyLayout) (KV, KeyLayout, error) {
+	saved, err := getLayout(kv)
+	if err != nil {
+		return nil, saved, err
+	} else if saved == layout || layout == TabKeyLayout {
+		return withLayout(kv, saved), saved, nil
+	}
+
+	err = updateTxn(kv, func(txn KVTxn) error {
+		if !isEmpty(txn) {
+			return ErrKeyLayout
+		}
+		return txn.Set(LayoutKey, []byte{byte(layout)})
+	})
+	if err != nil {
+		return nil, saved, err
+	}
+	return withLayout(kv, layout), layout, nil
+}
+
+// getLayout returns the layout saved at LayoutKey, or TabKeyLayout if there isn't one
+func getLayout(kv KV) (layout KeyLayout, err error) {
+	err = viewTxn(kv, func(txn KVTxn) error {
+		item, err := txn.Get(LayoutKey)
+		if err == ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			if len(val) != 1 || KeyLayout(val[0]) > VarintKeyLayout {
+				return ErrKeyLayout
+			}
+			layout = KeyLayout(val[0])
+			return nil
+		})
+	})
+	return
+}
+
+func withLayout(kv KV, layout KeyLayout) KV {
+	if layout == VarintKeyLayout {
+		return varintKV{kv}
+	}
+	return kv
+}
+
+// isIndexKey reports whether a key is in the ternary, binary, or unary indices
+func isIndexKey(key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	p := key[0]
+	return p == UnaryPrefix ||
+		TernaryPrefixes[0] <= p && p <= TernaryPrefixes[2] ||
+		BinaryPrefixes[0] <= p && p <= BinaryPrefixes[5]
+}
+
+// encodeKey translates an index key (or a prefix of one) into the varint layout.
+// The middle ID of a ternary key is the only one that is followed by another and
+// preceded by another, and it's stored as the length of the prefix it shares with the
+// first (up to 255 bytes) and the rest of its encoding. The last ID is never elided,
+// so that every index range is in the same order.
+func encodeKey(key []byte) []byte {
+	if !isIndexKey(key) {
+		return key
+	}
+
+	terms := bytes.Split(key[1:], []byte{'\t'})
+	result := make([]byte, 1, len(key)+2*len(terms))
+	result[0] = key[0]
+
+	var previous []byte
+	for i, term := range terms {
+		last := i == len(terms)-1
+		if last && len(term) == 0 {
+			break
+		}
+
+		encoded := encodeTerm(term)
+		if i > 0 && !last {
+			n := 0
+			for n < 255 && n < len(previous) && n < len(encoded) && previous[n] == encoded[n] {
+				n++
+			}
+			result = append(append(result, byte(n)), encoded[n:]...)
+		} else {
+			result = append(result, encoded...)
+		}
+		previous = encoded
+	}
+	return result
+}
+
+// encodeTerm encodes the IDs of an IRI dictionary, and the IDs of blank nodes and tagged
+// IRIs that are an ID and a fragment, as varints. Other terms are escaped.
+func encodeTerm(term []byte) []byte {
+	id, fragment, tag := term, []byte(nil), layoutVarint
+	if i := bytes.IndexByte(term, '#'); i != -1 {
+		id, fragment, tag = term[:i], term[i+1:], layoutFragment
+	}
+
+	if len(id) == 4 || len(id) == 8 {
+		if n, err := toUint64(iri(id)); err == nil && n < max8Byte && fromUint64(n) == iri(id) {
+			size := 1
+			for n>>(8*size) > 0 {
+				size++
+			}
+
+			encoded := make([]byte, 1+size, 1+size+len(fragment)+2)
+			encoded[0] = tag + byte(size-1)
+			for i := size; i > 0; i-- {
+				encoded[i] = byte(n)
+				n >>= 8
+			}
+
+			if tag == layoutFragment {
+				return appendEscaped(encoded, fragment)
+			}
+			return encoded
+		}
+	}
+
+	return appendEscaped([]byte{layoutEscaped}, term)
+}
+
+// appendEscaped appends bytes that are terminated by 0x00 0x01, with 0x00 escaped as 0x00 0xFF
+func appendEscaped(encoded, value []byte) []byte {
+	for _, b := range value {
+		if b == 0x00 {
+			encoded = append(encoded, 0x00, 0xFF)
+		} else {
+			encoded = append(encoded, b)
+		}
+	}
+	return append(encoded, 0x00, 0x01)
+}
+
+// readEscaped reads escaped bytes from the start of the encoded bytes, and returns their size
+func readEscaped(encoded []byte) ([]byte, int, error) {
+	value := []byte{}
+	for i := 0; i+1 < len(encoded); i++ {
+		if encoded[i] != 0x00 {
+			value = append(value, encoded[i])
+		} else if encoded[i+1] == 0xFF {
+			value = append(value, 0x00)
+			i++
+		} else if encoded[i+1] == 0x01 {
+			return value, i + 2, nil
+		} else {
+			break
+		}
+	}
+	return nil, 0, ErrCorruptIndex
+}
+
+// decodeKey translates a key in the varint layout back into the tab layout
+func decodeKey(key []byte) ([]byte, error) {
+	if !isIndexKey(key) {
+		return key, nil
+	}
+
+	result := make([]byte, 1, 2*len(key))
+	result[0] = key[0]
+
+	var previous []byte
+	for i, rest := 0, key[1:]; len(rest) > 0; i++ {
+		if i > 0 {
+			result = append(result, '\t')
+		}
+
+		// Only the middle ID of a ternary key is elided
+		if i == 1 && TernaryPrefixes[0] <= key[0] && key[0] <= TernaryPrefixes[2] {
+			shared := int(rest[0])
+			if shared > len(previous) {
+				return nil, ErrCorruptIndex
+			}
+			rest = append(previous[:shared:shared], rest[1:]...)
+		}
+
+		term, size, err := decodeTerm(rest)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, term...)
+		previous, rest = rest[:size], rest[size:]
+	}
+	return result, nil
+}
+
+// decodeTerm decodes the term at the start of the encoded bytes, and returns its size
+func decodeTerm(encoded []byte) ([]byte, int, error) {
+	tag := encoded[0]
+	if tag == layoutEscaped {
+		term, size, err := readEscaped(encoded[1:])
+		return term, 1 + size, err
+	} else if tag < layoutVarint || tag >= layoutFragment+8 {
+		return nil, 0, ErrCorruptIndex
+	}
+
+	size := 1 + int(tag-layoutVarint)
+	if tag >= layoutFragment {
+		size = 1 + int(tag-layoutFragment)
+	}
+	if len(encoded) < 1+size {
+		return nil, 0, ErrCorruptIndex
+	}
+
+	var n uint64
+	for _, b := range encoded[1 : 1+size] {
+		n = n<<8 | uint64(b)
+	}
+
+	term := []byte(fromUint64(n))
+	if tag < layoutFragment {
+		return term, 1 + size, nil
+	}
+
+	fragment, length, err := readEscaped(encoded[1+size:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(append(term, '#'), fragment...), 1 + size + length, nil
+}
+
+// varintKV translates the index keys of a KV into the varint layout
+type varintKV struct{ KV }
+
+func (kv varintKV) NewTransaction(update bool) KVTxn {
+	return varintTxn{kv.KV.NewTransaction(update)}
+}
+
+func (kv varintKV) NewWriteBatch() KVWriteBatch { return varintBatch{newWriteBatch(kv.KV)} }
+
+type varintTxn struct{ KVTxn }
+
+func (txn varintTxn) Get(key []byte) (KVItem, error) {
+	item, err := txn.KVTxn.Get(encodeKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return varintItem{item}, nil
+}
+
+func (txn varintTxn) Set(key, val []byte) error { return txn.KVTxn.Set(encodeKey(key), val) }
+func (txn varintTxn) Delete(key []byte) error   { return txn.KVTxn.Delete(encodeKey(key)) }
+
+// SetWithTTL falls back to Set for KVs whose transactions can't expire keys
+func (txn varintTxn) SetWithTTL(key, val []byte, ttl time.Duration) error {
+	if expiring, is := txn.KVTxn.(interface {
+		SetWithTTL(key, val []byte, ttl time.Duration) error
+	}); is {
+		return expiring.SetWithTTL(encodeKey(key), val, ttl)
+	}
+	return txn.Set(key, val)
+}
+
+func (txn varintTxn) NewIterator(opts KVIteratorOptions) KVIterator {
+	opts.Prefix = encodeKey(opts.Prefix)
+	return &varintIterator{KVIterator: txn.KVTxn.NewIterator(opts)}
+}
+
+type varintIterator struct {
+	KVIterator
+	prefix, encoded []byte // The last prefix passed to ValidForPrefix, and its encoding
+}
+
+func (iter *varintIterator) Seek(key []byte) { iter.KVIterator.Seek(encodeKey(key)) }
+func (iter *varintIterator) Item() KVItem    { return varintItem{iter.KVIterator.Item()} }
+
+func (iter *varintIterator) ValidForPrefix(prefix []byte) bool {
+	if iter.encoded == nil || !bytes.Equal(prefix, iter.prefix) {
+		iter.prefix, iter.encoded = append(iter.prefix[:0], prefix...), encodeKey(prefix)
+	}
+	return iter.KVIterator.ValidForPrefix(iter.encoded)
+}
+
+// varintItem decodes the key of an item. Keys that can't be decoded are returned as they are.
+type varintItem struct{ KVItem }
+
+func (item varintItem) Key() []byte {
+	key, err := decodeKey(item.KVItem.Key())
+	if err != nil {
+		return item.KVItem.Key()
+	}
+	return key
+}
+
+func (item varintItem) KeyCopy(dst []byte) []byte { return append(dst[:0], item.Key()...) }
+
+type varintBatch struct{ KVWriteBatch }
+
+func (b varintBatch) Set(key, val []byte) error { return b.KVWriteBatch.Set(encodeKey(key), val) }
+func (b varintBatch) Delete(key []byte) error   { return b.KVWriteBatch.Delete(encodeKey(key)) }
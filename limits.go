@@ -0,0 +1,37 @@
+package styx
+
+import rdf "github.com/underlay/go-rdfjs"
+
+// Limits bound the shape of query patterns, to protect shared stores from
+// adversarial queries. Zero values are unlimited.
+type Limits struct {
+	MaxQuads     int // The number of quads in a pattern
+	MaxVariables int // The number of distinct variables and blank nodes in a pattern
+}
+
+// check returns ErrQueryTooComplex if the pattern exceeds the limits
+func (limits *Limits) check(pattern []*rdf.Quad) error {
+	if limits == nil {
+		return nil
+	}
+
+	if limits.MaxQuads > 0 && len(pattern) > limits.MaxQuads {
+		return ErrQueryTooComplex
+	}
+
+	if limits.MaxVariables > 0 {
+		variables := map[string]bool{}
+		for _, quad := range pattern {
+			for _, term := range quad[:3] {
+				if t := term.TermType(); t == rdf.VariableType || t == rdf.BlankNodeType {
+					variables[term.String()] = true
+				}
+			}
+		}
+		if len(variables) > limits.MaxVariables {
+			return ErrQueryTooComplex
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	ld "github.com/piprate/json-gold/ld"
+)
+
+// jsonldOptions returns JSON-LD options that load remote documents with the store's DocumentLoader
+func (s *Store) jsonldOptions(base string) *ld.JsonLdOptions {
+	opts := ld.NewJsonLdOptions(base)
+	opts.DocumentLoader = s.Config.DocumentLoader
+	return opts
+}
+
+// A DIDLoader is a document loader that resolves did:key and did:web URIs to their DID
+// documents, and loads every other URL with the next loader
+type DIDLoader struct {
+	Next   ld.DocumentLoader
+	Client *http.Client
+}
+
+// NewDIDLoader returns a DIDLoader that falls back to the given loader
+func NewDIDLoader(next ld.DocumentLoader) *DIDLoader {
+	return &DIDLoader{Next: next, Client: http.DefaultClient}
+}
+
+// LoadDocument satisfies the ld.DocumentLoader interface
+func (dl *DIDLoader) LoadDocument(u string) (*ld.RemoteDocument, error) {
+	if !strings.HasPrefix(u, "did:") {
+		return dl.Next.LoadDocument(u)
+	}
+
+	did := u
+	if i := strings.IndexAny(did, "#?"); i != -1 {
+		did = did[:i]
+	}
+
+	var document interface{}
+	var err error
+	if strings.HasPrefix(did, "did:key:") {
+		document, err = resolveDIDKey(did)
+	} else if strings.HasPrefix(did, "did:web:") {
+		document, err = dl.resolveDIDWeb(did)
+	} else {
+		err = ErrUnsupportedDID
+	}
+
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	return &ld.RemoteDocument{DocumentURL: did, Document: document}, nil
+}
+
+// ed25519Codec is the multicodec prefix of ed25519 public keys
+var ed25519Codec = []byte{0xed, 0x01}
+
+// resolveDIDKey expands a did:key with an ed25519 public key into its DID document
+func resolveDIDKey(did string) (interface{}, error) {
+	fingerprint := strings.TrimPrefix(did, "did:key:")
+	if !strings.HasPrefix(fingerprint, "z") {
+		return nil, ErrInvalidDID
+	}
+
+	key, err := decodeBase58(fingerprint[1:])
+	if err != nil {
+		return nil, err
+	} else if len(key) != 34 || !bytes.Equal(key[:2], ed25519Codec) {
+		return nil, ErrUnsupportedDID
+	}
+
+	method := did + "#" + fingerprint
+	return map[string]interface{}{
+		"@context": []interface{}{
+			"https://www.w3.org/ns/did/v1",
+			"https://w3id.org/security/suites/ed25519-2020/v1",
+		},
+		"id": did,
+		"verificationMethod": []interface{}{
+			map[string]interface{}{
+				"id":                 method,
+				"type":               "Ed25519VerificationKey2020",
+				"controller":         did,
+				"publicKeyMultibase": fingerprint,
+			},
+		},
+		"authentication":       []interface{}{method},
+		"assertionMethod":      []interface{}{method},
+		"capabilityDelegation": []interface{}{method},
+		"capabilityInvocation": []interface{}{method},
+	}, nil
+}
+
+// resolveDIDWeb fetches the DID document of a did:web from its host
+func (dl *DIDLoader) resolveDIDWeb(did string) (interface{}, error) {
+	parts := strings.Split(strings.TrimPrefix(did, "did:web:"), ":")
+	for i, part := range parts {
+		parts[i] = strings.Replace(part, "%3A", ":", -1)
+	}
+
+	url := "https://" + strings.Join(parts, "/")
+	if len(parts) == 1 {
+		url += "/.well-known"
+	}
+	url += "/did.json"
+
+	res, err := dl.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, ErrFetchFailed
+	}
+
+	var document interface{}
+	err = json.NewDecoder(res.Body).Decode(&document)
+	return document, err
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// decodeBase58 decodes a base58btc string
+func decodeBase58(s string) ([]byte, error) {
+	n, radix := new(big.Int), big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i == -1 {
+			return nil, ErrInvalidDID
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	// Leading ones encode leading zero bytes
+	zeros := len(s) - len(strings.TrimLeft(s, "1"))
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// A StaticLoader serves registered documents without fetching them,
+// and loads every other URL with the next loader, if there is one
+type StaticLoader struct {
+	Next      ld.DocumentLoader
+	documents map[string]interface{}
+}
+
+// NewStaticLoader reads the given JSON documents, keyed by URL, into a StaticLoader
+func NewStaticLoader(documents map[string]io.Reader, next ld.DocumentLoader) (*StaticLoader, error) {
+	sl := &StaticLoader{Next: next, documents: make(map[string]interface{}, len(documents))}
+	for u, r := range documents {
+		var document interface{}
+		err := json.NewDecoder(r).Decode(&document)
+		if err != nil {
+			return nil, err
+		}
+		sl.documents[u] = document
+	}
+	return sl, nil
+}
+
+// LoadDocument satisfies the ld.DocumentLoader interface
+func (sl *StaticLoader) LoadDocument(u string) (*ld.RemoteDocument, error) {
+	if document, has := sl.documents[u]; has {
+		return &ld.RemoteDocument{DocumentURL: u, Document: document}, nil
+	} else if sl.Next != nil {
+		return sl.Next.LoadDocument(u)
+	}
+	return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, u)
+}
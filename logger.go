@@ -0,0 +1,48 @@
+package styx
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// A Field is a structured key-value pair attached to a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// A Logger receives the store's leveled, structured log messages.
+// Embedders can set Config.Logger to route them into their own systems.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+type stdLogger struct{ debug bool }
+
+// StdLogger writes log messages with the standard log package, omitting debug messages
+var StdLogger Logger = stdLogger{}
+
+// DebugLogger writes every log message with the standard log package
+var DebugLogger Logger = stdLogger{debug: true}
+
+func (l stdLogger) print(level, msg string, fields []Field) {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		values[i] = fmt.Sprintf("%s=%v", field.Key, field.Value)
+	}
+	log.Printf("%s %s %s\n", level, msg, strings.Join(values, " "))
+}
+
+func (l stdLogger) Debug(msg string, fields ...Field) {
+	if l.debug {
+		l.print("DEBUG", msg, fields)
+	}
+}
+
+func (l stdLogger) Info(msg string, fields ...Field)  { l.print("INFO", msg, fields) }
+func (l stdLogger) Warn(msg string, fields ...Field)  { l.print("WARN", msg, fields) }
+func (l stdLogger) Error(msg string, fields ...Field) { l.print("ERROR", msg, fields) }
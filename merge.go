@@ -0,0 +1,74 @@
+package styx
+
+import (
+	"context"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// Merge copies every dataset of another store into this one. Each dataset's quads are
+// read as IDs from the source's QuadStore and remapped through the source dictionary
+// into this store's dictionary, so nothing has to be re-parsed or re-canonicalized.
+// The source store's QuadStore has to keep datasets (the default empty store doesn't).
+// Merged datasets are written as they are, without this store's hooks, detection rules,
+// signers or quota, but the entailments, views and subscriptions still see them.
+func (s *Store) Merge(ctx context.Context, source *Store) error {
+	dictionary := source.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	list := source.Config.QuadStore.List(NIL)
+	defer list.Close()
+
+	for id, valid := list.Next(); valid; id, valid = list.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		node, err := dictionary.GetTerm(id, rdf.Default)
+		if err != nil {
+			return err
+		}
+
+		quads, err := source.Config.QuadStore.Get(id)
+		if err != nil {
+			return err
+		}
+
+		dataset := make([]*rdf.Quad, len(quads))
+		for i, quad := range quads {
+			var terms [4]rdf.Term
+			for j, term := range quad {
+				terms[j], err = dictionary.GetTerm(term, node)
+				if err != nil {
+					return err
+				}
+			}
+			dataset[i] = rdf.NewQuad(terms[0], terms[1], terms[2], terms[3])
+		}
+
+		err = s.setInternal(ctx, node, dataset)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setInternal writes a dataset that doesn't come from a client, like one copied from
+// another store, without the write hooks, detection rules, signers or quota
+func (s *Store) setInternal(ctx context.Context, node rdf.Term, dataset []*rdf.Quad) error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	var removed []*rdf.Quad
+	err := retry(func() (err error) {
+		removed, err = s.set(ctx, node, dataset, false, nil, true)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.propagate(ctx, node, removed, dataset)
+}
@@ -0,0 +1,521 @@
+package styx
+
+import (
+	"context"
+	"strings"
+
+	ld "github.com/piprate/json-gold/ld"
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// Property paths are written as predicates of the form ^<p>+ in a query pattern:
+// the IRI of the predicate in angle brackets, with an optional leading ^ for the
+// inverse direction and an optional trailing + (one or more p edges) or * (zero
+// or more). Since IRIs can't contain angle brackets, ordinary predicates are never
+// mistaken for paths. JSON-LD queries can also write paths with the short names of
+// their context, like ^knows or knows+, which are expanded into the ^<p>+ syntax.
+//
+// Inverse paths are rewritten into ordinary triples. Transitive paths whose endpoints
+// are both constants or bound by other triples in the pattern are checked against each
+// solution of the rest of the pattern. Otherwise the paths are expanded: each solution
+// of the rest of the pattern is extended with every node reachable along the path from
+// a bound endpoint, by a breadth-first traversal over the SPO (or POS) index.
+
+type pathConstraint struct {
+	subject   rdf.Term
+	object    rdf.Term
+	predicate string
+	reflexive bool
+}
+
+func parsePath(value string) (predicate string, inverse bool, modifier byte) {
+	predicate = value
+	if strings.HasPrefix(predicate, "^") {
+		inverse = true
+		predicate = predicate[1:]
+	}
+
+	if l := len(predicate); l > 0 && (predicate[l-1] == '+' || predicate[l-1] == '*') {
+		modifier = predicate[l-1]
+		predicate = predicate[:l-1]
+	}
+
+	return
+}
+
+// explicitPath parses a predicate written in the ^<p>+ path syntax
+func explicitPath(value string) (predicate string, inverse bool, modifier byte, ok bool) {
+	if len(value) < 2 || (value[0] != '<' && !strings.HasPrefix(value, "^<")) {
+		return
+	}
+
+	predicate, inverse, modifier = parsePath(value)
+	if l := len(predicate); l < 2 || predicate[0] != '<' || predicate[l-1] != '>' {
+		return
+	}
+
+	predicate = predicate[1 : len(predicate)-1]
+	ok = !strings.ContainsAny(predicate, "<>")
+	return
+}
+
+// pathNames rewrites the keys of a JSON-LD query that are short names with path modifiers
+// into the ^<p>+ syntax, resolving the names against the contexts in scope. Keys that don't
+// resolve to an absolute IRI are left as they are.
+func pathNames(query interface{}, context *ld.Context) (interface{}, error) {
+	switch query := query.(type) {
+	case map[string]interface{}:
+		if local, has := query["@context"]; has {
+			var err error
+			if context, err = context.Parse(local); err != nil {
+				return nil, err
+			}
+		}
+
+		result := make(map[string]interface{}, len(query))
+		for key, value := range query {
+			if key == "@context" {
+				result[key] = value
+				continue
+			}
+
+			if predicate, inverse, modifier := parsePath(key); !strings.HasPrefix(predicate, "@") &&
+				!strings.HasPrefix(predicate, "<") && (inverse || modifier != 0) {
+				iri, err := context.ExpandIri(predicate, false, true, nil, nil)
+				if err == nil && ld.IsAbsoluteIri(iri) && !strings.ContainsAny(iri, "<>") {
+					key = "<" + iri + ">"
+					if inverse {
+						key = "^" + key
+					}
+					if modifier != 0 {
+						key += string(modifier)
+					}
+				}
+			}
+
+			var err error
+			if result[key], err = pathNames(value, context); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(query))
+		for i, value := range query {
+			var err error
+			if result[i], err = pathNames(value, context); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return query, nil
+	}
+}
+
+// compilePaths rewrites the inverse paths in a pattern and splits out the transitive ones
+func compilePaths(pattern []*rdf.Quad) ([]*rdf.Quad, []*pathConstraint) {
+	result := make([]*rdf.Quad, 0, len(pattern))
+	var paths []*pathConstraint
+	for _, quad := range pattern {
+		if quad[1].TermType() != rdf.NamedNodeType {
+			result = append(result, quad)
+			continue
+		}
+
+		predicate, inverse, modifier, ok := explicitPath(quad[1].Value())
+		if !ok {
+			result = append(result, quad)
+			continue
+		}
+
+		subject, object := quad[0], quad[2]
+		if inverse {
+			subject, object = object, subject
+		}
+
+		if modifier != 0 {
+			paths = append(paths, &pathConstraint{subject, object, predicate, modifier == '*'})
+		} else {
+			result = append(result, rdf.NewQuad(subject, rdf.NewNamedNode(predicate), object, quad[3]))
+		}
+	}
+	return result, paths
+}
+
+// isVariable reports whether a term is a variable or a blank node
+func isVariable(term rdf.Term) bool {
+	t := term.TermType()
+	return t == rdf.VariableType || t == rdf.BlankNodeType
+}
+
+// unboundPaths reports whether any path has an endpoint that no triple in the pattern binds
+func unboundPaths(pattern []*rdf.Quad, paths []*pathConstraint) bool {
+	bound := map[string]bool{}
+	for _, quad := range pattern {
+		for _, term := range quad[:3] {
+			bound[term.String()] = true
+		}
+	}
+
+	for _, path := range paths {
+		for _, term := range []rdf.Term{path.subject, path.object} {
+			if isVariable(term) && !bound[term.String()] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandPaths solves a pattern whose paths have endpoints that aren't bound by the rest
+// of the pattern. The rest of the pattern is solved in full, and then each path in turn
+// either extends every solution with the nodes reachable from its bound endpoint, or
+// filters the solutions if both of its endpoints are bound. The query's filters, pipelines,
+// and redactions are applied to the expanded solutions, and the returned iterator is over
+// the precomputed results, like those of cached queries.
+func (s *Store) expandPaths(ctx context.Context, txn KVTxn, pattern []*rdf.Quad, paths []*pathConstraint, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	if len(index) > 0 {
+		return nil, ErrCachedResults
+	}
+
+	// The rest of the pattern and the paths are solved against the same snapshot
+	if txn == nil {
+		txn = s.KV.NewTransaction(false)
+		defer txn.Discard()
+	}
+
+	solve := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		solve, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// The rest of the pattern is solved without filters, since they might drop or
+	// redact the values that the paths are expanded from
+	var cost Cost
+	base := &cachedResult{query: pattern, domain: []rdf.Term{}, solutions: [][]rdf.Term{{}}}
+	if len(pattern) > 0 {
+		iter, err := s.internalQuery(solve, txn, pattern, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		base, err = solveAll(iter)
+		cost = iter.cost
+		iter.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	columns := append([]rdf.Term{}, base.domain...)
+	ids := make(map[string]int, len(columns))
+	for i, term := range columns {
+		ids[term.String()] = i
+	}
+
+	solutions := base.solutions
+	for remaining := paths; len(remaining) > 0; {
+		var deferred []*pathConstraint
+		for _, path := range remaining {
+			var err error
+			_, subjectBound := ids[path.subject.String()]
+			_, objectBound := ids[path.object.String()]
+			subjectBound = subjectBound || !isVariable(path.subject)
+			objectBound = objectBound || !isVariable(path.object)
+			if subjectBound {
+				solutions, err = expandPath(solve, txn, dictionary, path, path.subject, path.object, false, ids, solutions)
+			} else if objectBound {
+				solutions, err = expandPath(solve, txn, dictionary, path, path.object, path.subject, true, ids, solutions)
+			} else {
+				deferred = append(deferred, path)
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			} else if _, has := ids[path.subject.String()]; !has && isVariable(path.subject) {
+				ids[path.subject.String()] = len(columns)
+				columns = append(columns, path.subject)
+			} else if _, has := ids[path.object.String()]; !has && isVariable(path.object) {
+				ids[path.object.String()] = len(columns)
+				columns = append(columns, path.object)
+			}
+		}
+
+		// Paths with two unbound endpoints can't be enumerated
+		if len(deferred) == len(remaining) {
+			return nil, ErrInvalidPath
+		}
+		remaining = deferred
+	}
+
+	order, result, err := domainOrder(domain, columns, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := s.solutionFilter(solve, txn, dictionary, pattern, result, opts)
+	filtered := [][]rdf.Term{}
+	for _, solution := range solutions {
+		if err := contextError(solve); err != nil {
+			return nil, err
+		}
+
+		sorted := make([]rdf.Term, len(order))
+		for i, j := range order {
+			sorted[i] = solution[j]
+		}
+
+		index, err := filter.filterSolution(sorted)
+		if err != nil {
+			return nil, err
+		} else if index != nil {
+			filtered = append(filtered, index)
+		}
+	}
+	solutions = filtered
+
+	if opts.Offset < len(solutions) {
+		solutions = solutions[opts.Offset:]
+	} else {
+		solutions = nil
+	}
+	if opts.Limit > 0 && opts.Limit < len(solutions) {
+		solutions = solutions[:opts.Limit]
+	}
+
+	iter := replayIterator(ctx, pattern, result, solutions)
+	iter.cost, iter.meter = cost, s.Config.Meter
+	return iter, nil
+}
+
+// expandPath extends or filters solutions along a path from a bound endpoint to the other
+// endpoint, which is a new variable unless it is a constant or already has a column.
+func expandPath(
+	ctx context.Context,
+	txn KVTxn,
+	dictionary Dictionary,
+	path *pathConstraint,
+	from, to rdf.Term,
+	inverse bool,
+	ids map[string]int,
+	solutions [][]rdf.Term,
+) ([][]rdf.Term, error) {
+	predicate, err := dictionary.GetID(rdf.NewNamedNode(path.predicate), rdf.Default)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	value := func(solution []rdf.Term, term rdf.Term) rdf.Term {
+		if i, has := ids[term.String()]; has {
+			return solution[i]
+		}
+		return term
+	}
+
+	_, bound := ids[to.String()]
+	bound = bound || !isVariable(to)
+
+	result := [][]rdf.Term{}
+	for _, solution := range solutions {
+		if err = contextError(ctx); err != nil {
+			return nil, err
+		}
+
+		start := value(solution, from)
+		if start == nil {
+			continue
+		}
+
+		var reached []rdf.Term
+		if path.reflexive {
+			reached = append(reached, start)
+		}
+
+		id, err := dictionary.GetID(start, rdf.Default)
+		if err != nil && err != ErrNotFound {
+			return nil, err
+		} else if err == nil && predicate != NIL {
+			err = traverse(txn, predicate, id, inverse, true, func(node ID) bool {
+				if path.reflexive && node == id {
+					return true
+				}
+				if term, err := dictionary.GetTerm(node, rdf.Default); err == nil {
+					reached = append(reached, term)
+				}
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if bound {
+			target := value(solution, to)
+			for _, term := range reached {
+				if target != nil && term.Equal(target) {
+					result = append(result, solution)
+					break
+				}
+			}
+			continue
+		}
+
+		for _, term := range reached {
+			extended := make([]rdf.Term, len(solution)+1)
+			copy(extended, solution)
+			extended[len(solution)] = term
+			result = append(result, extended)
+		}
+	}
+
+	return result, nil
+}
+
+// pathFilter returns a transformer that drops the solutions that don't satisfy the given paths
+func (iter *Iterator) pathFilter(paths []*pathConstraint) (Transformer, error) {
+	predicates := make([]ID, len(paths))
+	for i, path := range paths {
+		for _, term := range []rdf.Term{path.subject, path.object} {
+			t := term.TermType()
+			if t != rdf.VariableType && t != rdf.BlankNodeType {
+				continue
+			} else if _, has := iter.ids[term.String()]; !has && !iter.empty {
+				return nil, ErrInvalidPath
+			}
+		}
+
+		id, err := iter.dictionary.GetID(rdf.NewNamedNode(path.predicate), rdf.Default)
+		if err == ErrNotFound {
+			id = NIL
+		} else if err != nil {
+			return nil, err
+		}
+		predicates[i] = id
+	}
+
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		for i, path := range paths {
+			subject, object := iter.lookup(path.subject), iter.lookup(path.object)
+			if subject == NIL || object == NIL {
+				return nil
+			} else if path.reflexive && subject == object {
+				continue
+			} else if predicates[i] == NIL {
+				return nil
+			}
+
+			var reached bool
+			err := traverse(iter.txn, predicates[i], subject, false, true, func(id ID) bool {
+				reached = id == object
+				return !reached
+			})
+			if err != nil || !reached {
+				return nil
+			}
+		}
+		return index
+	}), nil
+}
+
+// lookup returns the current ID of a variable, or the ID of a constant term
+func (iter *Iterator) lookup(term rdf.Term) ID {
+	if i, has := iter.ids[term.String()]; has {
+		return iter.variables[i].value
+	}
+	id, _ := iter.dictionary.GetID(term, rdf.Default)
+	return id
+}
+
+// traverse walks the edges of the given predicate breadth-first from a node, calling
+// visit once for every distinct node reached until visit returns false.
+// If transitive is false, only the immediate neighbors of the node are visited.
+func traverse(txn KVTxn, predicate, node ID, inverse, transitive bool, visit func(ID) bool) error {
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false})
+	defer iter.Close()
+
+	visited := map[ID]bool{}
+	queue := []ID{node}
+	for len(queue) > 0 {
+		a := queue[0]
+		queue = queue[1:]
+
+		var prefix []byte
+		if inverse {
+			prefix = assembleKey(TernaryPrefixes[1], true, predicate, a)
+		} else {
+			prefix = assembleKey(TernaryPrefixes[0], true, a, predicate)
+		}
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			b := ID(iter.Item().Key()[len(prefix):])
+			if visited[b] {
+				continue
+			}
+
+			visited[b] = true
+			if !visit(b) {
+				return nil
+			} else if transitive {
+				queue = append(queue, b)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Path returns every node reachable from the given node along a property path. The path
+// is a predicate IRI with an optional leading ^ (inverse) and trailing + or * modifier,
+// and the IRI can be written in angle brackets like in query patterns.
+func (s *Store) Path(node rdf.Term, path string) ([]rdf.Term, error) {
+	predicate, inverse, modifier, ok := explicitPath(path)
+	if !ok {
+		predicate, inverse, modifier = parsePath(path)
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	result := []rdf.Term{}
+	if modifier == '*' {
+		result = append(result, node)
+	}
+
+	start, err := dictionary.GetID(node, rdf.Default)
+	if err == ErrNotFound {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	p, err := dictionary.GetID(rdf.NewNamedNode(predicate), rdf.Default)
+	if err == ErrNotFound {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = traverse(txn, p, start, inverse, modifier != 0, func(id ID) bool {
+		if modifier == '*' && id == start {
+			return true
+		}
+
+		term, err := dictionary.GetTerm(id, rdf.Default)
+		if err == nil {
+			result = append(result, term)
+		}
+		return true
+	})
+
+	return result, err
+}
@@ -0,0 +1,203 @@
+package styx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ld "github.com/piprate/json-gold/ld"
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// RegisterQuery stores a query pattern and returns its q: URI, which is the hex-encoded
+// SHA-256 hash of the pattern's N-Quads after normalizeQuery. Patterns that only differ
+// in the labels of their variables and blank nodes get the same URI, and the stored
+// pattern uses the canonical labels. Registered queries expire after Config.QueryTTL.
+func (s *Store) RegisterQuery(pattern []*rdf.Quad) (*rdf.NamedNode, error) {
+	pattern, _ = normalizeQuery(pattern)
+	if len(pattern) == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	err := s.Config.Limits.check(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(canonicalNQuads(pattern))
+	id := hex.EncodeToString(hash[:])
+
+	val, err := json.Marshal(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	key := append([]byte{QueryPrefix}, id...)
+	err = updateTxn(s.KV, func(txn KVTxn) error {
+		if expiring, is := txn.(interface {
+			SetWithTTL(key, val []byte, ttl time.Duration) error
+		}); is && s.Config.QueryTTL > 0 {
+			return expiring.SetWithTTL(key, val, s.Config.QueryTTL)
+		}
+		return txn.Set(key, val)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rdf.NewNamedNode(QueryURIScheme + id), nil
+}
+
+// RegisteredQuery returns the pattern of a registered query
+func (s *Store) RegisteredQuery(uri rdf.Term) (pattern []*rdf.Quad, err error) {
+	if uri.TermType() != rdf.NamedNodeType || !strings.HasPrefix(uri.Value(), QueryURIScheme) {
+		return nil, ErrInvalidQueryURI
+	}
+
+	key := append([]byte{QueryPrefix}, strings.TrimPrefix(uri.Value(), QueryURIScheme)...)
+	err = viewTxn(s.KV, func(txn KVTxn) error {
+		item, err := txn.Get(key)
+		if err == ErrKeyNotFound {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error { return json.Unmarshal(val, &pattern) })
+	})
+	return
+}
+
+// QueryURI executes a registered query
+func (s *Store) QueryURI(ctx context.Context, uri rdf.Term, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	pattern, err := s.RegisteredQuery(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.QueryContext(ctx, pattern, domain, index, opts)
+}
+
+// Reified quads of normalizeQuery
+const (
+	reifiedSubject   = "urn:styx:subject"
+	reifiedPredicate = "urn:styx:predicate"
+	reifiedObject    = "urn:styx:object"
+	reifiedGraph     = "urn:styx:graph"
+	reifiedVariable  = "urn:styx:Variable"
+)
+
+// normalizeQuery relabels the variables and blank nodes of a pattern with URDNA2015,
+// so that patterns that only differ in their labels normalize to the same quads.
+// URDNA2015 only relabels blank nodes in the subject, object, and graph positions,
+// so every quad is reified as a blank node first and variables are turned into marked
+// blank nodes. It returns the sorted, de-duplicated pattern with canonical labels,
+// and the canonical term of each of the pattern's variables and blank nodes by String().
+func normalizeQuery(pattern []*rdf.Quad) ([]*rdf.Quad, map[string]rdf.Term) {
+	quads := make(map[string]*rdf.Quad, len(pattern))
+	for _, quad := range pattern {
+		quads[quad.String()] = quad
+	}
+
+	// The normalization algorithm rewrites the labels of these nodes in place
+	nodes := map[string]*ld.BlankNode{}
+	node := func(term rdf.Term) ld.Node {
+		switch term.TermType() {
+		case rdf.VariableType, rdf.BlankNodeType:
+			if n, has := nodes[term.String()]; has {
+				return n
+			}
+			n := ld.NewBlankNode(fmt.Sprintf("_:t%d", len(nodes)))
+			nodes[term.String()] = n
+			return n
+		case rdf.DefaultGraphType:
+			// Graph names can't be literals, so this can't be confused with a named graph
+			return ld.NewLiteral("", ld.XSDString, "")
+		default:
+			return toLdNode(term)
+		}
+	}
+
+	reified := []*ld.Quad{}
+	original := make([]*rdf.Quad, 0, len(quads))
+	for _, quad := range quads {
+		statement := ld.NewBlankNode(fmt.Sprintf("_:s%d", len(original)))
+		for i, predicate := range []string{reifiedSubject, reifiedPredicate, reifiedObject, reifiedGraph} {
+			reified = append(reified, ld.NewQuad(statement, ld.NewIRI(predicate), node(quad[i]), "@default"))
+		}
+		original = append(original, quad)
+	}
+
+	variables := map[string]bool{}
+	for _, quad := range original {
+		for _, term := range quad {
+			if term.TermType() == rdf.VariableType && !variables[term.String()] {
+				variables[term.String()] = true
+				marker := ld.NewQuad(nodes[term.String()], ld.NewIRI(ld.RDFType), ld.NewIRI(reifiedVariable), "@default")
+				reified = append(reified, marker)
+			}
+		}
+	}
+
+	dataset := ld.NewRDFDataset()
+	dataset.Graphs["@default"] = reified
+	ld.NewNormalisationAlgorithm(Algorithm).Normalize(dataset)
+
+	labels := make(map[string]rdf.Term, len(nodes))
+	for label, n := range nodes {
+		id := strings.TrimPrefix(n.Attribute, blankNodePrefix)
+		if variables[label] {
+			labels[label] = rdf.NewVariable(id)
+		} else {
+			labels[label] = rdf.NewBlankNode(id)
+		}
+	}
+
+	result := make([]*rdf.Quad, len(original))
+	for i, quad := range original {
+		var terms [4]rdf.Term
+		for j, term := range quad {
+			if t, has := labels[term.String()]; has {
+				terms[j] = t
+			} else {
+				terms[j] = term
+			}
+		}
+		result[i] = rdf.NewQuad(terms[0], terms[1], terms[2], terms[3])
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result, labels
+}
+
+// sortQuads sorts quads and removes duplicates
+func sortQuads(quads []*rdf.Quad) []*rdf.Quad {
+	values := make(map[string]*rdf.Quad, len(quads))
+	for _, quad := range quads {
+		values[quad.String()] = quad
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*rdf.Quad, len(keys))
+	for i, key := range keys {
+		result[i] = values[key]
+	}
+	return result
+}
+
+// canonicalNQuads serializes canonicalized quads as N-Quads, one per line
+func canonicalNQuads(quads []*rdf.Quad) []byte {
+	lines := make([]string, len(quads))
+	for i, quad := range quads {
+		lines[i] = quad.String() + "\n"
+	}
+	return []byte(strings.Join(lines, ""))
+}
@@ -0,0 +1,255 @@
+package styx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const (
+	qudtNumericValue = "http://qudt.org/schema/qudt/numericValue"
+	qudtUnit         = "http://qudt.org/schema/qudt/unit"
+	qudtUnitPrefix   = "http://qudt.org/vocab/unit/"
+)
+
+// schemaNamespaces are the namespaces of schema.org QuantitativeValue properties
+var schemaNamespaces = []string{"http://schema.org/", "https://schema.org/"}
+
+// A Unit converts quantities of a dimension into its canonical unit,
+// which is Factor times the quantity plus Offset
+type Unit struct {
+	Dimension string
+	Factor    float64
+	Offset    float64
+}
+
+// Units are the known units by QUDT unit name, UN/CEFACT common code (as used by
+// schema.org's unitCode), and symbol. Canonical units are SI base units.
+var Units = map[string]Unit{}
+
+func init() {
+	for _, u := range []struct {
+		unit  Unit
+		names []string
+	}{
+		{Unit{"mass", 1, 0}, []string{"KiloGM", "KGM", "kg"}},
+		{Unit{"mass", 1e-3, 0}, []string{"GM", "GRM", "g"}},
+		{Unit{"mass", 1e-6, 0}, []string{"MilliGM", "MGM", "mg"}},
+		{Unit{"mass", 1e3, 0}, []string{"TONNE", "TNE", "t"}},
+		{Unit{"mass", 0.45359237, 0}, []string{"LB", "LBR", "lb"}},
+		{Unit{"length", 1, 0}, []string{"M", "MTR", "m"}},
+		{Unit{"length", 1e3, 0}, []string{"KiloM", "KMT", "km"}},
+		{Unit{"length", 1e-2, 0}, []string{"CentiM", "CMT", "cm"}},
+		{Unit{"length", 1e-3, 0}, []string{"MilliM", "MMT", "mm"}},
+		{Unit{"length", 0.0254, 0}, []string{"IN", "INH", "in"}},
+		{Unit{"length", 0.3048, 0}, []string{"FT", "FOT", "ft"}},
+		{Unit{"length", 1609.344, 0}, []string{"MI", "SMI", "mi"}},
+		{Unit{"time", 1, 0}, []string{"SEC", "s"}},
+		{Unit{"time", 60, 0}, []string{"MIN", "min"}},
+		{Unit{"time", 3600, 0}, []string{"HR", "HUR", "h"}},
+		{Unit{"time", 86400, 0}, []string{"DAY", "d"}},
+		{Unit{"volume", 1, 0}, []string{"M3", "MTQ", "m3"}},
+		{Unit{"volume", 1e-3, 0}, []string{"L", "LTR"}},
+		{Unit{"volume", 1e-6, 0}, []string{"MilliL", "MLT", "mL"}},
+		{Unit{"temperature", 1, 0}, []string{"K", "KEL"}},
+		{Unit{"temperature", 1, 273.15}, []string{"DEG_C", "CEL"}},
+		{Unit{"temperature", 5.0 / 9, 273.15 - 32*5.0/9}, []string{"DEG_F", "FAH"}},
+	} {
+		for _, name := range u.names {
+			Units[name] = u.unit
+		}
+	}
+}
+
+// getUnit looks up a unit by QUDT IRI, code, or symbol
+func getUnit(name string) (Unit, bool) {
+	unit, has := Units[strings.TrimPrefix(name, qudtUnitPrefix)]
+	return unit, has
+}
+
+// A Quantity is a number in a unit
+type Quantity struct {
+	Value float64
+	Unit  string
+}
+
+// Normalize converts a quantity into the canonical unit of its dimension
+func (q Quantity) Normalize() (value float64, dimension string, ok bool) {
+	unit, has := getUnit(q.Unit)
+	if !has {
+		return 0, "", false
+	}
+	return q.Value*unit.Factor + unit.Offset, unit.Dimension, true
+}
+
+// schemaProperty returns the local name of a schema.org property, or the empty string
+func schemaProperty(predicate string) string {
+	for _, namespace := range schemaNamespaces {
+		if strings.HasPrefix(predicate, namespace) {
+			return strings.TrimPrefix(predicate, namespace)
+		}
+	}
+	return ""
+}
+
+// quantityKeys recognizes the QUDT and schema.org quantitative values in a dataset,
+// which are subjects with both a numeric value and a known unit, and returns their
+// keys in the quantity index
+func quantityKeys(origin ID, quads [][4]ID, dictionary Dictionary, node rdf.Term) ([][]byte, error) {
+	values, units := map[ID]float64{}, map[ID]string{}
+	for _, quad := range quads {
+		predicate, err := dictionary.GetTerm(quad[1], node)
+		if err != nil {
+			return nil, err
+		}
+
+		p := predicate.Value()
+		isValue := p == qudtNumericValue || schemaProperty(p) == "value"
+		isUnit := p == qudtUnit || schemaProperty(p) == "unitCode" || schemaProperty(p) == "unitText"
+		if !isValue && !isUnit {
+			continue
+		}
+
+		object, err := dictionary.GetTerm(quad[2], node)
+		if err != nil {
+			return nil, err
+		}
+
+		if isUnit {
+			units[quad[0]] = object.Value()
+		} else if literal, is := object.(*rdf.Literal); is {
+			if value := ParseValue(literal); value.Kind == NumberValue {
+				values[quad[0]] = value.Number
+			}
+		}
+	}
+
+	keys := [][]byte{}
+	for subject, value := range values {
+		unit, has := units[subject]
+		if !has {
+			continue
+		}
+		canonical, dimension, ok := Quantity{value, unit}.Normalize()
+		if ok {
+			keys = append(keys, quantityKey(dimension, canonical, subject, origin))
+		}
+	}
+	return keys, nil
+}
+
+// quantityKey assembles a quantity index key, which sorts by dimension and then by value
+func quantityKey(dimension string, value float64, subject, origin ID) []byte {
+	key := quantityPrefix(dimension, value)
+	key = append(key, subject...)
+	key = append(key, '\t')
+	return append(key, origin...)
+}
+
+func quantityPrefix(dimension string, value float64) []byte {
+	key := make([]byte, 0, len(dimension)+10)
+	key = append(key, QuantityPrefix)
+	key = append(key, dimension...)
+	key = append(key, '\t')
+
+	// Flipping the sign bit (and the rest, for negative numbers)
+	// makes the bytes of floats sort in numeric order
+	bits := math.Float64bits(value)
+	if value < 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, bits)
+	return append(key, val...)
+}
+
+// indexQuantities adds the quantitative values of a dataset to the quantity index, or removes them
+func indexQuantities(origin ID, quads [][4]ID, dictionary Dictionary, node rdf.Term, remove bool, t KVTxn, db KV) (txn KVTxn, err error) {
+	txn = t
+	keys, err := quantityKeys(origin, quads, dictionary, node)
+	if err != nil {
+		return
+	}
+
+	for _, key := range keys {
+		if remove {
+			txn, err = deleteSafe(key, txn, db)
+		} else {
+			txn, err = setSafe(key, nil, txn, db)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FilterQuantity returns a transformer that keeps the solutions binding the variable to
+// the subject of a quantitative value (a QUDT numericValue and unit, or a schema.org value
+// and unitCode or unitText) between min and max, after converting them to the same unit.
+// Either bound can be nil, and the bounds have to use known units of the same dimension.
+// The matching subjects are read from the quantity index once per query.
+func FilterQuantity(variable rdf.Term, min, max *Quantity) (Transformer, error) {
+	dimension := ""
+	bounds := [2]float64{math.Inf(-1), math.Inf(1)}
+	for i, q := range []*Quantity{min, max} {
+		if q == nil {
+			continue
+		}
+		value, d, ok := q.Normalize()
+		if !ok || dimension != "" && d != dimension {
+			return nil, ErrInvalidQuantity
+		}
+		dimension, bounds[i] = d, value
+	}
+
+	if dimension == "" {
+		return nil, ErrInvalidQuantity
+	}
+
+	var subjects map[ID]bool
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		if subjects == nil {
+			subjects = map[ID]bool{}
+			if scanQuantities(iter.txn, dimension, bounds, subjects) != nil {
+				return nil
+			}
+		}
+
+		if !subjects[iter.lookup(variable)] {
+			return nil
+		}
+		return index
+	}), nil
+}
+
+// scanQuantities collects the subjects of the quantities of a dimension within the bounds
+func scanQuantities(txn KVTxn, dimension string, bounds [2]float64, subjects map[ID]bool) error {
+	prefix := append([]byte{QuantityPrefix}, dimension+"\t"...)
+	end := quantityPrefix(dimension, bounds[1])
+
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	defer iter.Close()
+
+	for iter.Seek(quantityPrefix(dimension, bounds[0])); iter.Valid(); iter.Next() {
+		key := iter.Item().Key()
+		if len(key) < len(prefix)+8 {
+			return ErrCorruptIndex
+		} else if bytes.Compare(key[:len(prefix)+8], end) > 0 {
+			break
+		}
+
+		rest := key[len(prefix)+8:]
+		i := bytes.IndexByte(rest, '\t')
+		if i == -1 {
+			return ErrCorruptIndex
+		}
+		subjects[ID(rest[:i])] = true
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package styx
 
 import (
+	"context"
 	"encoding/binary"
 )
 
@@ -14,6 +15,10 @@ func (iter *Iterator) next(i int) (tail int, err error) {
 	tail = iter.Len()
 	// Okay so we start at the index given to us
 	for i >= 0 {
+		if err = contextError(iter.ctx); err != nil {
+			return
+		}
+
 		u := iter.variables[i]
 		// Try naively getting another value from u
 		u.value = u.Next()
@@ -150,6 +155,10 @@ func (iter *Iterator) tick(i, min int, delta []*vcache) (ok bool, err error) {
 	// The biggest outer loop is walking backwards over iter.In[i]
 	x := len(iter.in[i])
 	for x > 0 {
+		if err = contextError(iter.ctx); err != nil {
+			return
+		}
+
 		j := iter.in[i][x-1]
 
 		if j <= min {
@@ -318,7 +327,7 @@ func (iter *Iterator) push(u *variable, min, max int) (err error) {
 				neighbor.terms[i] = u.value
 
 				item := c.iterator.Item()
-				meta := item.UserMeta()
+				meta := item.Key()[0]
 				if meta == UnaryPrefix {
 					var p Permutation = i
 					if place == m {
@@ -331,9 +340,12 @@ func (iter *Iterator) push(u *variable, min, max int) (err error) {
 				} else {
 					A, B := (neighbor.place+1)%3, (neighbor.place+2)%3
 					neighbor.prefix = assembleKey(TernaryPrefixes[A], true, neighbor.terms[A], neighbor.terms[B])
-					err = item.Value(func(val []byte) error {
-						neighbor.count = binary.BigEndian.Uint32(val)
-						return nil
+					err = item.Value(func(val []byte) (err error) {
+						val, err = openCounts(val, 1)
+						if err == nil {
+							neighbor.count = binary.BigEndian.Uint32(val)
+						}
+						return
 					})
 				}
 
@@ -350,3 +362,12 @@ func (iter *Iterator) push(u *variable, min, max int) (err error) {
 	}
 	return
 }
+
+// contextError returns the context's error, reporting passed deadlines as ErrQueryTimeout
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if err == context.DeadlineExceeded {
+		return ErrQueryTimeout
+	}
+	return err
+}
@@ -0,0 +1,308 @@
+package styx
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Quota limits how much data the store accepts. Zero values are unlimited.
+// Bytes are measured as the length of the datasets' N-Quads serializations.
+// Peer limits apply to the datasets signed by each key, so shared stores can limit
+// individual publishers. The datasets that the store writes itself, like entailments
+// and materialized views, count towards the totals but are never rejected.
+type Quota struct {
+	DatasetQuads uint64
+	DatasetBytes uint64
+	PeerQuads    uint64
+	PeerBytes    uint64
+	TotalQuads   uint64
+	TotalBytes   uint64
+}
+
+// Usage is the number of quads and bytes used by a dataset or the whole store.
+// Modified is the time the dataset was last inserted, and is zero for totals.
+type Usage struct {
+	Quads    uint64
+	Bytes    uint64
+	Modified time.Time
+}
+
+func getUsage(dataset []*rdf.Quad) *Usage {
+	usage := &Usage{Quads: uint64(len(dataset)), Modified: time.Now()}
+	for _, quad := range dataset {
+		usage.Bytes += uint64(len(quad.String())) + 1
+	}
+	return usage
+}
+
+func (usage *Usage) bytes() []byte {
+	val := make([]byte, 24)
+	binary.BigEndian.PutUint64(val[:8], usage.Quads)
+	binary.BigEndian.PutUint64(val[8:16], usage.Bytes)
+	binary.BigEndian.PutUint64(val[16:], uint64(usage.Modified.UnixNano()))
+	return val
+}
+
+func parseUsage(item KVItem) (*Usage, error) {
+	usage := &Usage{}
+	return usage, item.Value(func(val []byte) error {
+		// Records written before timestamps were added are 16 bytes long
+		if len(val) != 16 && len(val) != 24 {
+			return ErrInvalidUsage
+		}
+		usage.Quads = binary.BigEndian.Uint64(val[:8])
+		usage.Bytes = binary.BigEndian.Uint64(val[8:16])
+		if len(val) == 24 {
+			usage.Modified = time.Unix(0, int64(binary.BigEndian.Uint64(val[16:])))
+		}
+		return nil
+	})
+}
+
+// Usage returns the recorded usage of a single dataset
+func (s *Store) Usage(node rdf.Term) (*Usage, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	origin, err := dictionary.GetID(node, rdf.Default)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(assembleKey(UsagePrefix, false, origin))
+	if err == ErrKeyNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseUsage(item)
+}
+
+// TotalUsage returns the sum of the recorded usage of every dataset
+func (s *Store) TotalUsage() (*Usage, error) {
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+	return getTotalUsage(txn)
+}
+
+// PeerUsage returns the sum of the recorded usage of the datasets signed by a key
+func (s *Store) PeerUsage(key ed25519.PublicKey) (*Usage, error) {
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+	return getPeerUsage(key, txn)
+}
+
+// getTotalUsage returns the running total, summing every dataset's usage
+// for stores written before the total was kept
+func getTotalUsage(txn KVTxn) (*Usage, error) {
+	item, err := txn.Get(TotalUsageKey)
+	if err == ErrKeyNotFound {
+		return sumUsage(txn)
+	} else if err != nil {
+		return nil, err
+	}
+	return parseUsage(item)
+}
+
+func getPeerUsage(key ed25519.PublicKey, txn KVTxn) (*Usage, error) {
+	item, err := txn.Get(append([]byte{PeerPrefix}, key...))
+	if err == ErrKeyNotFound {
+		return &Usage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseUsage(item)
+}
+
+// sumUsage sums the usage of every dataset
+func sumUsage(txn KVTxn) (*Usage, error) {
+	prefix := []byte{UsagePrefix}
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer iter.Close()
+
+	total := &Usage{}
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		usage, err := parseUsage(iter.Item())
+		if err != nil {
+			return nil, err
+		}
+		total.add(usage)
+	}
+	return total, nil
+}
+
+func (usage *Usage) add(other *Usage) {
+	usage.Quads += other.Quads
+	usage.Bytes += other.Bytes
+}
+
+// sub subtracts another usage, stopping at zero in case the sums were
+// started after some of the subtracted datasets had been inserted
+func (usage *Usage) sub(other *Usage) {
+	if usage.Quads > other.Quads {
+		usage.Quads -= other.Quads
+	} else {
+		usage.Quads = 0
+	}
+	if usage.Bytes > other.Bytes {
+		usage.Bytes -= other.Bytes
+	} else {
+		usage.Bytes = 0
+	}
+}
+
+// A datasetUsage is the recorded usage and signer of a dataset
+type datasetUsage struct {
+	usage  *Usage
+	signer ed25519.PublicKey
+}
+
+// getDatasetUsage returns the recorded usage and signer of a dataset.
+// The usage is nil if the dataset doesn't exist.
+func getDatasetUsage(origin ID, txn KVTxn) (*datasetUsage, error) {
+	signer, err := getSigner(origin, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := txn.Get(assembleKey(UsagePrefix, false, origin))
+	if err == ErrKeyNotFound {
+		return &datasetUsage{signer: signer}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	usage, err := parseUsage(item)
+	if err != nil {
+		return nil, err
+	}
+	return &datasetUsage{usage, signer}, nil
+}
+
+// checkQuota returns ErrQuotaExceeded if replacing the previous version of a dataset
+// with one that has the given usage and signer would exceed the store's quota
+func (s *Store) checkQuota(previous *datasetUsage, usage *Usage, signer ed25519.PublicKey, txn KVTxn) error {
+	quota := s.Config.Quota
+	if quota == nil {
+		return nil
+	}
+
+	if exceeds(usage, quota.DatasetQuads, quota.DatasetBytes) {
+		return ErrQuotaExceeded
+	}
+
+	if signer != nil && (quota.PeerQuads > 0 || quota.PeerBytes > 0) {
+		peer, err := getPeerUsage(signer, txn)
+		if err != nil {
+			return err
+		}
+		if previous.usage != nil && bytes.Equal(previous.signer, signer) {
+			peer.sub(previous.usage)
+		}
+		peer.add(usage)
+		if exceeds(peer, quota.PeerQuads, quota.PeerBytes) {
+			return ErrQuotaExceeded
+		}
+	}
+
+	if quota.TotalQuads > 0 || quota.TotalBytes > 0 {
+		total, err := getTotalUsage(txn)
+		if err != nil {
+			return err
+		}
+		if previous.usage != nil {
+			total.sub(previous.usage)
+		}
+		total.add(usage)
+		if exceeds(total, quota.TotalQuads, quota.TotalBytes) {
+			return ErrQuotaExceeded
+		}
+	}
+
+	return nil
+}
+
+func exceeds(usage *Usage, quads, bytes uint64) bool {
+	return quads > 0 && usage.Quads > quads || bytes > 0 && usage.Bytes > bytes
+}
+
+// setUsage replaces the recorded usage and signer of a dataset, and updates the running
+// total and the usage of the signers. The dataset's records are removed if usage is nil.
+func setUsage(origin ID, previous *datasetUsage, usage *Usage, signer ed25519.PublicKey, t KVTxn, db KV) (txn KVTxn, err error) {
+	txn = t
+
+	total, err := getTotalUsage(txn)
+	if err != nil {
+		return
+	}
+
+	if previous.usage != nil {
+		total.sub(previous.usage)
+		if previous.signer != nil {
+			txn, err = addPeerUsage(previous.signer, previous.usage, false, txn, db)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	key := assembleKey(UsagePrefix, false, origin)
+	signerKey := assembleKey(SignerPrefix, false, origin)
+	if usage == nil {
+		txn, err = deleteSafe(key, txn, db)
+		if err != nil {
+			return
+		}
+		txn, err = deleteSafe(signerKey, txn, db)
+	} else {
+		total.add(usage)
+		txn, err = setSafe(key, usage.bytes(), txn, db)
+		if err != nil {
+			return
+		}
+		if signer == nil {
+			txn, err = deleteSafe(signerKey, txn, db)
+		} else {
+			txn, err = setSafe(signerKey, signer, txn, db)
+			if err != nil {
+				return
+			}
+			txn, err = addPeerUsage(signer, usage, true, txn, db)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	// Sums have no modification time, so they are stored in the shorter format
+	return setSafe(TotalUsageKey, total.bytes()[:16], txn, db)
+}
+
+// addPeerUsage adds a dataset's usage to the usage of the key that signed it, or subtracts it
+func addPeerUsage(signer ed25519.PublicKey, usage *Usage, add bool, t KVTxn, db KV) (txn KVTxn, err error) {
+	txn = t
+	peer, err := getPeerUsage(signer, txn)
+	if err != nil {
+		return
+	}
+
+	if add {
+		peer.add(usage)
+	} else {
+		peer.sub(usage)
+	}
+
+	key := append([]byte{PeerPrefix}, signer...)
+	if peer.Quads == 0 && peer.Bytes == 0 {
+		return deleteSafe(key, txn, db)
+	}
+	return setSafe(key, peer.bytes()[:16], txn, db)
+}
@@ -0,0 +1,120 @@
+package styx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Redaction is the action taken on the values of a sensitive predicate
+type Redaction uint8
+
+const (
+	// Omit replaces redacted values with nil
+	Omit Redaction = iota
+	// Hash replaces redacted values with a hex SHA-256 digest literal of the original term
+	Hash
+)
+
+// A Policy marks a predicate as sensitive. Values that a query binds in the object
+// position of the predicate are redacted unless the query was made with the policy's scope.
+type Policy struct {
+	Predicate string
+	Scope     string
+	Action    Redaction
+}
+
+// setRedactions sets up the redaction of the values that the iterator's variables bind
+// in the object position of sensitive predicates, unless the query was granted their scope.
+// Patterns with a constant predicate redact their object variable in every solution,
+// while patterns with a variable predicate are checked against each solution's predicate.
+func (iter *Iterator) setRedactions(policies []Policy, scopes []string) {
+	granted := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		granted[scope] = true
+	}
+
+	iter.redact = map[int]Redaction{}
+	iter.sensitive = map[string]Redaction{}
+	for _, policy := range policies {
+		if granted[policy.Scope] {
+			continue
+		}
+
+		// Hashing is weaker than omission, so never downgrade an Omit
+		if action, has := iter.sensitive[policy.Predicate]; !has || action == Hash {
+			iter.sensitive[policy.Predicate] = policy.Action
+		}
+
+		for _, quad := range iter.query {
+			if quad[1].TermType() != rdf.NamedNodeType || quad[1].Value() != policy.Predicate {
+				continue
+			}
+
+			if i, has := iter.ids[quad[2].String()]; has {
+				if action, has := iter.redact[i]; !has || action == Hash {
+					iter.redact[i] = policy.Action
+				}
+			}
+		}
+	}
+
+	if len(iter.sensitive) == 0 {
+		return
+	}
+
+	for _, quad := range iter.query {
+		p, has := iter.ids[quad[1].String()]
+		if !has {
+			continue
+		}
+		if o, has := iter.ids[quad[2].String()]; has {
+			iter.redactBound = append(iter.redactBound, [2]int{p, o})
+		}
+	}
+}
+
+// redaction returns the action for the value of the variable at index i in the current solution
+func (iter *Iterator) redaction(i int) (action Redaction, redacted bool) {
+	action, redacted = iter.redact[i]
+	for _, pair := range iter.redactBound {
+		if pair[1] != i || (redacted && action == Omit) {
+			continue
+		}
+
+		value := iter.variables[pair[0]].value
+		if value == NIL {
+			continue
+		}
+
+		predicate, err := iter.dictionary.GetTerm(value, rdf.Default)
+		if err != nil || predicate == nil {
+			continue
+		}
+
+		if a, has := iter.sensitive[predicate.Value()]; has {
+			if !redacted || a == Omit {
+				action = a
+			}
+			redacted = true
+		}
+	}
+	return
+}
+
+// resolve translates the value of the variable at index i into a term, applying redactions
+func (iter *Iterator) resolve(i int, value ID) rdf.Term {
+	action, redacted := iter.redaction(i)
+	if redacted && action == Omit {
+		return nil
+	}
+
+	term, _ := iter.dictionary.GetTerm(value, rdf.Default)
+	if redacted && term != nil {
+		sum := sha256.Sum256([]byte(term.String()))
+		return rdf.NewLiteral(hex.EncodeToString(sum[:]), "", nil)
+	}
+
+	return term
+}
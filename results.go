@@ -0,0 +1,326 @@
+package styx
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// ResultCacheSize is the maximum number of result sets kept for queries with CacheResults
+const ResultCacheSize = 256
+
+type cachedResult struct {
+	query     []*rdf.Quad
+	domain    []rdf.Term
+	solutions [][]rdf.Term
+}
+
+// resultCache holds the full result sets of cached queries, keyed by the hash of
+// their canonicalized pattern, domain, and index. The generation is incremented on
+// every write so that result sets solved concurrently with a write aren't cached.
+type resultCache struct {
+	sync.Mutex
+	generation uint64
+	results    map[[sha256.Size]byte]*cachedResult
+}
+
+// resultKey hashes a query's normalized pattern, domain, and index, so that queries that
+// only differ in the labels of their variables share results. It returns the normalized
+// labels of the pattern's variables too.
+func resultKey(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term) ([sha256.Size]byte, []*rdf.Quad, map[string]rdf.Term) {
+	pattern, labels := normalizeQuery(pattern)
+	domain = relabel(domain, labels)
+
+	h := sha256.New()
+	h.Write(canonicalNQuads(pattern))
+	for _, terms := range [][]rdf.Term{domain, index} {
+		h.Write([]byte{'\n'})
+		for _, value := range formatTerms(terms) {
+			h.Write([]byte(value))
+			h.Write([]byte{'\t'})
+		}
+	}
+
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key, pattern, labels
+}
+
+// relabel replaces the variables in terms with their labels
+func relabel(terms []rdf.Term, labels map[string]rdf.Term) []rdf.Term {
+	if terms == nil {
+		return nil
+	}
+
+	result := make([]rdf.Term, len(terms))
+	for i, term := range terms {
+		if label, has := labels[term.String()]; has {
+			result[i] = label
+		} else {
+			result[i] = term
+		}
+	}
+	return result
+}
+
+// invalidate drops the cached results of every pattern that shares a predicate with the dataset
+func (c *resultCache) invalidate(dataset []*rdf.Quad) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.generation++
+	predicates := getPredicates(dataset)
+	for key, result := range c.results {
+		if overlaps(result.query, predicates) {
+			delete(c.results, key)
+		}
+	}
+}
+
+// clear drops every cached result
+func (c *resultCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.results = nil
+}
+
+// cachedQuery returns an iterator over the cached results of a query,
+// solving it in full first if they aren't cached yet
+func (s *Store) cachedQuery(ctx context.Context, pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	key, normalized, labels := resultKey(pattern, domain, index)
+
+	s.results.Lock()
+	result := s.results.results[key]
+	generation := s.results.generation
+	s.results.Unlock()
+
+	if result == nil {
+		iter, err := s.QueryContext(ctx, normalized, relabel(domain, labels), index, &QueryOptions{Timeout: opts.Timeout})
+		if err != nil {
+			return nil, err
+		}
+
+		result, err = solveAll(iter)
+		iter.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		s.results.Lock()
+		if s.results.generation == generation {
+			if s.results.results == nil || len(s.results.results) >= ResultCacheSize {
+				s.results.results = make(map[[sha256.Size]byte]*cachedResult)
+			}
+			s.results.results[key] = result
+		}
+		s.results.Unlock()
+	}
+
+	solutions := result.solutions
+	if opts.Offset < len(solutions) {
+		solutions = solutions[opts.Offset:]
+	} else {
+		solutions = nil
+	}
+	if opts.Limit > 0 && opts.Limit < len(solutions) {
+		solutions = solutions[:opts.Limit]
+	}
+
+	// The cached results are in terms of the normalized labels
+	originals := make(map[string]rdf.Term, len(labels))
+	for _, quad := range pattern {
+		for _, term := range quad {
+			if label, has := labels[term.String()]; has {
+				originals[label.String()] = term
+			}
+		}
+	}
+
+	return replayIterator(ctx, pattern, relabel(result.domain, originals), solutions), nil
+}
+
+// replayIterator returns an iterator over precomputed solutions
+func replayIterator(ctx context.Context, query []*rdf.Quad, domain []rdf.Term, solutions [][]rdf.Term) *Iterator {
+	if solutions == nil {
+		// A nil slice would put the iterator in ordinary mode
+		solutions = [][]rdf.Term{}
+	}
+
+	iter := &Iterator{
+		ctx:     ctx,
+		query:   query,
+		domain:  domain,
+		ids:     make(map[string]int, len(domain)),
+		results: solutions,
+	}
+
+	for i, node := range domain {
+		iter.ids[node.String()] = i
+	}
+
+	return iter
+}
+
+// solveAll collects the full solutions of an iterator as the caller would see them
+func solveAll(iter *Iterator) (*cachedResult, error) {
+	result := &cachedResult{query: iter.query, domain: iter.Domain(), solutions: [][]rdf.Term{}}
+	if iter.empty {
+		return result, nil
+	}
+
+	var index []rdf.Term
+	for delta, err := iter.Next(nil); delta != nil; delta, err = iter.Next(nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		solution := make([]rdf.Term, iter.Len())
+		copy(solution, index[:len(solution)-len(delta)])
+		copy(solution[len(solution)-len(delta):], delta)
+		result.solutions = append(result.solutions, solution)
+		index = solution
+	}
+
+	return result, nil
+}
+
+// replay advances an iterator over cached results to the next solution that differs in the given node
+func (iter *Iterator) replay(node rdf.Term) ([]rdf.Term, error) {
+	max := iter.Len()
+	if node != nil {
+		if i, has := iter.ids[node.String()]; has {
+			max = i + 1
+		}
+	}
+
+	for {
+		var index []rdf.Term
+		if iter.source != nil {
+			var err error
+			if index, err = iter.source.next(); err != nil {
+				return nil, err
+			} else if index == nil {
+				break
+			}
+		} else if iter.position < len(iter.results) {
+			index = iter.results[iter.position]
+			iter.position++
+		} else {
+			break
+		}
+
+		i := 0
+		if iter.solution != nil {
+			for i < len(index) && termsEqual(index[i], iter.solution[i]) {
+				i++
+			}
+			if i >= max {
+				continue
+			}
+		}
+
+		iter.solution = index
+		return index[i:], nil
+	}
+
+	iter.top = true
+	return nil, nil
+}
+
+// domainOrder puts the given domain first and the other columns after it, returning the
+// column of each position and the resulting domain. The ids map terms to their columns.
+func domainOrder(domain, columns []rdf.Term, ids map[string]int) ([]int, []rdf.Term, error) {
+	order := make([]int, 0, len(columns))
+	seen := make(map[int]bool, len(columns))
+	for _, term := range domain {
+		i, has := ids[term.String()]
+		if !has || seen[i] {
+			return nil, nil, ErrInvalidDomain
+		}
+		order = append(order, i)
+		seen[i] = true
+	}
+	for i := range columns {
+		if !seen[i] {
+			order = append(order, i)
+		}
+	}
+
+	result := make([]rdf.Term, len(order))
+	for i, j := range order {
+		result[i] = columns[j]
+	}
+	return order, result, nil
+}
+
+// A solutionSource generates the solutions of an iterator over precomputed results lazily
+type solutionSource interface {
+	next() ([]rdf.Term, error)
+	reset()
+}
+
+// solutionFilter returns an iterator that applies the filters, pipelines, and redactions
+// of a query to precomputed solutions over the given domain. The filters read the IDs of
+// the values, like over an ordinary iterator, so it has to be given the query's
+// transaction and dictionary.
+func (s *Store) solutionFilter(ctx context.Context, txn KVTxn, dictionary Dictionary, query []*rdf.Quad, domain []rdf.Term, opts *QueryOptions) *Iterator {
+	filter := &Iterator{
+		ctx:        ctx,
+		query:      query,
+		domain:     domain,
+		ids:        make(map[string]int, len(domain)),
+		variables:  make([]*variable, len(domain)),
+		txn:        txn,
+		dictionary: dictionary,
+	}
+	for i, term := range domain {
+		filter.ids[term.String()] = i
+		filter.variables[i] = &variable{node: term}
+	}
+	// The solutions were solved without the hints, so they're checked here
+	if len(opts.Types) > 0 {
+		filter.Pipe(typeFilter(opts.Types))
+	}
+	if len(opts.LanguageHints) > 0 {
+		filter.Pipe(languageHintFilter(opts.LanguageHints))
+	}
+	s.pipe(filter, opts)
+	return filter
+}
+
+// filterSolution returns the solution as the filter's pipeline transforms it, or nil if it is dropped
+func (filter *Iterator) filterSolution(solution []rdf.Term) ([]rdf.Term, error) {
+	for i, term := range solution {
+		id, err := filter.dictionary.GetID(term, rdf.Default)
+		if err == ErrNotFound {
+			id = NIL
+		} else if err != nil {
+			return nil, err
+		}
+		filter.variables[i].value = id
+	}
+
+	index := filter.resolveAll()
+	for i, u := range filter.variables {
+		// Constant endpoints of reflexive paths might not be in the dictionary
+		if u.value == NIL {
+			index[i] = solution[i]
+		}
+	}
+
+	if index = filter.transform(index); index != nil {
+		filter.current = index
+	}
+	return index, nil
+}
+
+// termsEqual compares terms that might be redacted (nil)
+func termsEqual(a, b rdf.Term) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(b)
+}
@@ -0,0 +1,175 @@
+package styx
+
+import (
+	"context"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const owlSameAs = "http://www.w3.org/2002/07/owl#sameAs"
+
+// identities partitions terms into sets of identical terms
+type identities struct {
+	terms   map[string]rdf.Term
+	parents map[string]string
+}
+
+func (i *identities) find(key string) string {
+	for i.parents[key] != key {
+		i.parents[key] = i.parents[i.parents[key]]
+		key = i.parents[key]
+	}
+	return key
+}
+
+func (i *identities) add(term rdf.Term) string {
+	key := term.String()
+	if _, has := i.parents[key]; !has {
+		i.terms[key] = term
+		i.parents[key] = key
+	}
+	return i.find(key)
+}
+
+func (i *identities) union(a, b rdf.Term) {
+	if a, b := i.add(a), i.add(b); a != b {
+		i.parents[a] = b
+	}
+}
+
+// sets returns the sets of identical terms with more than one member
+func (i *identities) sets() [][]rdf.Term {
+	members := map[string][]rdf.Term{}
+	for key, term := range i.terms {
+		root := i.find(key)
+		members[root] = append(members[root], term)
+	}
+
+	sets := make([][]rdf.Term, 0, len(members))
+	for _, set := range members {
+		if len(set) > 1 {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// smush updates the dataset of sameAs entailments, which copies the asserted triples of
+// each node linked by owl:sameAs onto the other nodes of its set. Unless the removed and
+// added quads change the links, only the copies that involve the sets of their nodes are
+// re-computed.
+func (s *Store) smush(ctx context.Context, node rdf.Term, removed, added []*rdf.Quad) error {
+	previous, exists, err := s.readDataset(s.Config.SameAs)
+	if err != nil {
+		return err
+	}
+
+	pairs, err := s.match(ctx, rdf.NewNamedNode(owlSameAs), nil)
+	if err != nil {
+		return err
+	}
+
+	ids := &identities{terms: map[string]rdf.Term{}, parents: map[string]string{}}
+	for _, pair := range pairs {
+		if pair[0].TermType() != rdf.LiteralType && pair[1].TermType() != rdf.LiteralType {
+			ids.union(pair[0], pair[1])
+		}
+	}
+
+	sets := ids.sets()
+	members := map[string][]rdf.Term{}
+	for _, set := range sets {
+		for _, term := range set {
+			members[term.String()] = set
+		}
+	}
+
+	entailed := []*rdf.Quad{}
+	delta := append(append([]*rdf.Quad{}, removed...), added...)
+	if exists && !changesSameAs(delta) {
+		nodes, err := s.deltaNodes(node, delta)
+		if err != nil {
+			return err
+		}
+
+		affected := map[string]bool{}
+		sets = sets[:0]
+		for key := range nodes {
+			set, has := members[key]
+			if !has || affected[set[0].String()] {
+				continue
+			}
+			sets = append(sets, set)
+			for _, term := range set {
+				affected[term.String()] = true
+			}
+		}
+
+		if len(sets) == 0 {
+			return nil
+		}
+
+		// Every copy that involves an affected node is re-computed below
+		for _, quad := range previous {
+			if !affected[quad[0].String()] && !affected[quad[2].String()] {
+				entailed = append(entailed, quad)
+			}
+		}
+	}
+
+	exclude := s.entailments()
+	p, o := rdf.NewVariable("p"), rdf.NewVariable("o")
+	for _, set := range sets {
+		for _, node := range set {
+			outgoing, err := s.asserted(ctx, rdf.NewQuad(node, p, o, rdf.Default), exclude...)
+			if err != nil {
+				return err
+			}
+
+			incoming, err := s.asserted(ctx, rdf.NewQuad(o, p, node, rdf.Default), exclude...)
+			if err != nil {
+				return err
+			}
+
+			// The copies onto the other nodes of this set, and onto
+			// the other nodes of the sets of the triples' other ends
+			for _, quad := range outgoing {
+				for _, other := range set {
+					if !other.Equal(node) {
+						entailed = append(entailed, rdf.NewQuad(other, quad[1], quad[2], rdf.Default))
+					}
+				}
+				for _, other := range members[quad[2].String()] {
+					if !other.Equal(quad[2]) {
+						entailed = append(entailed, rdf.NewQuad(node, quad[1], other, rdf.Default))
+					}
+				}
+			}
+
+			for _, quad := range incoming {
+				for _, other := range set {
+					if !other.Equal(node) {
+						entailed = append(entailed, rdf.NewQuad(quad[0], quad[1], other, rdf.Default))
+					}
+				}
+				for _, other := range members[quad[0].String()] {
+					if !other.Equal(quad[0]) {
+						entailed = append(entailed, rdf.NewQuad(other, quad[1], node, rdf.Default))
+					}
+				}
+			}
+		}
+	}
+
+	return s.setEntailments(ctx, s.Config.SameAs, previous, exists, entailed)
+}
+
+// changesSameAs reports whether any of the quads is an owl:sameAs link
+func changesSameAs(quads []*rdf.Quad) bool {
+	for _, quad := range quads {
+		if quad[1].TermType() == rdf.NamedNodeType && quad[1].Value() == owlSameAs {
+			return true
+		}
+	}
+	return false
+}
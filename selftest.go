@@ -0,0 +1,103 @@
+package styx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MinFreeSpace is the free disk space below which SelfTest reports a problem
+const MinFreeSpace = 1 << 30
+
+// selfTestKey is written and deleted again to check that the database is writable
+var selfTestKey = []byte("#selftest")
+
+// A Diagnostic is the result of one SelfTest check
+type Diagnostic struct {
+	Check   string
+	OK      bool
+	Message string
+}
+
+// SelfTest checks the health of the store's environment: that the database is open
+// and writable, that the dictionary can be read, that there is free disk space, and
+// that the clock isn't behind the recorded ingestion times.
+func (s *Store) SelfTest() []*Diagnostic {
+	return []*Diagnostic{
+		s.checkWritable(),
+		s.checkDictionary(),
+		s.checkDiskSpace(),
+		s.checkClock(),
+	}
+}
+
+func (s *Store) checkWritable() *Diagnostic {
+	d := &Diagnostic{Check: "database"}
+	if s.shutdown {
+		d.Message = "the database is closed"
+		return d
+	}
+
+	err := updateTxn(s.KV, func(txn KVTxn) error { return txn.Set(selfTestKey, []byte{}) })
+	if err == nil {
+		err = updateTxn(s.KV, func(txn KVTxn) error { return txn.Delete(selfTestKey) })
+	}
+
+	if err != nil {
+		d.Message = "writing a test key failed: " + err.Error()
+	} else {
+		d.OK, d.Message = true, "the database is writable"
+	}
+	return d
+}
+
+func (s *Store) checkDictionary() *Diagnostic {
+	d := &Diagnostic{Check: "dictionary"}
+	_, err := s.Graphs(context.Background())
+	if err != nil {
+		d.Message = "reading dataset names failed: " + err.Error()
+	} else {
+		d.OK, d.Message = true, "dataset names can be read"
+	}
+	return d
+}
+
+func (s *Store) checkDiskSpace() *Diagnostic {
+	d := &Diagnostic{Check: "disk space"}
+	if s.Config.Dir == "" {
+		d.OK, d.Message = true, "the database is in memory"
+		return d
+	}
+
+	free, err := freeSpace(s.Config.Dir)
+	if err == ErrUnsupportedPlatform {
+		d.OK, d.Message = true, "free space can't be checked on this platform"
+	} else if err != nil {
+		d.Message = "checking free space failed: " + err.Error()
+	} else if free < MinFreeSpace {
+		d.Message = fmt.Sprintf("only %d MB free in %s", free>>20, s.Config.Dir)
+	} else {
+		d.OK, d.Message = true, fmt.Sprintf("%d MB free", free>>20)
+	}
+	return d
+}
+
+func (s *Store) checkClock() *Diagnostic {
+	d := &Diagnostic{Check: "clock"}
+	graphs, err := s.Graphs(context.Background())
+	if err != nil {
+		d.Message = "reading ingestion times failed: " + err.Error()
+		return d
+	}
+
+	now := time.Now()
+	for _, graph := range graphs {
+		if graph.Modified.After(now.Add(time.Minute)) {
+			d.Message = fmt.Sprintf("%s was ingested at %s, which is in the future", graph.Node.Value(), graph.Modified.Format(time.RFC3339))
+			return d
+		}
+	}
+
+	d.OK, d.Message = true, "no ingestion times are in the future"
+	return d
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package styx
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, ErrUnsupportedPlatform
+}
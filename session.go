@@ -0,0 +1,41 @@
+package styx
+
+import (
+	"context"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Querier runs queries. Both Store and the Querier passed to the function
+// given to Store.Read implement it.
+type Querier interface {
+	Query(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term) (*Iterator, error)
+	QueryWithOptions(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error)
+	QueryContext(ctx context.Context, pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error)
+}
+
+type snapshot struct {
+	store *Store
+	txn   KVTxn
+}
+
+// Read calls f with a Querier whose queries all read from the same snapshot of the
+// store, so they see a consistent state while concurrent writes proceed. The iterators
+// it returns have to be closed before f returns, and results are never cached.
+func (s *Store) Read(f func(q Querier) error) error {
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+	return f(&snapshot{store: s, txn: txn})
+}
+
+func (q *snapshot) Query(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term) (*Iterator, error) {
+	return q.QueryWithOptions(pattern, domain, index, nil)
+}
+
+func (q *snapshot) QueryWithOptions(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	return q.QueryContext(context.Background(), pattern, domain, index, opts)
+}
+
+func (q *snapshot) QueryContext(ctx context.Context, pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	return q.store.query(ctx, q.txn, pattern, domain, index, opts)
+}
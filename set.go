@@ -1,9 +1,11 @@
 package styx
 
 import (
+	"context"
+	"crypto/ed25519"
+	"sort"
 	"strings"
 
-	badger "github.com/dgraph-io/badger/v2"
 	ld "github.com/piprate/json-gold/ld"
 	rdf "github.com/underlay/go-rdfjs"
 )
@@ -15,7 +17,7 @@ func (s *Store) SetJSONLD(uri string, input interface{}, canonize bool) error {
 		node = rdf.NewNamedNode(uri)
 	}
 
-	opts := ld.NewJsonLdOptions(uri)
+	opts := s.jsonldOptions(uri)
 	dataset, err := getDataset(input, opts)
 	if err != nil {
 		return err
@@ -36,16 +38,134 @@ func (s *Store) SetJSONLD(uri string, input interface{}, canonize bool) error {
 }
 
 // Set is the entrypoint to inserting stuff
-func (s *Store) Set(node rdf.Term, dataset []*rdf.Quad) (err error) {
+func (s *Store) Set(node rdf.Term, dataset []*rdf.Quad) error {
+	return s.SetContext(context.Background(), node, dataset)
+}
+
+// SetContext is like Set, but stops inserting and fails with the context's error once
+// it is cancelled. Small datasets are inserted in a single transaction that is discarded
+// on cancellation; datasets too large for one transaction may be partially committed.
+func (s *Store) SetContext(ctx context.Context, node rdf.Term, dataset []*rdf.Quad) error {
+	_, err := s.write(ctx, node, dataset, false, nil)
+	return err
+}
+
+// SetWithReport inserts a dataset like Set, and also returns the report of the store's
+// detection rules. If any rule rejected the dataset, the error is ErrRejected.
+func (s *Store) SetWithReport(node rdf.Term, dataset []*rdf.Quad) (*Report, error) {
+	return s.write(context.Background(), node, dataset, false, nil)
+}
+
+// Update replaces a dataset like Set, but also removes the quads of the previous version
+// when the store's QuadStore doesn't keep datasets (like the default empty store) by
+// recovering them from the provenance in the triple index. This scans the whole index,
+// and stops like SetContext once the context is done.
+func (s *Store) Update(ctx context.Context, node rdf.Term, dataset []*rdf.Quad) error {
+	_, err := s.write(ctx, node, dataset, true, nil)
+	return err
+}
+
+func (s *Store) write(ctx context.Context, node rdf.Term, dataset []*rdf.Quad, scan bool, signer ed25519.PublicKey) (*Report, error) {
+	if signer == nil && len(s.Config.Signers) > 0 {
+		return nil, ErrUnsigned
+	}
+
+	dataset, err := s.preIngest(node, dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	dataset, report := s.detect(node, dataset)
+	if report.Rejected {
+		return report, ErrRejected
+	}
+
+	err = s.ingest(ctx, node, dataset, scan, signer)
+	if err != nil {
+		return report, err
+	}
+
+	// Post-ingest hooks run after the writer lock is released, so they can write to the store
+	s.postIngest(node, dataset)
+	return report, nil
+}
+
+// ingest inserts a dataset that has passed the hooks and detectors while holding the writer lock
+func (s *Store) ingest(ctx context.Context, node rdf.Term, dataset []*rdf.Quad, scan bool, signer ed25519.PublicKey) (err error) {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	var previous []*rdf.Quad
+	if s.Config.History {
+		previous, err = s.Get(node)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	var removed []*rdf.Quad
+	err = retry(func() (err error) {
+		removed, err = s.set(ctx, node, dataset, scan, signer, false)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.Config.History {
+		err = s.recordHistory(node, previous, dataset)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.logChange("set", node, len(dataset))
+	if err != nil {
+		return err
+	}
+
+	err = s.propagate(ctx, node, removed, dataset)
+	if err != nil {
+		return err
+	}
+
+	s.notify(node, dataset)
+	return nil
+}
+
+// propagate updates the cached results, entailments, views and subscriptions
+// that depend on the quads that a write to a dataset removed and added.
+// It runs with the writer lock held.
+func (s *Store) propagate(ctx context.Context, node rdf.Term, removed, added []*rdf.Quad) error {
+	// Cached queries over the removed quads are stale too
+	s.results.invalidate(append(removed, added...))
+
+	if s.Config.Inference != nil || s.Config.SameAs != nil {
+		err := s.entail(ctx, node, removed, added)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.refreshViews(node, removed, added)
+	if err != nil {
+		return err
+	}
+
+	return s.publish(node, removed, added)
+}
+
+// set replaces the quads of a dataset, and returns the quads that it replaced
+func (s *Store) set(ctx context.Context, node rdf.Term, dataset []*rdf.Quad, scan bool, signer ed25519.PublicKey, internal bool) (removed []*rdf.Quad, err error) {
 	if node.TermType() == rdf.NamedNodeType {
 		uri := node.Value()
 		if strings.Index(uri, "#") != -1 || !s.Config.TagScheme.Test(uri+"#") {
-			return ErrTagScheme
+			return nil, ErrTagScheme
 		}
 	}
 
 	dictionary := s.Config.Dictionary.Open(true)
-	txn := s.Badger.NewTransaction(true)
+	txn := s.KV.NewTransaction(true)
 	defer func() { txn.Discard(); dictionary.Commit() }()
 
 	uc := newUnaryCache()
@@ -56,11 +176,51 @@ func (s *Store) Set(node rdf.Term, dataset []*rdf.Quad) (err error) {
 		return
 	}
 
+	previous, err := getDatasetUsage(origin, txn)
+	if err != nil {
+		return
+	}
+
+	// The datasets that the store writes itself are exempt from the quota
+	usage := getUsage(dataset)
+	if !internal {
+		err = s.checkQuota(previous, usage, signer, txn)
+		if err != nil {
+			return
+		}
+	}
+
 	quads, err := s.Config.QuadStore.Get(origin)
 	if err != nil && err != ErrNotFound {
 		return
-	} else if quads != nil {
-		txn, err = deleteQuads(origin, quads, dictionary, txn, s.Badger)
+	} else if quads == nil && scan && previous.usage != nil && previous.usage.Quads > 0 {
+		// Only scan the index for datasets that have a previous version
+		quads, err = scanQuads(ctx, origin, txn)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(quads) > 0 {
+		removed, err = getQuadTerms(quads, dictionary, node)
+		if err != nil {
+			return
+		}
+
+		txn, err = deleteQuads(origin, quads, dictionary, txn, s.KV, s.Config.Checksums)
+		if err != nil {
+			return
+		}
+
+		txn, err = indexQuantities(origin, quads, dictionary, node, true, txn, s.KV)
+		if err != nil {
+			return
+		}
+		txn, err = indexGeometries(origin, quads, dictionary, node, true, txn, s.KV)
+		if err != nil {
+			return
+		}
+		txn, err = indexLanguages(quads, true, txn, s.KV)
 		if err != nil {
 			return
 		}
@@ -70,9 +230,11 @@ func (s *Store) Set(node rdf.Term, dataset []*rdf.Quad) (err error) {
 
 	var terms [3]ID
 	var id ID
-	var item *badger.Item
-	var val []byte
 	for i, quad := range dataset {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
 		source := &Statement{
 			base:  iri(origin),
 			index: uint64(i),
@@ -98,50 +260,42 @@ func (s *Store) Set(node rdf.Term, dataset []*rdf.Quad) (err error) {
 			}
 		}
 
-		for p := Permutation(0); p < 3; p++ {
-			a, b, c := major.permute(p, terms)
-			key := assembleKey(TernaryPrefixes[p], false, a, b, c)
-			item, err = txn.Get(key)
-			if err == badger.ErrKeyNotFound {
-				// Since this is a new key we have to increment two binary keys.
-				ab, ba := p, ((p+1)%3)+3
-				err = bc.Increment(ab, a, b, uc, txn)
-				if err != nil {
-					return
-				}
-				err = bc.Increment(ba, b, a, uc, txn)
-				if err != nil {
-					return
-				}
-				if p == 0 {
-					val = []byte(source.String())
-				}
-				txn, err = setSafe(key, val, txn, s.Badger)
-				if err != nil {
-					return
-				}
-			} else if err != nil {
-				return
-			} else if p == 0 {
-				val, err = item.ValueCopy(nil)
-				if err != nil {
-					return
-				}
-				val = append(val, source.String()...)
-				txn, err = setSafe(key, val, txn, s.Badger)
-				if err != nil {
-					return
-				}
-			}
+		txn, err = insertStatement(terms, source, bc, uc, txn, s.KV, s.Config.Checksums)
+		if err != nil {
+			return
 		}
 	}
 
-	txn, err = bc.Commit(s.Badger, txn)
+	txn, err = indexQuantities(origin, quads, dictionary, node, false, txn, s.KV)
+	if err != nil {
+		return
+	}
+	txn, err = indexGeometries(origin, quads, dictionary, node, false, txn, s.KV)
+	if err != nil {
+		return
+	}
+	txn, err = indexLanguages(quads, false, txn, s.KV)
+	if err != nil {
+		return
+	}
+
+	txn, err = setUsage(origin, previous, usage, signer, txn, s.KV)
+	if err != nil {
+		return
+	}
+
+	txn, err = bc.Commit(s.KV, txn, s.Config.Checksums)
+	if err != nil {
+		return
+	}
+
+	txn, err = uc.Commit(s.KV, txn, s.Config.Checksums)
 	if err != nil {
 		return
 	}
 
-	txn, err = uc.Commit(s.Badger, txn)
+	// New terms are committed to the dictionary before the index keys that reference them
+	err = dictionary.Commit()
 	if err != nil {
 		return
 	}
@@ -151,5 +305,117 @@ func (s *Store) Set(node rdf.Term, dataset []*rdf.Quad) (err error) {
 		return
 	}
 
-	return s.Config.QuadStore.Set(origin, quads)
+	err = s.Config.QuadStore.Set(origin, quads)
+	return
+}
+
+// insertStatement adds a statement to the ternary keys of a triple. Triples that are
+// new to the index also increment their binary counts.
+func insertStatement(terms [3]ID, source *Statement, bc binaryCache, uc unaryCache, t KVTxn, db KV, checksums bool) (txn KVTxn, err error) {
+	txn = t
+	var item KVItem
+	var val []byte
+	for p := Permutation(0); p < 3; p++ {
+		a, b, c := major.permute(p, terms)
+		key := assembleKey(TernaryPrefixes[p], false, a, b, c)
+		item, err = txn.Get(key)
+		if err == ErrKeyNotFound {
+			// Since this is a new key we have to increment two binary keys.
+			ab, ba := p, ((p+1)%3)+3
+			err = bc.Increment(ab, a, b, uc, txn)
+			if err != nil {
+				return
+			}
+			err = bc.Increment(ba, b, a, uc, txn)
+			if err != nil {
+				return
+			}
+			if p == 0 {
+				val = []byte(source.String())
+				if checksums {
+					val = sealStatements(val)
+				}
+			}
+			txn, err = setSafe(key, val, txn, db)
+			if err != nil {
+				return
+			}
+		} else if err != nil {
+			return
+		} else if p == 0 {
+			statement := source.String()
+			err = item.Value(func(v []byte) error {
+				v, err := openStatements(v)
+				if err != nil {
+					return err
+				}
+				val = make([]byte, len(v), len(v)+len(statement)+checksumLength)
+				copy(val, v)
+				val = append(val, statement...)
+				if checksums {
+					val = sealStatements(val)
+				}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+			txn, err = setSafe(key, val, txn, db)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// scanQuads recovers the quads of a dataset, in their original order, from the
+// provenance statements of the SPO triple index, until the context is done.
+func scanQuads(ctx context.Context, origin ID, txn KVTxn) ([][4]ID, error) {
+	prefix := []byte{TernaryPrefixes[0]}
+	iter := txn.NewIterator(KVIteratorOptions{
+		PrefetchValues: true,
+		Prefix:         prefix,
+	})
+	defer iter.Close()
+
+	indices := map[uint64][4]ID{}
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		item := iter.Item()
+		var statements []*Statement
+		err := item.Value(func(val []byte) (err error) {
+			statements, err = getStatements(val)
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		terms := strings.Split(string(item.Key()[1:]), "\t")
+		if len(terms) != 3 {
+			continue
+		}
+
+		for _, statement := range statements {
+			if statement != nil && ID(statement.base) == origin {
+				indices[statement.index] = [4]ID{ID(terms[0]), ID(terms[1]), ID(terms[2]), statement.graph}
+			}
+		}
+	}
+
+	keys := make([]uint64, 0, len(indices))
+	for index := range indices {
+		keys = append(keys, index)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+
+	quads := make([][4]ID, len(keys))
+	for i, index := range keys {
+		quads[i] = indices[index]
+	}
+	return quads, nil
 }
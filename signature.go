@@ -0,0 +1,49 @@
+package styx
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// SigningMessage returns the message that dataset signatures are made over:
+// the dataset's sorted, de-duplicated N-Quads, one per line
+func SigningMessage(dataset []*rdf.Quad) []byte {
+	return canonicalNQuads(sortQuads(dataset))
+}
+
+// SetSigned inserts a dataset like Set, after verifying its detached ed25519 signature
+// over SigningMessage(dataset). The key has to be one of the store's Config.Signers,
+// and is recorded as the Signer of the dataset's Sources.
+func (s *Store) SetSigned(node rdf.Term, dataset []*rdf.Quad, key ed25519.PublicKey, signature []byte) error {
+	if !s.trusted(key) {
+		return ErrUntrustedSigner
+	} else if !ed25519.Verify(key, SigningMessage(dataset), signature) {
+		return ErrInvalidSignature
+	}
+
+	_, err := s.write(context.Background(), node, dataset, false, key)
+	return err
+}
+
+func (s *Store) trusted(key ed25519.PublicKey) bool {
+	for _, signer := range s.Config.Signers {
+		if bytes.Equal(signer, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// getSigner returns the key that signed a dataset, or nil if it wasn't signed
+func getSigner(origin ID, txn KVTxn) (ed25519.PublicKey, error) {
+	item, err := txn.Get(assembleKey(SignerPrefix, false, origin))
+	if err == ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
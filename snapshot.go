@@ -0,0 +1,118 @@
+package styx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A Snapshot is the manifest of a checkpoint written by Store.Snapshot
+type Snapshot struct {
+	Name   string
+	Report *BackupReport
+}
+
+func (s *Store) snapshotPath(name, extension string) (string, error) {
+	if s.Config.SnapshotDir == "" {
+		return "", ErrNoSnapshotDir
+	} else if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return "", ErrInvalidSnapshot
+	}
+	return filepath.Join(s.Config.SnapshotDir, name+extension), nil
+}
+
+// Snapshot writes a full backup of the store and a manifest of its datasets to
+// Config.SnapshotDir under the given name, replacing any snapshot with the same name.
+// Writes are blocked while the snapshot is taken, so it is consistent.
+func (s *Store) Snapshot(name string) (*Snapshot, error) {
+	if s.Badger == nil {
+		return nil, ErrUnsupportedBackend
+	}
+
+	backup, err := s.snapshotPath(name, ".backup")
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, _ := s.snapshotPath(name, ".json")
+
+	err = os.MkdirAll(s.Config.SnapshotDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	// The backup is written to a temporary file first so that a failed
+	// snapshot doesn't replace a previous one with the same name
+	f, err := ioutil.TempFile(s.Config.SnapshotDir, name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(f.Name())
+
+	_, err = s.Badger.Backup(f, 0)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := s.report()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{Name: name, Report: report}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(f.Name(), backup)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, ioutil.WriteFile(manifest, data, 0644)
+}
+
+// Rollback replaces the entire contents of the store with a snapshot
+func (s *Store) Rollback(name string) error {
+	if s.Badger == nil {
+		return ErrUnsupportedBackend
+	}
+
+	backup, err := s.snapshotPath(name, ".backup")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(backup)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	err = s.Badger.DropAll()
+	if err != nil {
+		return err
+	}
+
+	s.lastChange = 0
+	return s.loadBackup(f)
+}
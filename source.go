@@ -0,0 +1,111 @@
+package styx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// MaxFetchSize is the largest response body that Watch and Crawl read
+const MaxFetchSize = 16 << 20
+
+// Watch keeps a dataset in sync with a mutable HTTP source. It fetches the URL
+// immediately and then every interval, and replaces the dataset whenever the
+// response body changes. Sources are parsed as N-Quads or, if served with a
+// JSON content type, as JSON-LD. Watch blocks until the context is cancelled.
+// The interval has to be positive, or Watch fails with ErrInvalidInterval.
+func (s *Store) Watch(ctx context.Context, node rdf.Term, url string, interval time.Duration) error {
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last [sha256.Size]byte
+	for {
+		body, contentType, err := fetch(ctx, url)
+		if err != nil {
+			s.Config.Logger.Warn("Fetching source failed", Field{"url", url}, Field{"error", err})
+		} else if sum := sha256.Sum256(body); sum != last {
+			dataset, err := s.parseSource(url, body, contentType)
+			if err == nil {
+				_, err = s.write(ctx, node, dataset, true, nil)
+			}
+			if err != nil {
+				s.Config.Logger.Warn("Ingesting source failed", Field{"url", url}, Field{"error", err})
+			} else {
+				last = sum
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func fetch(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.Header.Set("Accept", "application/n-quads, application/ld+json;q=0.9")
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, "", ErrFetchFailed
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxFetchSize+1))
+	if err != nil {
+		return nil, "", err
+	} else if len(body) > MaxFetchSize {
+		return nil, "", ErrFetchTooLarge
+	}
+	return body, res.Header.Get("Content-Type"), nil
+}
+
+func (s *Store) parseSource(url string, body []byte, contentType string) ([]*rdf.Quad, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/ld+json" || mediaType == "application/json" {
+		dataset, err := getDataset(body, s.jsonldOptions(url))
+		if err != nil {
+			return nil, err
+		}
+		return fromLdDataset(dataset, ""), nil
+	}
+
+	dataset := []*rdf.Quad{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		quad := rdf.ParseQuad(line)
+		if quad == nil {
+			return nil, ErrInvalidInput
+		}
+		dataset = append(dataset, quad)
+	}
+
+	return dataset, scanner.Err()
+}
@@ -0,0 +1,83 @@
+package styx
+
+import (
+	"crypto/ed25519"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Source is a quad in a dataset that asserts a triple
+type Source struct {
+	Dataset rdf.Term
+	Index   uint64
+	Graph   rdf.Term
+	// Signer is the key that signed the dataset, if it was inserted with SetSigned
+	Signer ed25519.PublicKey
+}
+
+// Sources returns every quad that asserts the given triple, across all datasets.
+// The terms have to be IRIs or literals, since blank nodes are scoped to their datasets.
+func (s *Store) Sources(subject, predicate, object rdf.Term) ([]*Source, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	var ids [3]ID
+	for i, term := range []rdf.Term{subject, predicate, object} {
+		if t := term.TermType(); t != rdf.NamedNodeType && t != rdf.LiteralType {
+			return nil, ErrInvalidInput
+		}
+
+		id, err := dictionary.GetID(term, rdf.Default)
+		if err == ErrNotFound {
+			return []*Source{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(assembleKey(TernaryPrefixes[0], false, ids[0], ids[1], ids[2]))
+	if err == ErrKeyNotFound {
+		return []*Source{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var statements []*Statement
+	err = item.Value(func(val []byte) (err error) {
+		statements, err = getStatements(val)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]*Source, 0, len(statements))
+	for _, statement := range statements {
+		if statement == nil {
+			continue
+		}
+
+		dataset, err := dictionary.GetTerm(ID(statement.base), rdf.Default)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := getSigner(ID(statement.base), txn)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, &Source{
+			Dataset: dataset,
+			Index:   statement.index,
+			Graph:   statement.Graph(dictionary),
+			Signer:  signer,
+		})
+	}
+
+	return sources, nil
+}
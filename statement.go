@@ -39,6 +39,11 @@ func (statement *Statement) Graph(dictionary Dictionary) rdf.Term {
 }
 
 func getStatements(val []byte) ([]*Statement, error) {
+	val, err := openStatements(val)
+	if err != nil {
+		return nil, err
+	}
+
 	lines := strings.Split(string(val), "\n")
 	if len(lines) < 2 {
 		return nil, nil
@@ -47,16 +52,17 @@ func getStatements(val []byte) ([]*Statement, error) {
 	statements := make([]*Statement, len(lines)-1)
 	for i, line := range lines[:len(lines)-1] {
 		terms := strings.Split(line, "\t")
-		if len(terms) == 3 {
-			index, err := strconv.ParseUint(string(terms[1]), 32, 64)
-			if err != nil {
-				return nil, err
-			}
-			statements[i] = &Statement{
-				base:  iri(terms[0]),
-				index: index,
-				graph: ID(terms[2]),
-			}
+		if len(terms) != 3 {
+			return nil, ErrCorruptIndex
+		}
+		index, err := strconv.ParseUint(string(terms[1]), 32, 64)
+		if err != nil {
+			return nil, ErrCorruptIndex
+		}
+		statements[i] = &Statement{
+			base:  iri(terms[0]),
+			index: index,
+			graph: ID(terms[2]),
 		}
 	}
 
@@ -0,0 +1,135 @@
+package styx
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// PredicateStats are the counts the query planner sees for a single predicate
+type PredicateStats struct {
+	Predicate        rdf.Term
+	Triples          uint64
+	DistinctSubjects uint32
+	DistinctObjects  uint32
+}
+
+// PeerUsage is the usage of the datasets signed by a key
+type PeerUsage struct {
+	Key ed25519.PublicKey
+	Usage
+}
+
+// Stats summarize the store's indices
+type Stats struct {
+	Triples    uint64
+	Terms      uint64 // The number of distinct terms in any position
+	LSMSize    int64
+	VlogSize   int64
+	Predicates []*PredicateStats
+	Usage      *Usage
+	Peers      []*PeerUsage
+}
+
+// Stats returns per-predicate counts derived from the unary and binary counters,
+// ordered by number of triples, along with the total sizes of the indices
+// and the usage of the whole store and of each signer.
+func (s *Store) Stats() (*Stats, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	stats := &Stats{Predicates: []*PredicateStats{}, Peers: []*PeerUsage{}}
+	if s.Badger != nil {
+		stats.LSMSize, stats.VlogSize = s.Badger.Size()
+	}
+
+	usage, err := getTotalUsage(txn)
+	if err != nil {
+		return nil, err
+	}
+	stats.Usage = usage
+
+	prefix := []byte{PeerPrefix}
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		usage, err := parseUsage(item)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		key := ed25519.PublicKey(item.KeyCopy(nil)[1:])
+		stats.Peers = append(stats.Peers, &PeerUsage{Key: key, Usage: *usage})
+	}
+	iter.Close()
+
+	predicates := map[ID]*PredicateStats{}
+	prefix = []byte{UnaryPrefix}
+	iter = txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		index, err := getUnaryIndex(item)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		stats.Terms++
+		if index[POS] > 0 {
+			id := ID(item.KeyCopy(nil)[1:])
+			predicates[id] = &PredicateStats{DistinctObjects: index[POS], DistinctSubjects: index[PSO]}
+		}
+	}
+	iter.Close()
+
+	// The (predicate, object) binary keys count the triples with each predicate
+	prefix = []byte{BinaryPrefixes[POS]}
+	iter = txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer iter.Close()
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		key := string(item.Key()[1:])
+		i := strings.IndexByte(key, '\t')
+		if i == -1 {
+			return nil, ErrCorruptIndex
+		}
+
+		p := predicates[ID(key[:i])]
+		if p == nil {
+			continue
+		}
+
+		err := item.Value(func(val []byte) (err error) {
+			val, err = openCounts(val, 1)
+			if err == nil {
+				p.Triples += uint64(binary.BigEndian.Uint32(val))
+			}
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for id, p := range predicates {
+		term, err := dictionary.GetTerm(id, rdf.Default)
+		if err != nil {
+			return nil, err
+		}
+		p.Predicate = term
+		stats.Triples += p.Triples
+		stats.Predicates = append(stats.Predicates, p)
+	}
+
+	sort.Slice(stats.Predicates, func(a, b int) bool {
+		return stats.Predicates[a].Triples > stats.Predicates[b].Triples
+	})
+
+	return stats, nil
+}
@@ -106,18 +106,21 @@ func (m *memoryStore) List(id ID) interface {
 	return &memoryList{i, m}
 }
 
-type badgerStore struct{ Badger *badger.DB }
+type badgerStore struct{ kv KV }
 
 // MakeBadgerStore creates new badger quad store
-func MakeBadgerStore(db *badger.DB) QuadStore { return &badgerStore{Badger: db} }
+func MakeBadgerStore(db *badger.DB) QuadStore { return &badgerStore{kv: BadgerKV(db)} }
+
+// MakeKVStore creates a quad store in any KV
+func MakeKVStore(kv KV) QuadStore { return &badgerStore{kv: kv} }
 
 func (b *badgerStore) Get(id ID) ([][4]ID, error) {
-	txn := b.Badger.NewTransaction(false)
+	txn := b.kv.NewTransaction(false)
 	defer func() { txn.Discard() }()
 
 	key := assembleKey(DatasetPrefix, false, id)
 	item, err := txn.Get(key)
-	if err == badger.ErrKeyNotFound {
+	if err == ErrKeyNotFound {
 		return nil, ErrNotFound
 	} else if err != nil {
 		return nil, err
@@ -129,13 +132,14 @@ func (b *badgerStore) Get(id ID) ([][4]ID, error) {
 // ErrParseQuads indicates that a TSV of quads could not be parsed
 var ErrParseQuads = errors.New("Error parsing quads from Badger datastore")
 
-func getQuads(item *badger.Item) (quads [][4]ID, err error) {
+func getQuads(item KVItem) (quads [][4]ID, err error) {
 	err = item.Value(func(val []byte) error {
-		lines := strings.Split(string(val), "\n")
-		if len(lines) < 2 {
-			return ErrParseQuads
+		if len(val) == 0 {
+			return nil
 		}
 
+		lines := strings.Split(string(val), "\n")
+
 		quads = make([][4]ID, len(lines))
 		for i, line := range lines {
 			terms := strings.Split(line, "\t")
@@ -156,7 +160,7 @@ func getQuads(item *badger.Item) (quads [][4]ID, err error) {
 
 func (b *badgerStore) Delete(id ID) (err error) {
 	key := assembleKey(DatasetPrefix, false, id)
-	return b.Badger.Update(func(txn *badger.Txn) error { return txn.Delete(key) })
+	return updateTxn(b.kv, func(txn KVTxn) error { return txn.Delete(key) })
 }
 
 func (b *badgerStore) Set(id ID, quads [][4]ID) error {
@@ -170,12 +174,12 @@ func (b *badgerStore) Set(id ID, quads [][4]ID) error {
 	}
 	val := strings.Join(lines, "\n")
 	key := assembleKey(DatasetPrefix, false, id)
-	return b.Badger.Update(func(txn *badger.Txn) error { return txn.Set(key, []byte(val)) })
+	return updateTxn(b.kv, func(txn KVTxn) error { return txn.Set(key, []byte(val)) })
 }
 
 type badgerList struct {
-	txn  *badger.Txn
-	iter *badger.Iterator
+	txn  KVTxn
+	iter KVIterator
 }
 
 func (bl *badgerList) Close() { bl.iter.Close(); bl.txn.Discard() }
@@ -193,8 +197,8 @@ func (b *badgerStore) List(id ID) interface {
 	Close()
 } {
 	key := assembleKey(DatasetPrefix, false, id)
-	txn := b.Badger.NewTransaction(false)
-	iter := txn.NewIterator(badger.IteratorOptions{
+	txn := b.kv.NewTransaction(false)
+	iter := txn.NewIterator(KVIteratorOptions{
 		PrefetchValues: false,
 		Prefix:         []byte{DatasetPrefix},
 	})
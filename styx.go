@@ -2,9 +2,15 @@ package styx
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/binary"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v2"
 	uuid "github.com/google/uuid"
@@ -13,13 +19,28 @@ import (
 	rdf "github.com/underlay/go-rdfjs"
 )
 
-// DefaultPath is the default path for the Badger database
-const tmpPath = "/tmp/styx"
+// tmpPath is the default path for the Badger database
+var tmpPath = filepath.Join(os.TempDir(), "styx")
 
 // A Store is a database instance
 type Store struct {
+	// KV is the store that the database is kept in
+	KV KV
+	// Badger is the badger database of stores opened with NewStore, and nil otherwise
 	Badger *badger.DB
 	Config *Config
+
+	// writer serializes writes, since the index counters are read-modify-write
+	writer        sync.Mutex
+	lock          sync.Mutex
+	subscriptions map[*subscription]bool
+	webhooks      map[*Webhook]bool
+	hooks         []*ingestHooks
+	lastChange    uint64
+	gc            GCStats
+	results       resultCache
+	closed        chan struct{}
+	shutdown      bool
 }
 
 // Config contains the initialization options passed to Styx
@@ -27,6 +48,47 @@ type Config struct {
 	TagScheme  TagScheme
 	Dictionary DictionaryFactory
 	QuadStore  QuadStore
+	Pipeline   []TransformerFactory
+	Policies   []Policy
+	Detectors  []DetectionRule
+	Quota      *Quota
+	Meter      Meter
+	Limits     *Limits
+	Logger     Logger
+	// DocumentLoader loads the remote contexts of JSON-LD documents
+	DocumentLoader ld.DocumentLoader
+	// GraphQLContext is the JSON-LD @context that the field names of GraphQL queries are
+	// expanded with, like a map of terms or the URL of a context document
+	GraphQLContext interface{}
+	// Inference is the dataset that RDFS entailments are materialized in after every write,
+	// so that Sources of inferred triples have it as their Dataset. Nil disables inference.
+	Inference rdf.Term
+	// SameAs is the dataset that the triples of nodes linked by owl:sameAs are copied to
+	// after every write, so that every node in a sameAs set has the triples of all of them.
+	// Nil disables sameAs resolution.
+	SameAs rdf.Term
+	// History records when each dataset asserts and retracts each triple, for Store.History
+	History bool
+	// Checksums stores a checksum with every index value that the store writes,
+	// so that reading a corrupted value fails with ErrChecksum
+	Checksums bool
+	// Dir is the directory the database was opened in, which SelfTest checks for free
+	// space. It is empty for stores in memory.
+	Dir string
+	// SnapshotDir is the directory that Snapshot writes checkpoints to
+	SnapshotDir string
+	// QueryTTL is how long queries registered with RegisterQuery are kept. Zero keeps them.
+	QueryTTL time.Duration
+	// Signers are the keys that can sign datasets inserted with SetSigned.
+	// If any are given, datasets can only be inserted with SetSigned.
+	Signers []ed25519.PublicKey
+	// GCInterval is how often the value log is garbage collected in the background.
+	// Zero disables background collection.
+	GCInterval     time.Duration
+	GCDiscardRatio float64
+	// KeyLayout is the layout of the index keys of a new store. Stores keep the layout
+	// they were created with, and it's set to that layout when they're opened.
+	KeyLayout KeyLayout
 }
 
 // Close the database
@@ -35,6 +97,11 @@ func (s *Store) Close() (err error) {
 		return
 	}
 
+	if s.closed != nil {
+		// This blocks until the background collector is between runs
+		s.closed <- struct{}{}
+	}
+
 	if s.Config.Dictionary != nil {
 		err = s.Config.Dictionary.Close()
 		if err != nil {
@@ -42,8 +109,9 @@ func (s *Store) Close() (err error) {
 		}
 	}
 
-	if s.Badger != nil {
-		err = s.Badger.Close()
+	if s.KV != nil {
+		s.shutdown = true
+		err = s.KV.Close()
 		if err != nil {
 			return
 		}
@@ -61,8 +129,27 @@ func NewMemoryStore(config *Config) (*Store, error) {
 	return NewStore(config, db)
 }
 
-// NewStore opens a styx database
+// NewStore opens a styx database. A badger database holds a single store: its keys
+// aren't namespaced, so separate stores (like one per tenant) need separate databases.
 func NewStore(config *Config, db *badger.DB) (*Store, error) {
+	store, err := NewStoreKV(config, BadgerKV(db))
+	if err != nil {
+		return nil, err
+	}
+
+	store.Badger = db
+	if store.Config.GCInterval > 0 {
+		store.closed = make(chan struct{})
+		go store.collect(store.Config.GCInterval, store.Config.GCDiscardRatio)
+	}
+
+	return store, nil
+}
+
+// NewStoreKV opens a styx database in any key/value store. Stores opened this way
+// can't be backed up, snapshotted, or garbage collected, even with BadgerKV,
+// and compacting them only deletes the unused keys.
+func NewStoreKV(config *Config, kv KV) (*Store, error) {
 	if config == nil {
 		config = &Config{}
 	}
@@ -79,40 +166,202 @@ func NewStore(config *Config, db *badger.DB) (*Store, error) {
 		config.QuadStore = MakeEmptyStore()
 	}
 
-	return &Store{
-		Config: config,
-		Badger: db,
-	}, nil
+	if config.Logger == nil {
+		config.Logger = StdLogger
+	}
+
+	if config.DocumentLoader == nil {
+		config.DocumentLoader = ld.NewDefaultDocumentLoader(nil)
+	}
+
+	if config.GCDiscardRatio == 0 {
+		config.GCDiscardRatio = CompactDiscardRatio
+	}
+
+	kv, layout, err := openLayout(kv, config.KeyLayout)
+	if err != nil {
+		return nil, err
+	}
+	config.KeyLayout = layout
+
+	return &Store{KV: kv, Config: config}, nil
 }
 
-// QueryJSONLD exposes a JSON-LD query interface
+// QueryJSONLD exposes a JSON-LD query interface. Nodes with "?"-prefixed ids are
+// variables, value objects with a "@language" but no "@value" match any literal
+// in that language, and keys like ^knows or knows+ are inverse or transitive paths.
+// Variable names starting with "styx:" are reserved for the variables the query generates.
 func (s *Store) QueryJSONLD(query interface{}) (*Iterator, error) {
-	opts := ld.NewJsonLdOptions("")
+	return s.QueryJSONLDWithOptions(query, nil)
+}
+
+// QueryJSONLDWithOptions is like QueryJSONLD but takes additional per-query options
+func (s *Store) QueryJSONLDWithOptions(query interface{}, queryOpts *QueryOptions) (*Iterator, error) {
+	document, err := decodeDocument(query)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := s.jsonldOptions("")
 	opts.ProduceGeneralizedRdf = true
+	document, err = pathNames(document, ld.NewContext(nil, opts))
+	if err != nil {
+		return nil, err
+	}
+
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
-	base := "urn:uuid:" + id.String() + "?"
+	base, namespace := "urn:uuid:"+id.String()+"?", "urn:uuid:"+id.String()+"#"
+	document, hints := languageVariables(document, namespace, nil)
+
 	opts.ExpandContext = map[string]interface{}{"?": base}
-	dataset, err := getDataset(query, opts)
+	dataset, err := getDataset(document, opts)
 	if err != nil {
 		return nil, err
 	}
 	quads := fromLdDataset(dataset, base)
-	return s.Query(quads, nil, nil)
+	if err = generatedVariables(quads, namespace); err != nil {
+		return nil, err
+	}
+
+	options := &QueryOptions{}
+	if queryOpts != nil {
+		*options = *queryOpts
+	}
+	options.LanguageHints = append(options.LanguageHints, hints...)
+	return s.QueryWithOptions(quads, nil, nil, options)
+}
+
+// QueryOptions are per-query settings passed to QueryWithOptions
+type QueryOptions struct {
+	// Scopes lift the redaction policies with matching scopes
+	Scopes []string
+	// Languages are the preferred languages for language-tagged literals, best first.
+	// Solutions binding a literal in a worse language are dropped if the same subject
+	// and predicate have a literal in a better one.
+	Languages []string
+	// Types restrict variables to literals of a datatype, and narrow their index ranges
+	Types []TypeHint
+	// LanguageHints restrict variables to literals in a language, using the language index
+	LanguageHints []LanguageHint
+	// AsOf only considers the triples that datasets asserted at the given time, if it isn't zero
+	AsOf time.Time
+	// ValidAt only considers the triples that datasets asserted in graphs that are valid
+	// at the given time, if it isn't zero. See QueryValidAt.
+	ValidAt time.Time
+	// Limit is the maximum number of solutions the iterator returns. Once it is reached,
+	// Next returns nil and the index iterators are released, so the iterator can't be Seeked.
+	// Zero means no limit.
+	Limit int
+	// Offset is the number of solutions skipped before the first one returned
+	Offset int
+	// CacheResults caches the query's full result set until a write touches one of
+	// its predicates. Iterators over cached results can only Seek to the beginning,
+	// and don't have Sources. Queries with Scopes, Languages, Types, LanguageHints,
+	// AsOf, or ValidAt aren't cached.
+	CacheResults bool
+	// Timeout bounds how long the query may run, after which assembling it
+	// and advancing the iterator fail with ErrQueryTimeout. Zero means no timeout.
+	Timeout time.Duration
+	// Pipeline is applied to the solutions after the transformers of Config.Pipeline.
+	// Queries with a Pipeline aren't cached.
+	Pipeline []TransformerFactory
+	// Parallel solves the disconnected components of the pattern on separate goroutines,
+	// if it has more than one and no index or transitive paths. Iterators over parallel
+	// solutions can only Seek to the beginning, and don't have Sources.
+	Parallel bool
+	// Prefetch is the number of values each index iterator reads ahead. Solving a query
+	// only needs index keys and counts, so this only helps queries that read Sources
+	// for most solutions. Zero scans the indices key-only.
+	Prefetch int
 }
 
 // Query satisfies the Styx interface
 func (s *Store) Query(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term) (*Iterator, error) {
-	txn := s.Badger.NewTransaction(false)
+	return s.QueryWithOptions(pattern, domain, index, nil)
+}
+
+// QueryWithOptions is like Query but takes additional per-query options
+func (s *Store) QueryWithOptions(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	return s.QueryContext(context.Background(), pattern, domain, index, opts)
+}
+
+// QueryContext is like QueryWithOptions, but assembling the query and advancing
+// the returned iterator fail with the context's error once it is cancelled,
+// or with ErrQueryTimeout once its deadline passes.
+func (s *Store) QueryContext(ctx context.Context, pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	return s.query(ctx, nil, pattern, domain, index, opts)
+}
+
+// query assembles an iterator that reads from the given transaction, or from
+// a new one that the iterator discards when it is closed if txn is nil
+func (s *Store) query(ctx context.Context, txn KVTxn, pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term, opts *QueryOptions) (*Iterator, error) {
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+
+	err := s.Config.Limits.check(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cached results might be newer than the given transaction
+	if txn == nil && opts.CacheResults && len(opts.Scopes) == 0 && len(opts.Languages) == 0 && len(opts.Types) == 0 && len(opts.LanguageHints) == 0 && len(opts.Pipeline) == 0 && opts.AsOf.IsZero() && opts.ValidAt.IsZero() {
+		return s.cachedQuery(ctx, pattern, domain, index, opts)
+	}
+
+	pattern, paths := compilePaths(pattern)
+	if unboundPaths(pattern, paths) {
+		return s.expandPaths(ctx, txn, pattern, paths, domain, index, opts)
+	} else if opts.Parallel && len(paths) == 0 && len(index) == 0 {
+		if groups := components(pattern); len(groups) > 1 {
+			return s.queryComponents(ctx, txn, pattern, groups, domain, opts)
+		}
+	}
+
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	shared := txn != nil
+	if !shared {
+		txn = s.KV.NewTransaction(false)
+	}
+
 	dictionary := s.Config.Dictionary.Open(false)
-	iter, err := newIterator(pattern, domain, index, s.Config.TagScheme, txn, dictionary)
+	iter, err := newIterator(ctx, pattern, domain, index, s.Config.TagScheme, txn, dictionary, opts.Prefetch, opts.Types, opts.LanguageHints)
+	if iter == nil {
+		dictionary.Commit()
+		if !shared {
+			txn.Discard()
+		}
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+
+	iter.cancel, iter.shared = cancel, shared
 	if err != nil {
 		iter.Close()
+	} else {
+		if len(paths) > 0 {
+			filter, err := iter.pathFilter(paths)
+			if err != nil {
+				iter.Close()
+				return nil, err
+			}
+			iter.Pipe(filter)
+		}
+		s.pipe(iter, opts)
+		iter.meter = s.Config.Meter
+		iter.limit, iter.offset = opts.Limit, opts.Offset
 	}
 
-	if err == badger.ErrKeyNotFound || err == ErrEmptyInterset {
+	if err == ErrKeyNotFound || err == ErrEmptyInterset {
 		err = nil
 		iter.top = true
 	}
@@ -120,12 +369,62 @@ func (s *Store) Query(pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term)
 	return iter, err
 }
 
+// pipe sets up the filters, pipelines, and redactions of a query on its iterator
+func (s *Store) pipe(iter *Iterator, opts *QueryOptions) {
+	if !opts.AsOf.IsZero() {
+		iter.Pipe(asOfFilter(opts.AsOf, s.Config.History))
+	}
+	if !opts.ValidAt.IsZero() {
+		iter.Pipe(validAtFilter(opts.ValidAt))
+	}
+	if len(opts.Languages) > 0 {
+		iter.Pipe(languageFilter(opts.Languages))
+	}
+	for _, factory := range s.Config.Pipeline {
+		iter.Pipe(factory())
+	}
+	for _, factory := range opts.Pipeline {
+		iter.Pipe(factory())
+	}
+	iter.setRedactions(s.Config.Policies, opts.Scopes)
+}
+
+// internalQuery assembles an iterator for the store's own reads, like entailment,
+// without the limits, caching, timeouts, pipelines, redactions, or meter of query.
+func (s *Store) internalQuery(ctx context.Context, txn KVTxn, pattern []*rdf.Quad, domain []rdf.Term, index []rdf.Term) (*Iterator, error) {
+	shared := txn != nil
+	if !shared {
+		txn = s.KV.NewTransaction(false)
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	iter, err := newIterator(ctx, pattern, domain, index, s.Config.TagScheme, txn, dictionary, 0, nil, nil)
+	if iter == nil {
+		dictionary.Commit()
+		if !shared {
+			txn.Discard()
+		}
+		return nil, err
+	}
+
+	// Terms that aren't in the dictionary yet just have no solutions
+	iter.shared = shared
+	if err == ErrKeyNotFound || err == ErrEmptyInterset || err == ErrNotFound {
+		err = nil
+		iter.top = true
+	} else if err != nil {
+		iter.Close()
+	}
+
+	return iter, err
+}
+
 // Log will print the *entire database contents* to log
 func (s *Store) Log() {
-	txn := s.Badger.NewTransaction(false)
+	txn := s.KV.NewTransaction(false)
 	defer txn.Discard()
 
-	iter := txn.NewIterator(badger.DefaultIteratorOptions)
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: true, PrefetchSize: 100})
 	defer iter.Close()
 
 	var i int
@@ -177,15 +476,24 @@ func (s *Store) Log() {
 			)
 		} else if prefix == DatasetPrefix {
 			log.Printf("Dataset: %s\n", string(key[1:]))
+		} else if prefix == UsagePrefix && len(val) >= 16 {
+			log.Printf("Usage: %s -> %d quads, %d bytes\n", string(key[1:]), binary.BigEndian.Uint64(val[:8]), binary.BigEndian.Uint64(val[8:16]))
+		} else if prefix == QueryPrefix {
+			log.Printf("Query: %s%s -> %s\n", QueryURIScheme, string(key[1:]), string(val))
+		} else if prefix == ChangePrefix && len(key) == 9 {
+			log.Printf("Change: %s -> %s\n", time.Unix(0, int64(binary.BigEndian.Uint64(key[1:]))).Format(time.RFC3339Nano), string(val))
+		} else if prefix == ViewPrefix {
+			log.Printf("View: %s -> %s\n", string(key[1:]), string(val))
 		} else if prefix == UnaryPrefix {
-			if len(val) != 24 {
-				log.Println("Unexpected index value", val)
+			counts, err := openCounts(val, 6)
+			if err != nil {
+				log.Println("Unexpected index value", val, err)
 				return
 			}
 
 			index := &[6]uint32{}
 			for i := 0; i < 6; i++ {
-				index[i] = binary.BigEndian.Uint32(val[i*4 : (i+1)*4])
+				index[i] = binary.BigEndian.Uint32(counts[i*4 : (i+1)*4])
 			}
 			log.Println(
 				"Unary entry:",
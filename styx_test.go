@@ -1,10 +1,25 @@
 package styx
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dgraph-io/badger/v2"
 	rdf "github.com/underlay/go-rdfjs"
@@ -49,14 +64,23 @@ var document2 = `{
 }`
 
 func open() *Store {
-	fmt.Println("removing path", tmpPath)
-	err := os.RemoveAll(tmpPath)
+	return openWith(nil)
+}
+
+// openWith opens an empty store, letting configure change its config first
+func openWith(configure func(config *Config)) *Store {
+	return openAt(tmpPath, configure)
+}
+
+// openAt opens an empty store in the given directory
+func openAt(path string, configure func(config *Config)) *Store {
+	err := os.RemoveAll(path)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	// config := &Config{Path: tmpPath, TagScheme: tags, Dictionary: StringDictionary}
-	opt := badger.DefaultOptions(tmpPath)
+	opt := badger.DefaultOptions(path)
 	db, err := badger.Open(opt)
 	if err != nil {
 		log.Fatalln(err)
@@ -74,6 +98,10 @@ func open() *Store {
 		QuadStore:  MakeBadgerStore(db),
 	}
 
+	if configure != nil {
+		configure(config)
+	}
+
 	styx, err := NewStore(config, db)
 	if err != nil {
 		log.Fatalln(err)
@@ -329,3 +357,2093 @@ func TestIndexQuery(t *testing.T) {
 
 	iterator.Log()
 }
+
+func TestView(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	v0, v1 := rdf.NewVariable("v0"), rdf.NewVariable("v1")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	name := rdf.NewNamedNode("http://schema.org/name")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(v0, knows, v1, nil),
+		rdf.NewQuad(v1, name, rdf.NewBlankNode("b0"), nil),
+	}
+
+	view := rdf.NewNamedNode("http://example.com/view")
+	err = styx.SetView(view, pattern)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cursor, err := styx.View(view)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer cursor.Close()
+
+	subjects := map[string]bool{}
+	for index, err := cursor.Next(); index != nil; index, err = cursor.Next() {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		for i, term := range cursor.Domain() {
+			switch term.Value() {
+			case "v0":
+				subjects[index[i].String()] = true
+			case "v1":
+				if index[i].Value() != "http://people.com/jane" {
+					t.Errorf("Expected v1 to be jane, got %s", index[i].String())
+				}
+			case "b0":
+				if index[i].Value() != "Jane Doe" {
+					t.Errorf("Expected b0 to be Jane Doe, got %s", index[i].String())
+				}
+			}
+		}
+	}
+
+	if len(subjects) != 2 {
+		t.Errorf("Expected the view to bind v0 to both people who know jane, got %v", subjects)
+	}
+
+	quads, err := styx.Get(view)
+	if err != nil {
+		t.Error(err)
+	} else if len(quads) == 0 {
+		t.Error("Expected the view's dataset to have quads")
+	}
+}
+
+func TestViewMaintenance(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	v0, v1 := rdf.NewVariable("v0"), rdf.NewVariable("v1")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	name := rdf.NewNamedNode("http://schema.org/name")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(v0, knows, v1, nil),
+		rdf.NewQuad(v1, name, rdf.NewBlankNode("b0"), nil),
+	}
+
+	view := rdf.NewNamedNode("http://example.com/view")
+	err := styx.SetView(view, pattern)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, step := range []struct {
+		write    func() error
+		expected int
+	}{
+		{func() error { return styx.SetJSONLD(d1, document1, false) }, 1},
+		{func() error { return styx.SetJSONLD(d2, document2, false) }, 2},
+		// Replacing d2 with a dataset that doesn't know jane removes its binding
+		{func() error {
+			john := rdf.NewNamedNode("http://people.com/john")
+			return styx.Set(rdf.NewNamedNode(d2), []*rdf.Quad{
+				rdf.NewQuad(john, name, rdf.NewLiteral("John", "", nil), nil),
+			})
+		}, 1},
+		// Jane's name goes with d1, so the remaining binding is stale too
+		{func() error { return styx.Delete(rdf.NewNamedNode(d1)) }, 0},
+	} {
+		err = step.write()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if n := countViewBindings(t, styx, view); n != step.expected {
+			t.Errorf("Expected %d bindings in the view, got %d", step.expected, n)
+		}
+	}
+
+	quads, err := styx.Get(view)
+	if err != nil && err != ErrNotFound {
+		t.Error(err)
+	} else if len(quads) != 0 {
+		t.Errorf("Expected the view's dataset to be empty, got %v", quads)
+	}
+}
+
+func countViewBindings(t *testing.T, styx *Store, view rdf.Term) int {
+	cursor, err := styx.View(view)
+	if err != nil {
+		t.Error(err)
+		return -1
+	}
+
+	defer cursor.Close()
+
+	n := 0
+	index, err := cursor.Next()
+	for ; index != nil; index, err = cursor.Next() {
+		n++
+	}
+	if err != nil {
+		t.Error(err)
+	}
+	return n
+}
+
+func TestSubscribe(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	v0, v1 := rdf.NewVariable("v0"), rdf.NewVariable("v1")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	name := rdf.NewNamedNode("http://schema.org/name")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(v0, knows, v1, nil),
+		rdf.NewQuad(v1, name, rdf.NewBlankNode("b0"), nil),
+	}
+
+	results, cancel, err := styx.Subscribe(pattern)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer cancel()
+
+	for _, step := range []struct {
+		write    func() error
+		expected int
+	}{
+		{func() error { return styx.SetJSONLD(d1, document1, false) }, 1},
+		{func() error { return styx.SetJSONLD(d2, document2, false) }, 1},
+		// Writing the same solutions again doesn't send them again
+		{func() error { return styx.SetJSONLD(d2, document2, false) }, 0},
+		{func() error { return styx.Delete(rdf.NewNamedNode(d2)) }, 0},
+		// A solution that was removed is sent again when it re-appears
+		{func() error { return styx.SetJSONLD(d2, document2, false) }, 1},
+	} {
+		err = step.write()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if n := len(results); n != step.expected {
+			t.Errorf("Expected %d new solutions, got %d", step.expected, n)
+		}
+
+		for len(results) > 0 {
+			<-results
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	source := openAt(tmpPath+"-source", nil)
+	defer source.Close()
+
+	err := source.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Merged datasets skip the signers, which would reject unsigned writes
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	styx := openWith(func(config *Config) { config.Signers = []ed25519.PublicKey{public} })
+	defer styx.Close()
+
+	v0, v1 := rdf.NewVariable("v0"), rdf.NewVariable("v1")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	view := rdf.NewNamedNode("http://example.com/view")
+	err = styx.SetView(view, []*rdf.Quad{rdf.NewQuad(v0, knows, v1, nil)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.Merge(context.Background(), source)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected, err := source.Get(rdf.NewNamedNode(d1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	quads, err := styx.Get(rdf.NewNamedNode(d1))
+	if err != nil {
+		t.Error(err)
+	} else if len(quads) != len(expected) {
+		t.Errorf("Expected %d quads in the merged dataset, got %d", len(expected), len(quads))
+	}
+
+	if n := countViewBindings(t, styx, view); n != 1 {
+		t.Errorf("Expected the view to see the merged dataset, got %d bindings", n)
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	script := `<script type="application/ld+json">{"@context": {"@vocab": "http://schema.org/"}, "name": "%s"}</script>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, "<html>"+script+script+`<a href="/next">next</a></html>`, "A", "B")
+		case "/next":
+			fmt.Fprintf(w, "<html>"+script+"</html>", "C")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	node := func(page string) rdf.Term {
+		u, _ := url.Parse(page)
+		return rdf.NewNamedNode("http://example.com/crawl" + strings.Replace(u.Path, "/", "-", -1))
+	}
+
+	err := styx.Crawl(context.Background(), []string{server.URL + "/"}, &CrawlOptions{Node: node})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	name := rdf.NewNamedNode("http://schema.org/name")
+	for page, expected := range map[string]int{"/": 2, "/next": 1} {
+		quads, err := styx.Get(node(server.URL + page))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		// The blank nodes of separate script blocks stay distinct
+		subjects := map[string]bool{}
+		for _, quad := range quads {
+			if quad[1].Equal(name) {
+				subjects[quad[0].String()] = true
+			}
+		}
+		if len(subjects) != expected {
+			t.Errorf("Expected %d named nodes in %s, got %v", expected, page, quads)
+		}
+	}
+}
+
+func TestImportWikidata(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	dump := `[
+{"id": "Q1", "labels": {"en": {"language": "en", "value": "Universe"}}, "claims": {"P31": [{"rank": "normal", "mainsnak": {"snaktype": "value", "datavalue": {"type": "wikibase-entityid", "value": {"id": "Q2"}}}}]}},
+{"id": "Q2", "claims": {"P31": [{"rank": "deprecated", "mainsnak": {"snaktype": "value", "datavalue": {"type": "wikibase-entityid", "value": {"id": "Q1"}}}}], "P1": [{"rank": "normal", "mainsnak": {"snaktype": "somevalue"}}]}}
+]`
+
+	node := rdf.NewNamedNode("http://example.com/wikidata")
+	err := styx.ImportWikidata(context.Background(), node, strings.NewReader(dump))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Each entity is its own dataset, and claims without values are skipped
+	for id, expected := range map[string]int{"Q1": 2, "Q2": 0} {
+		quads, err := styx.Get(rdf.NewNamedNode(node.Value() + "/" + id))
+		if err != nil {
+			t.Error(err)
+		} else if len(quads) != expected {
+			t.Errorf("Expected %d quads for %s, got %v", expected, id, quads)
+		}
+	}
+
+	v0 := rdf.NewVariable("v0")
+	p31 := rdf.NewNamedNode("http://www.wikidata.org/prop/direct/P31")
+	q2 := rdf.NewNamedNode("http://www.wikidata.org/entity/Q2")
+	if n := countSolutions(t, styx, []*rdf.Quad{rdf.NewQuad(v0, p31, q2, nil)}, nil); n != 1 {
+		t.Errorf("Expected one instance of Q2, got %d", n)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	secret := []byte("secret")
+	events := make(chan *WebhookEvent, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("Expected a valid signature for %s", string(body))
+		}
+
+		event := &WebhookEvent{}
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Error(err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	pattern := []*rdf.Quad{rdf.NewQuad(rdf.NewVariable("v0"), knows, rdf.NewVariable("v1"), nil)}
+	for _, hook := range []*Webhook{
+		{URL: server.URL, Secret: secret},
+		{URL: server.URL, Secret: secret, Pattern: pattern},
+	} {
+		remove, err := styx.AddWebhook(hook)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer remove()
+	}
+
+	err := styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	received := map[string]*WebhookEvent{}
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received[event.Event] = event
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected ingest and match events, got %v", received)
+			return
+		}
+	}
+
+	if event := received["ingest"]; event.Dataset != d2 || event.Quads != 4 {
+		t.Errorf("Expected an ingest event for the four quads of d2, got %v", event)
+	}
+
+	if event := received["match"]; len(event.Solution) != 2 || event.Solution[1] != "<http://people.com/jane>" {
+		t.Errorf("Expected a match for someone who knows jane, got %v", event.Solution)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	source := openAt(tmpPath+"-source", nil)
+	defer source.Close()
+
+	err := source.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected, err := getStrings(source, d1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	backup := &bytes.Buffer{}
+	version, err := source.Backup(backup, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	styx := open()
+	defer styx.Close()
+
+	// Verifying a backup doesn't touch the store
+	report, err := styx.Restore(bytes.NewReader(backup.Bytes()), true)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if len(report.Graphs) != 1 || report.Graphs[0].Node.Value() != d1 || report.Version != version {
+		t.Errorf("Expected the backup to hold d1 at version %d, got %v", version, report)
+	} else if graphs, _ := styx.Graphs(context.Background()); len(graphs) != 0 {
+		t.Errorf("Expected a dry run to leave the store empty, got %v", graphs)
+	}
+
+	_, err = styx.Restore(bytes.NewReader(backup.Bytes()), false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// New writes mustn't reuse the IDs of the restored terms
+	err = styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	actual, err := getStrings(styx, d1)
+	if err != nil {
+		t.Error(err)
+	} else if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the restored dataset to match\n%v\ngot\n%v", expected, actual)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	styx := openWith(func(config *Config) { config.History = true })
+	defer styx.Close()
+
+	john := rdf.NewNamedNode("http://people.com/john")
+	mary := rdf.NewNamedNode("http://people.com/mary")
+	jane := rdf.NewNamedNode("http://people.com/jane")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	name := rdf.NewNamedNode("http://schema.org/name")
+
+	err := styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(john, knows, jane, nil)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.Set(rdf.NewNamedNode(d2), []*rdf.Quad{rdf.NewQuad(mary, knows, jane, nil)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	before := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	err = styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(john, name, rdf.NewLiteral("John", "", nil), nil)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assertions, err := styx.History(john, knows, jane)
+	if err != nil {
+		t.Error(err)
+	} else if len(assertions) != 1 || assertions[0].Dataset.Value() != d1 {
+		t.Errorf("Expected one assertion by d1, got %v", assertions)
+	} else if !assertions[0].Asserted.Before(before) || !assertions[0].Retracted.After(before) {
+		t.Errorf("Expected the assertion to be retracted after %v, got %v", before, assertions[0])
+	}
+
+	v0 := rdf.NewVariable("v0")
+	for _, c := range []struct {
+		pattern  *rdf.Quad
+		asOf     time.Time
+		expected int
+	}{
+		{rdf.NewQuad(v0, name, rdf.NewVariable("v1"), nil), before, 0},
+		{rdf.NewQuad(v0, name, rdf.NewVariable("v1"), nil), time.Now(), 1},
+		// Only current triples are searched, so john is missing
+		{rdf.NewQuad(v0, knows, jane, nil), before, 1},
+	} {
+		opts := &QueryOptions{AsOf: c.asOf}
+		if n := countSolutions(t, styx, []*rdf.Quad{c.pattern}, opts); n != c.expected {
+			t.Errorf("Expected %d solutions to %s as of %v, got %d", c.expected, c.pattern, c.asOf, n)
+		}
+	}
+}
+
+func TestValidTime(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	john := rdf.NewNamedNode("http://people.com/john")
+	mary := rdf.NewNamedNode("http://people.com/mary")
+	jane := rdf.NewNamedNode("http://people.com/jane")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	dateTime := rdf.NewNamedNode(xsdDateTime)
+
+	graph := rdf.NewBlankNode("g")
+	err := styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{
+		rdf.NewQuad(john, knows, jane, graph),
+		rdf.NewQuad(mary, knows, jane, nil),
+		rdf.NewQuad(graph, rdf.NewNamedNode("http://schema.org/validFrom"), rdf.NewLiteral("2000-01-01T00:00:00Z", "", dateTime), nil),
+		rdf.NewQuad(graph, rdf.NewNamedNode("http://schema.org/validThrough"), rdf.NewLiteral("2010-01-01T00:00:00Z", "", dateTime), nil),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	pattern := []*rdf.Quad{rdf.NewQuad(rdf.NewVariable("v0"), knows, jane, nil)}
+	for _, c := range []struct {
+		validAt  time.Time
+		expected int
+	}{
+		{time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC), 2},
+		{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 1},
+		{time.Time{}, 2},
+	} {
+		opts := &QueryOptions{ValidAt: c.validAt}
+		if n := countSolutions(t, styx, pattern, opts); n != c.expected {
+			t.Errorf("Expected %d solutions valid at %v, got %d", c.expected, c.validAt, n)
+		}
+	}
+}
+
+func TestCompactOrphans(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	john := rdf.NewNamedNode("http://people.com/john")
+	mary := rdf.NewNamedNode("http://people.com/mary")
+	jane := rdf.NewNamedNode("http://people.com/jane")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+
+	err := styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(mary, knows, jane, nil)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.Set(rdf.NewNamedNode(d2), []*rdf.Quad{rdf.NewQuad(john, knows, jane, nil)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.Delete(rdf.NewNamedNode(d1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.Compact()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Only mary no longer occurs anywhere in the index
+	dictionary := styx.Config.Dictionary.Open(false)
+	for _, term := range []rdf.Term{mary, john, jane, knows} {
+		_, err := dictionary.GetID(term, rdf.Default)
+		if term.Equal(mary) && err != ErrNotFound {
+			t.Errorf("Expected %s to be removed from the dictionary, got %v", term, err)
+		} else if !term.Equal(mary) && err != nil {
+			t.Errorf("Expected %s to stay in the dictionary, got %v", term, err)
+		}
+	}
+	dictionary.Commit()
+
+	v0 := rdf.NewVariable("v0")
+	if n := countSolutions(t, styx, []*rdf.Quad{rdf.NewQuad(v0, knows, jane, nil)}, nil); n != 1 {
+		t.Errorf("Expected one person to know jane after compaction, got %d", n)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	john := rdf.NewNamedNode("http://people.com/john")
+	jane := rdf.NewNamedNode("http://people.com/jane")
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	quads := []*rdf.Quad{rdf.NewQuad(john, knows, jane, nil)}
+
+	// Values written before checksums were enabled are still read
+	err := styx.Set(rdf.NewNamedNode(d1), quads)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	styx.Config.Checksums = true
+	err = styx.Set(rdf.NewNamedNode(d2), quads)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	v0 := rdf.NewVariable("v0")
+	pattern := []*rdf.Quad{rdf.NewQuad(v0, knows, jane, nil)}
+	if n := countSolutions(t, styx, pattern, nil); n != 1 {
+		t.Errorf("Expected one solution, got %d", n)
+	}
+
+	dictionary := styx.Config.Dictionary.Open(false)
+	var ids [3]ID
+	for i, term := range []rdf.Term{john, knows, jane} {
+		ids[i], err = dictionary.GetID(term, rdf.Default)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	dictionary.Commit()
+
+	// Corrupt the index of the first dataset's statement
+	key := assembleKey(TernaryPrefixes[0], false, ids[0], ids[1], ids[2])
+	err = styx.Badger.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		val[0] ^= 1
+		return txn.Set(key, val)
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.Delete(rdf.NewNamedNode(d2))
+	if err != ErrChecksum {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	jane := rdf.NewNamedNode("http://people.com/jane")
+	nodes, err := styx.Path(jane, "^http://schema.org/knows*")
+	if err != nil {
+		t.Error(err)
+		return
+	} else if len(nodes) != 2 {
+		t.Errorf("Expected two nodes, got %d", len(nodes))
+		return
+	}
+
+	quads, err := styx.Get(rdf.NewNamedNode(d2))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	knows := rdf.NewNamedNode("http://schema.org/knows")
+	for _, node := range nodes {
+		if node.Equal(jane) {
+			continue
+		}
+
+		// Path returns the blank nodes of the dataset as <dataset#label> IRIs
+		found := false
+		for _, quad := range quads {
+			subject := quad[0]
+			if subject.TermType() == rdf.BlankNodeType {
+				subject = rdf.NewNamedNode(d2 + "#" + subject.Value())
+			}
+			if subject.Equal(node) && quad[1].Equal(knows) && quad[2].Equal(jane) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s to know jane", node.String())
+		}
+	}
+
+	if !nodes[0].Equal(jane) && !nodes[1].Equal(jane) {
+		t.Errorf("Expected the path to include jane, got %v", nodes)
+	}
+}
+
+func TestPathQuery(t *testing.T) {
+	styx := openWith(func(config *Config) {
+		config.Policies = []Policy{{Predicate: "http://schema.org/name", Scope: "private", Action: Hash}}
+	})
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	inverse, err := styx.QueryJSONLD(`{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@id": "http://people.com/jane",
+	"^knows": { "@id": "?:person" }
+}`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer inverse.Close()
+	solutions, err := inverse.Collect()
+	if err != nil {
+		t.Error(err)
+		return
+	} else if len(solutions) != 1 {
+		t.Errorf("Expected one person who knows jane, got %v", solutions)
+	}
+
+	// The friend isn't bound by the rest of the query, so the path is expanded
+	query := `{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@id": "?:person",
+	"name": { "@id": "?:name" },
+	"knows+": { "@id": "?:friend" }
+}`
+
+	iter, err := styx.QueryJSONLD(query)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	if d, err := iter.Next(nil); err != nil || d == nil {
+		t.Errorf("Expected a solution, got %v", err)
+		return
+	}
+
+	if term := iter.Get(rdf.NewVariable("friend")); term == nil || term.Value() != "http://people.com/jane" {
+		t.Errorf("Expected the friend to be jane, got %v", term)
+	}
+	if term := iter.Get(rdf.NewVariable("name")); term == nil || term.Value() == "Johnanthan Appleseed" {
+		t.Errorf("Expected the name to be hashed, got %v", term)
+	}
+
+	typed, err := styx.QueryJSONLDWithOptions(query, &QueryOptions{
+		Types: []TypeHint{{Variable: rdf.NewVariable("friend"), Datatype: rdf.XSDString}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer typed.Close()
+	if d, err := typed.Next(nil); err != nil || d != nil {
+		t.Errorf("Expected the type hint to drop the expanded solution, got %v, %v", d, err)
+	}
+}
+
+var document5 = `{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@graph": [
+		{ "@id": "http://example.com/a", "value": 4 },
+		{ "@id": "http://example.com/b", "value": 6 },
+		{ "@id": "http://example.com/c", "value": "seven" },
+		{ "@id": "http://example.com/d", "value": true },
+		{ "@id": "http://example.com/e", "value": { "@id": "http://example.com/f" } },
+		{ "@id": "http://example.com/g", "value": { "@id": "http://example.com/h" } },
+		{ "@id": "http://example.com/i", "value": { "@id": "http://example.com/j" } }
+	]
+}`
+
+func TestTypeHint(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document5, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	value := rdf.NewVariable("value")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(rdf.NewVariable("item"), rdf.NewNamedNode("http://schema.org/value"), value, nil),
+	}
+
+	solve := func(datatype *rdf.NamedNode) ([]string, Cost) {
+		opts := &QueryOptions{}
+		if datatype != nil {
+			opts.Types = []TypeHint{{Variable: value, Datatype: datatype}}
+		}
+
+		iter, err := styx.QueryWithOptions(pattern, []rdf.Term{value}, nil, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+
+		values := []string{}
+		for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, iter.Get(value).Value())
+		}
+		return values, iter.Cost()
+	}
+
+	all, cost := solve(nil)
+	integers, integerCost := solve(rdf.NewNamedNode("http://www.w3.org/2001/XMLSchema#integer"))
+	if len(all) != 7 {
+		t.Errorf("Expected seven values, got %v", all)
+	} else if strings.Join(integers, " ") != "4 6" {
+		t.Errorf("Expected the integer values, got %v", integers)
+	} else if integerCost.Keys >= cost.Keys {
+		t.Errorf("Expected the type hint to scan fewer keys than %d, got %d", cost.Keys, integerCost.Keys)
+	}
+
+	// The items are solved first, and only one item has a boolean value
+	item := rdf.NewVariable("item")
+	iter, err := styx.QueryWithOptions(pattern, []rdf.Term{item, value}, nil, &QueryOptions{Types: []TypeHint{{Variable: value, Datatype: rdf.NewNamedNode("http://www.w3.org/2001/XMLSchema#boolean")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Close()
+
+	n := 0
+	for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+		if err != nil {
+			t.Fatal(err)
+		} else if term := iter.Get(value); term == nil || term.TermType() != rdf.LiteralType {
+			t.Errorf("Expected a boolean value, got %v", term)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected one item with a boolean value, got %d", n)
+	}
+
+	if values, _ := solve(rdf.XSDString); len(values) != 1 || values[0] != "seven" {
+		t.Errorf("Expected the string value, got %v", values)
+	}
+	if none, _ := solve(rdf.NewNamedNode("http://example.com/unknown")); len(none) != 0 {
+		t.Errorf("Expected an unknown datatype to have no values, got %v", none)
+	}
+}
+
+var document7 = `{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@graph": [
+		{
+			"@id": "http://example.com/apple",
+			"name": [{ "@value": "Apple", "@language": "en-US" }, { "@value": "Pomme", "@language": "fr" }]
+		},
+		{
+			"@id": "http://example.com/banana",
+			"name": [{ "@value": "Banana", "@language": "en" }, { "@value": "Banane", "@language": "fr" }, "Banana"]
+		}
+	]
+}`
+
+func TestLanguageHint(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document7, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.SetJSONLD(d2, document7, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	name := rdf.NewVariable("name")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(rdf.NewVariable("item"), rdf.NewNamedNode("http://schema.org/name"), name, nil),
+	}
+
+	hinted := func(language string) int {
+		return countSolutions(t, styx, pattern, &QueryOptions{
+			LanguageHints: []LanguageHint{{Variable: name, Language: language}},
+		})
+	}
+
+	if n := hinted("en"); n != 2 {
+		t.Errorf("Expected two names in English, got %d", n)
+	}
+	if n := hinted("EN-us"); n != 1 {
+		t.Errorf("Expected one name in American English, got %d", n)
+	}
+	if n := hinted("de"); n != 0 {
+		t.Errorf("Expected no names in German, got %d", n)
+	}
+
+	iter, err := styx.QueryJSONLD(`{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@id": "?:item",
+	"name": { "@language": "fr" }
+}`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	names := []string{}
+	for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, iter.Get(rdf.NewVariable("styx:language0")).Value())
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "Banane Pomme" {
+		t.Errorf("Expected the French names, got %v", names)
+	}
+
+	_, err = styx.QueryJSONLD(`{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@id": "?:styx:item",
+	"name": { "@language": "fr" }
+}`)
+	if err != ErrReservedVariable {
+		t.Errorf("Expected ErrReservedVariable for a variable with the reserved prefix, got %v", err)
+	}
+
+	// The literals stay in the index until neither dataset uses them
+	if err = styx.Delete(rdf.NewNamedNode(d1)); err != nil {
+		t.Fatal(err)
+	} else if n := hinted("fr"); n != 2 {
+		t.Errorf("Expected two names in French after deleting one dataset, got %d", n)
+	}
+
+	if err = styx.Delete(rdf.NewNamedNode(d2)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = viewTxn(styx.KV, func(txn KVTxn) error {
+		iter := txn.NewIterator(KVIteratorOptions{Prefix: []byte{LanguagePrefix}})
+		defer iter.Close()
+		for iter.Seek([]byte{LanguagePrefix}); iter.ValidForPrefix([]byte{LanguagePrefix}); iter.Next() {
+			t.Errorf("Expected the language index to be empty, got %q", iter.Item().Key())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+var document3 = `{
+	"@context": { "@vocab": "http://schema.org/" },
+	"@graph": [
+		{ "@id": "http://example.com/apple", "weight": { "value": 4000, "unitCode": "GRM" } },
+		{ "@id": "http://example.com/melon", "weight": { "value": 6, "unitCode": "KGM" } }
+	]
+}`
+
+func TestQuantity(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document3, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	item, weight := rdf.NewVariable("item"), rdf.NewVariable("weight")
+	pattern := []*rdf.Quad{rdf.NewQuad(item, rdf.NewNamedNode("http://schema.org/weight"), weight, nil)}
+
+	filter, err := FilterQuantity(weight, nil, &Quantity{5, "kg"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	iter, err := styx.Query(pattern, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	iter.Pipe(filter)
+
+	items := []string{}
+	for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		items = append(items, iter.Get(item).Value())
+	}
+
+	if len(items) != 1 || items[0] != "http://example.com/apple" {
+		t.Errorf("Expected only the apple to weigh less than 5 kg, got %v", items)
+	}
+
+	if _, err = FilterQuantity(weight, &Quantity{1, "m"}, &Quantity{5, "kg"}); err != ErrInvalidQuantity {
+		t.Errorf("Expected ErrInvalidQuantity for bounds of different dimensions, got %v", err)
+	}
+}
+
+var document4 = `{
+	"@context": {
+		"@vocab": "http://schema.org/",
+		"geosparql": "http://www.opengis.net/ont/geosparql#"
+	},
+	"@graph": [
+		{ "@id": "http://example.com/mit", "geo": { "latitude": 42.3601, "longitude": -71.0942 } },
+		{ "@id": "http://example.com/harvard", "geo": { "latitude": "42.3770", "longitude": "-71.1167" } },
+		{
+			"@id": "http://example.com/london",
+			"geo": { "geosparql:asWKT": { "@value": "Point(-0.1276 51.5072)", "@type": "geosparql:wktLiteral" } }
+		},
+		{
+			"@id": "http://example.com/suva",
+			"geo": { "geosparql:asWKT": { "@value": "POINT (178.4419 -18.1248)", "@type": "geosparql:wktLiteral" } }
+		}
+	]
+}`
+
+func TestGeo(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document4, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	place, geo := rdf.NewVariable("place"), rdf.NewVariable("geo")
+	pattern := []*rdf.Quad{rdf.NewQuad(place, rdf.NewNamedNode("http://schema.org/geo"), geo, nil)}
+
+	places := func(filter Transformer) map[string]bool {
+		iter, err := styx.Query(pattern, nil, nil)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+
+		defer iter.Close()
+		iter.Pipe(filter)
+
+		result := map[string]bool{}
+		for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+			if err != nil {
+				t.Error(err)
+				return nil
+			}
+			result[iter.Get(place).Value()] = true
+		}
+		return result
+	}
+
+	radius, err := FilterRadius(geo, Point{42.3601, -71.0942}, 5000)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result := places(radius); len(result) != 2 || !result["http://example.com/mit"] || !result["http://example.com/harvard"] {
+		t.Errorf("Expected mit and harvard within 5 km of mit, got %v", result)
+	}
+
+	europe, err := FilterBoundingBox(geo, BoundingBox{South: 35, West: -10, North: 70, East: 40})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result := places(europe); len(result) != 1 || !result["http://example.com/london"] {
+		t.Errorf("Expected only london in europe, got %v", result)
+	}
+
+	// The box crosses the antimeridian
+	pacific, err := FilterBoundingBox(geo, BoundingBox{South: -30, West: 170, North: 0, East: -170})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result := places(pacific); len(result) != 1 || !result["http://example.com/suva"] {
+		t.Errorf("Expected only suva in the pacific, got %v", result)
+	}
+
+	if _, err = FilterBoundingBox(geo, BoundingBox{South: 10, West: 0, North: -10, East: 10}); err != ErrInvalidGeometry {
+		t.Errorf("Expected ErrInvalidGeometry for a box with its south above its north, got %v", err)
+	}
+}
+
+func TestQueryCancel(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	v0, v1 := rdf.NewVariable("v0"), rdf.NewVariable("v1")
+	pattern := []*rdf.Quad{rdf.NewQuad(v0, rdf.NewNamedNode("http://schema.org/name"), v1, nil)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	iter, err := styx.QueryContext(ctx, pattern, nil, nil, nil)
+	if err == nil {
+		defer iter.Close()
+		_, err = iter.Next(nil)
+	}
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	iter, err = styx.QueryContext(ctx, pattern, nil, nil, nil)
+	if err == nil {
+		defer iter.Close()
+		_, err = iter.Next(nil)
+	}
+	if err != ErrQueryTimeout {
+		t.Errorf("Expected ErrQueryTimeout, got %v", err)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	styx := openWith(func(config *Config) {
+		config.Policies = []Policy{
+			{Predicate: "http://schema.org/birthDate", Scope: "private", Action: Omit},
+			{Predicate: "http://schema.org/name", Scope: "private", Action: Hash},
+		}
+	})
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	person, birthDate, name := rdf.NewVariable("person"), rdf.NewVariable("birthDate"), rdf.NewVariable("name")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(person, rdf.NewNamedNode("http://schema.org/birthDate"), birthDate, nil),
+		rdf.NewQuad(person, rdf.NewNamedNode("http://schema.org/name"), name, nil),
+	}
+
+	iter, err := styx.Query(pattern, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	if d, err := iter.Next(nil); err != nil || d == nil {
+		t.Errorf("Expected a solution, got %v", err)
+		return
+	}
+
+	if term := iter.Get(birthDate); term != nil {
+		t.Errorf("Expected the birth date to be omitted, got %s", term.String())
+	}
+	if term := iter.Get(name); term == nil || len(term.Value()) != 64 || term.Value() == "Johnanthan Appleseed" {
+		t.Errorf("Expected the name to be hashed, got %v", term)
+	}
+
+	scoped, err := styx.QueryWithOptions(pattern, nil, nil, &QueryOptions{Scopes: []string{"private"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer scoped.Close()
+	if d, err := scoped.Next(nil); err != nil || d == nil {
+		t.Errorf("Expected a solution, got %v", err)
+		return
+	}
+
+	if term := scoped.Get(birthDate); term == nil || term.Value() != "1780-01-10" {
+		t.Errorf("Expected the scoped query to see the birth date, got %v", term)
+	}
+	if term := scoped.Get(name); term == nil || term.Value() != "Johnanthan Appleseed" {
+		t.Errorf("Expected the scoped query to see the name, got %v", term)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	styx := openWith(func(config *Config) {
+		config.Pipeline = []TransformerFactory{Dedupe}
+	})
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	person, name := rdf.NewVariable("person"), rdf.NewVariable("name")
+	pattern := []*rdf.Quad{rdf.NewQuad(person, rdf.NewNamedNode("http://schema.org/name"), name, nil)}
+
+	// Every query gets its own Dedupe, so the second query sees the same solutions
+	for i := 0; i < 2; i++ {
+		iter, err := styx.Query(pattern, nil, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		count := 0
+		for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+			if err != nil {
+				t.Error(err)
+				break
+			}
+			count++
+		}
+		iter.Close()
+
+		if count != 3 {
+			t.Errorf("Expected three solutions from query %d, got %d", i, count)
+		}
+	}
+}
+
+func TestPipelineAccessors(t *testing.T) {
+	styx := openWith(func(config *Config) {
+		config.Pipeline = []TransformerFactory{func() Transformer { return RedactPredicates("http://schema.org/name") }}
+	})
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	person, name := rdf.NewVariable("person"), rdf.NewVariable("name")
+	pattern := []*rdf.Quad{rdf.NewQuad(person, rdf.NewNamedNode("http://schema.org/name"), name, nil)}
+
+	iter, err := styx.Query(pattern, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	if d, err := iter.Next(nil); err != nil || d == nil {
+		t.Errorf("Expected a solution, got %v", err)
+		return
+	}
+
+	if term := iter.Get(name); term != nil {
+		t.Errorf("Expected Get to return the redacted name as nil, got %s", term.String())
+	}
+	if graph := iter.Graph(); len(graph) != 0 {
+		t.Errorf("Expected Graph to leave out the redacted quad, got %v", graph)
+	}
+	for _, term := range iter.Index() {
+		if term != nil && term.Value() == "Johnanthan Appleseed" {
+			t.Error("Expected Index to redact the name")
+		}
+	}
+
+	// Log prints the nil values of redacted variables
+	logged, err := styx.Query(pattern, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer logged.Close()
+	logged.Log()
+}
+
+func TestBulkLoad(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	john, jane := rdf.NewNamedNode("http://people.com/john"), rdf.NewNamedNode("http://people.com/jane")
+	name, knows := rdf.NewNamedNode("http://schema.org/name"), rdf.NewNamedNode("http://schema.org/knows")
+	dataset := []*rdf.Quad{
+		rdf.NewQuad(john, name, rdf.NewLiteral("John Doe", "", nil), nil),
+		rdf.NewQuad(john, knows, jane, nil),
+		rdf.NewQuad(jane, name, rdf.NewLiteral("Jane Doe", "", nil), nil),
+		rdf.NewQuad(jane, name, rdf.NewLiteral("Jeanne", "fr", rdf.RDFLangString), nil),
+	}
+
+	load := func() error {
+		quads := make(chan *rdf.Quad, len(dataset))
+		for _, quad := range dataset {
+			quads <- quad
+		}
+		close(quads)
+		return styx.BulkLoad(context.Background(), rdf.NewNamedNode(d1), quads)
+	}
+
+	if err := load(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	quads, err := styx.Get(rdf.NewNamedNode(d1))
+	if err != nil {
+		t.Error(err)
+		return
+	} else if len(quads) != len(dataset) {
+		t.Errorf("Expected %d quads, got %d", len(dataset), len(quads))
+	}
+
+	usage, err := styx.Usage(rdf.NewNamedNode(d1))
+	if err != nil {
+		t.Error(err)
+	} else if usage.Quads != uint64(len(dataset)) {
+		t.Errorf("Expected a usage of %d quads, got %d", len(dataset), usage.Quads)
+	}
+
+	person := rdf.NewVariable("person")
+	iter, err := styx.Query([]*rdf.Quad{rdf.NewQuad(person, knows, jane, nil)}, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	if d, err := iter.Next(nil); err != nil || d == nil {
+		t.Errorf("Expected a solution, got %v", err)
+	} else if !iter.Get(person).Equal(john) {
+		t.Errorf("Expected john, got %s", iter.Get(person).String())
+	}
+
+	hint := &QueryOptions{LanguageHints: []LanguageHint{{Variable: person, Language: "fr"}}}
+	if n := countSolutions(t, styx, []*rdf.Quad{rdf.NewQuad(jane, name, person, nil)}, hint); n != 1 {
+		t.Errorf("Expected the bulk load to index one name in French, got %d", n)
+	}
+
+	if err := load(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+}
+
+// getStrings returns the sorted N-Quads of a dataset
+func getStrings(styx *Store, uri string) ([]string, error) {
+	quads, err := styx.Get(rdf.NewNamedNode(uri))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, len(quads))
+	for i, quad := range quads {
+		lines[i] = quad.String()
+	}
+	sort.Strings(lines)
+	return lines, nil
+}
+
+func TestSnapshotIDs(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "styx-snapshots")
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	styx := openWith(func(config *Config) { config.SnapshotDir = dir })
+	defer styx.Close()
+
+	d3 := "http://example.com/d3"
+	steps := []func() error{
+		func() error { return styx.SetJSONLD(d1, document1, false) },
+		func() error { _, err := styx.Snapshot("one"); return err },
+		func() error { return styx.SetJSONLD(d2, document2, false) },
+		func() error { _, err := styx.Snapshot("two"); return err },
+		func() error { return styx.Rollback("one") },
+		// These IDs were handed out to d2 before the rollback
+		func() error { return styx.SetJSONLD(d3, document3, false) },
+		func() error { return styx.Rollback("two") },
+	}
+
+	var expected1, expected2 []string
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Errorf("Step %d: %s", i, err)
+			return
+		}
+
+		if i == 2 {
+			var err error
+			if expected1, err = getStrings(styx, d1); err != nil {
+				t.Error(err)
+				return
+			} else if expected2, err = getStrings(styx, d2); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+
+	// The restored dictionary holds d2's IDs, so new terms must not be given them again
+	err := styx.SetJSONLD(d3, document3, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for uri, expected := range map[string][]string{d1: expected1, d2: expected2} {
+		actual, err := getStrings(styx, uri)
+		if err != nil {
+			t.Error(err)
+		} else if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected %s to be unchanged, got %v", uri, actual)
+		}
+	}
+
+	quads, err := getStrings(styx, d3)
+	if err != nil {
+		t.Error(err)
+	} else if len(quads) == 0 || !strings.Contains(strings.Join(quads, "\n"), "<http://example.com/apple>") {
+		t.Errorf("Expected d3 to have the apple, got %v", quads)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	styx := openWith(func(config *Config) { config.Quota = &Quota{TotalQuads: 6} })
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = styx.SetJSONLD(d1, document1, false); err != ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// Replacing a dataset only counts the difference against the quota
+	if err = styx.SetJSONLD(d2, document2, false); err != nil {
+		t.Error(err)
+	}
+
+	usage, err := styx.TotalUsage()
+	if err != nil {
+		t.Error(err)
+	} else if usage.Quads != 4 {
+		t.Errorf("Expected a total usage of 4 quads, got %d", usage.Quads)
+	}
+
+	if err = styx.Delete(rdf.NewNamedNode(d2)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	usage, err = styx.TotalUsage()
+	if err != nil {
+		t.Error(err)
+	} else if usage.Quads != 0 {
+		t.Errorf("Expected a total usage of 0 quads after deleting, got %d", usage.Quads)
+	}
+
+	if err = styx.SetJSONLD(d1, document1, false); err != ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded for a dataset larger than the quota, got %v", err)
+	}
+}
+
+func TestRegisterQuery(t *testing.T) {
+	styx := openWith(func(config *Config) { config.Limits = &Limits{MaxQuads: 2} })
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	knows, name := rdf.NewNamedNode("http://schema.org/knows"), rdf.NewNamedNode("http://schema.org/name")
+	pattern := func(a, b, c rdf.Term) []*rdf.Quad {
+		return []*rdf.Quad{rdf.NewQuad(a, knows, b, nil), rdf.NewQuad(b, name, c, nil)}
+	}
+
+	uri, err := styx.RegisterQuery(pattern(rdf.NewVariable("a"), rdf.NewVariable("b"), rdf.NewBlankNode("c")))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	renamed, err := styx.RegisterQuery(pattern(rdf.NewVariable("x"), rdf.NewVariable("y"), rdf.NewBlankNode("z")))
+	if err != nil {
+		t.Error(err)
+		return
+	} else if !renamed.Equal(uri) {
+		t.Errorf("Expected patterns that only differ in labels to get the same URI, got %s and %s", uri.Value(), renamed.Value())
+	}
+
+	blank, err := styx.RegisterQuery(pattern(rdf.NewVariable("x"), rdf.NewVariable("y"), rdf.NewVariable("z")))
+	if err != nil {
+		t.Error(err)
+		return
+	} else if blank.Equal(uri) {
+		t.Error("Expected a variable and a blank node to get different URIs")
+	}
+
+	iter, err := styx.QueryURI(context.Background(), uri, nil, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer iter.Close()
+	if d, err := iter.Next(nil); err != nil || d == nil {
+		t.Errorf("Expected a solution, got %v", err)
+	} else if graph := iter.Graph(); len(graph) != 2 {
+		t.Errorf("Expected a graph of two quads, got %v", graph)
+	}
+
+	long := append(pattern(rdf.NewVariable("a"), rdf.NewVariable("b"), rdf.NewVariable("c")), rdf.NewQuad(rdf.NewVariable("a"), name, rdf.NewVariable("d"), nil))
+	if _, err = styx.RegisterQuery(long); err != ErrQueryTooComplex {
+		t.Errorf("Expected ErrQueryTooComplex, got %v", err)
+	}
+}
+
+// maxID returns the greatest ID in the dictionary
+// getStringSet returns the quads of a dataset as a set of N-Quads strings
+func getStringSet(t *testing.T, styx *Store, node rdf.Term) map[string]bool {
+	quads, err := styx.Get(node)
+	if err != nil && err != ErrNotFound {
+		t.Fatal(err)
+	}
+
+	set := make(map[string]bool, len(quads))
+	for _, quad := range quads {
+		set[quad.String()] = true
+	}
+	return set
+}
+
+func TestInference(t *testing.T) {
+	inferred := rdf.NewNamedNode("http://example.com/inferred")
+	styx := openWith(func(config *Config) { config.Inference = inferred })
+	defer styx.Close()
+
+	rdfType := rdf.NewNamedNode("http://www.w3.org/1999/02/22-rdf-syntax-ns#type")
+	employee, person := rdf.NewNamedNode("http://schema.org/Employee"), rdf.NewNamedNode("http://schema.org/Person")
+	worksFor, organization := rdf.NewNamedNode("http://schema.org/worksFor"), rdf.NewNamedNode("http://schema.org/Organization")
+	alice, bob, acme := rdf.NewNamedNode("http://people.com/alice"), rdf.NewNamedNode("http://people.com/bob"), rdf.NewNamedNode("http://acme.com/")
+
+	err := styx.Set(rdf.NewNamedNode("http://example.com/schema"), []*rdf.Quad{
+		rdf.NewQuad(employee, rdf.NewNamedNode(rdfsSubClassOf), person, nil),
+		rdf.NewQuad(worksFor, rdf.NewNamedNode(rdfsDomain), employee, nil),
+		rdf.NewQuad(worksFor, rdf.NewNamedNode(rdfsRange), organization, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(quads ...*rdf.Quad) {
+		t.Helper()
+		set := getStringSet(t, styx, inferred)
+		if len(set) != len(quads) {
+			t.Errorf("Expected %d inferred quads, got %v", len(quads), set)
+		}
+		for _, quad := range quads {
+			if !set[quad.String()] {
+				t.Errorf("Expected %s to be inferred", quad.String())
+			}
+		}
+	}
+
+	err = styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(alice, worksFor, acme, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(
+		rdf.NewQuad(alice, rdfType, employee, nil),
+		rdf.NewQuad(alice, rdfType, person, nil),
+		rdf.NewQuad(acme, rdfType, organization, nil),
+	)
+
+	// Replacing the dataset only re-computes the entailments of alice, bob, and acme
+	err = styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(bob, worksFor, acme, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(
+		rdf.NewQuad(bob, rdfType, employee, nil),
+		rdf.NewQuad(bob, rdfType, person, nil),
+		rdf.NewQuad(acme, rdfType, organization, nil),
+	)
+
+	err = styx.Delete(rdf.NewNamedNode(d1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect()
+}
+
+func TestSameAs(t *testing.T) {
+	same := rdf.NewNamedNode("http://example.com/same")
+	styx := openWith(func(config *Config) { config.SameAs = same })
+	defer styx.Close()
+
+	alice, alice2, bob := rdf.NewNamedNode("http://people.com/alice"), rdf.NewNamedNode("http://people.org/alice"), rdf.NewNamedNode("http://people.com/bob")
+	name, knows := rdf.NewNamedNode("http://schema.org/name"), rdf.NewNamedNode("http://schema.org/knows")
+
+	err := styx.Set(rdf.NewNamedNode("http://example.com/links"), []*rdf.Quad{
+		rdf.NewQuad(alice, rdf.NewNamedNode(owlSameAs), alice2, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(alice2, name, rdf.NewLiteral("Alice", "", nil), nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = styx.Set(rdf.NewNamedNode(d2), []*rdf.Quad{rdf.NewQuad(bob, knows, alice, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := getStringSet(t, styx, same)
+	for _, quad := range []*rdf.Quad{
+		rdf.NewQuad(alice, name, rdf.NewLiteral("Alice", "", nil), nil),
+		rdf.NewQuad(bob, knows, alice2, nil),
+	} {
+		if !set[quad.String()] {
+			t.Errorf("Expected %s to be copied, got %v", quad.String(), set)
+		}
+	}
+
+	// Replacing the name re-computes the copies of alice's set
+	err = styx.Set(rdf.NewNamedNode(d1), []*rdf.Quad{rdf.NewQuad(alice2, name, rdf.NewLiteral("Ally", "", nil), nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set = getStringSet(t, styx, same)
+	if set[rdf.NewQuad(alice, name, rdf.NewLiteral("Alice", "", nil), nil).String()] {
+		t.Error("Expected the old name to be removed")
+	}
+	for _, quad := range []*rdf.Quad{
+		rdf.NewQuad(alice, name, rdf.NewLiteral("Ally", "", nil), nil),
+		rdf.NewQuad(bob, knows, alice2, nil),
+	} {
+		if !set[quad.String()] {
+			t.Errorf("Expected %s to be copied, got %v", quad.String(), set)
+		}
+	}
+}
+
+// countSolutions counts the solutions of a query
+func countSolutions(t *testing.T, styx *Store, pattern []*rdf.Quad, opts *QueryOptions) int {
+	iter, err := styx.QueryWithOptions(pattern, nil, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Close()
+
+	count := 0
+	for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	return count
+}
+
+func TestParallel(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	a, b, c, d := rdf.NewVariable("a"), rdf.NewVariable("b"), rdf.NewVariable("c"), rdf.NewVariable("d")
+	pattern := []*rdf.Quad{
+		rdf.NewQuad(a, rdf.NewNamedNode("http://schema.org/knows"), b, nil),
+		rdf.NewQuad(c, rdf.NewNamedNode("http://schema.org/name"), d, nil),
+	}
+
+	solve := func(domain []rdf.Term, opts *QueryOptions) []string {
+		iter, err := styx.QueryWithOptions(pattern, domain, nil, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+
+		solutions := []string{}
+		for delta, err := iter.Next(nil); delta != nil; delta, err = iter.Next(nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := make([]string, 4)
+			for i, v := range []rdf.Term{a, b, c, d} {
+				values[i] = iter.Get(v).String()
+			}
+			solutions = append(solutions, strings.Join(values, " "))
+		}
+
+		for i, term := range domain {
+			if !iter.Domain()[i].Equal(term) {
+				t.Errorf("Expected the domain to start with %v, got %v", domain, iter.Domain())
+			}
+		}
+		return solutions
+	}
+
+	expected := solve(nil, nil)
+	sort.Strings(expected)
+	solutions := solve([]rdf.Term{d, a}, &QueryOptions{Parallel: true})
+	sort.Strings(solutions)
+	if len(solutions) != 3 || strings.Join(solutions, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the parallel solutions to be %v, got %v", expected, solutions)
+	}
+
+	if n := countSolutions(t, styx, pattern, &QueryOptions{Parallel: true, Offset: 1, Limit: 1}); n != 1 {
+		t.Errorf("Expected one solution after the offset, got %d", n)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	person, name := rdf.NewVariable("person"), rdf.NewVariable("name")
+	pattern := []*rdf.Quad{rdf.NewQuad(person, rdf.NewNamedNode("http://schema.org/name"), name, nil)}
+	opts := &QueryOptions{CacheResults: true}
+
+	if count := countSolutions(t, styx, pattern, opts); count != 3 {
+		t.Errorf("Expected three names, got %d", count)
+	}
+
+	// Renaming the variables hits the same cached result
+	renamed := []*rdf.Quad{rdf.NewQuad(rdf.NewVariable("a"), rdf.NewNamedNode("http://schema.org/name"), rdf.NewVariable("b"), nil)}
+	if count := countSolutions(t, styx, renamed, opts); count != 3 {
+		t.Errorf("Expected three names from the renamed query, got %d", count)
+	}
+
+	// Replacing the dataset with one that has no names removes them from the cache
+	err = styx.SetJSONLD(d1, document3, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if count := countSolutions(t, styx, pattern, opts); count != 0 {
+		t.Errorf("Expected the removed names to be invalidated, got %d", count)
+	}
+}
+
+func maxID(t *testing.T, db *badger.DB) (max uint64, key []byte) {
+	err := db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{Prefix: []byte{IDToValuePrefix}})
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			id, err := toUint64(iri(iter.Item().Key()[1:]))
+			if err != nil {
+				return err
+			} else if id >= max {
+				max, key = id, iter.Item().KeyCopy(nil)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestReconcileSequence(t *testing.T) {
+	styx := open()
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Lose the newest dictionary entry, like a crash between the index and dictionary commits
+	lost, key := maxID(t, styx.Badger)
+	err = styx.Badger.Update(func(txn *badger.Txn) error { return txn.Delete(key) })
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	factory := styx.Config.Dictionary.(*iriDictionaryFactory)
+	if err = factory.reset(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.SetJSONLD(d2, document2, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if max, _ := maxID(t, styx.Badger); max <= lost {
+		t.Errorf("Expected new IDs past the lost ID %d, got %d", lost, max)
+	}
+
+	err = styx.Badger.Update(func(txn *badger.Txn) error { return txn.Set([]byte{IDToValuePrefix, '!'}, nil) })
+	if err != nil {
+		t.Error(err)
+	} else if err = factory.reset(); err != ErrCorruptIndex {
+		t.Errorf("Expected ErrCorruptIndex, got %v", err)
+	}
+}
+
+// plainKV hides the write batches and TTLs of badger, like a backend without them
+type plainKV struct{ KV }
+
+type plainTxn struct{ KVTxn }
+
+func (kv plainKV) NewTransaction(update bool) KVTxn { return plainTxn{kv.KV.NewTransaction(update)} }
+
+func TestKV(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv := plainKV{BadgerKV(db)}
+	tags := NewPrefixTagScheme("http://example.com/")
+	dictionary, err := MakeIriDictionaryKV(tags, kv, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	styx, err := NewStoreKV(&Config{TagScheme: tags, Dictionary: dictionary, QuadStore: MakeKVStore(kv)}, kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer styx.Close()
+
+	john, name := rdf.NewNamedNode("http://people.com/john"), rdf.NewNamedNode("http://schema.org/name")
+	quads := make(chan *rdf.Quad, 1)
+	quads <- rdf.NewQuad(john, name, rdf.NewLiteral("John Doe", "", nil), nil)
+	close(quads)
+	err = styx.BulkLoad(context.Background(), rdf.NewNamedNode(d2), quads)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	x := rdf.NewVariable("x")
+	iter, err := styx.Query([]*rdf.Quad{rdf.NewQuad(x, name, rdf.NewLiteral("John Doe", "", nil), nil)}, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer iter.Close()
+
+	if d, err := iter.Next(nil); err != nil {
+		t.Error(err)
+	} else if d == nil || !d[0].Equal(john) {
+		t.Errorf("Expected john, got %v", d)
+	}
+
+	if err = styx.Compact(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = styx.Backup(&bytes.Buffer{}, 0); err != ErrUnsupportedBackend {
+		t.Errorf("Expected ErrUnsupportedBackend, got %v", err)
+	}
+}
+
+func TestKeyLayout(t *testing.T) {
+	tab := open()
+	defer tab.Close()
+
+	varint := openAt(tmpPath+"-varint", func(config *Config) { config.KeyLayout = VarintKeyLayout })
+	defer varint.Close()
+
+	name := rdf.NewNamedNode("http://schema.org/name")
+	s, o := rdf.NewVariable("s"), rdf.NewVariable("o")
+	solve := func(styx *Store, pattern []*rdf.Quad, opts *QueryOptions) string {
+		iter, err := styx.QueryWithOptions(pattern, nil, nil, opts)
+		if err == ErrNotFound {
+			return ""
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+
+		solutions := []string{}
+		for d, err := iter.Next(nil); d != nil; d, err = iter.Next(nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			solutions = append(solutions, iter.Get(s).String()+" "+iter.Get(o).String())
+		}
+		sort.Strings(solutions)
+		return strings.Join(solutions, "\n")
+	}
+
+	run := func(styx *Store) []string {
+		for i, document := range []string{document1, document2, document5, document7} {
+			if err := styx.SetJSONLD(fmt.Sprintf("http://example.com/d%d", i+1), document, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		names := []*rdf.Quad{rdf.NewQuad(s, name, o, nil)}
+		values := []*rdf.Quad{rdf.NewQuad(s, rdf.NewNamedNode("http://schema.org/value"), o, nil)}
+		integer := rdf.NewNamedNode("http://www.w3.org/2001/XMLSchema#integer")
+		results := []string{
+			solve(styx, names, nil),
+			solve(styx, []*rdf.Quad{rdf.NewQuad(s, rdf.NewNamedNode("http://schema.org/knows"), o, nil)}, nil),
+			solve(styx, values, &QueryOptions{Types: []TypeHint{{Variable: o, Datatype: integer}}}),
+			solve(styx, names, &QueryOptions{LanguageHints: []LanguageHint{{Variable: o, Language: "fr"}}}),
+		}
+
+		if err := styx.Delete(rdf.NewNamedNode("http://example.com/d4")); err != nil {
+			t.Fatal(err)
+		}
+		return append(results, solve(styx, names, nil))
+	}
+
+	expected, results := run(tab), run(varint)
+	for i, result := range results {
+		if result == "" || result != expected[i] {
+			t.Errorf("Expected the same solutions in both layouts, got %q and %q", expected[i], result)
+		}
+	}
+
+	size := func(db *badger.DB) (n int) {
+		db.View(func(txn *badger.Txn) error {
+			iter := txn.NewIterator(badger.IteratorOptions{})
+			defer iter.Close()
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				if key := iter.Item().Key(); isIndexKey(key) {
+					n += len(key)
+				}
+			}
+			return nil
+		})
+		return
+	}
+
+	if a, b := size(tab.Badger), size(varint.Badger); b >= a {
+		t.Errorf("Expected the varint index keys to be smaller than %d bytes, got %d", a, b)
+	}
+
+	// Stores keep the layout they were created with
+	config := &Config{Dictionary: varint.Config.Dictionary}
+	if _, err := NewStoreKV(config, BadgerKV(varint.Badger)); err != nil {
+		t.Error(err)
+	} else if config.KeyLayout != VarintKeyLayout {
+		t.Errorf("Expected the store to keep the varint layout, got %d", config.KeyLayout)
+	}
+
+	if _, err := NewStoreKV(&Config{KeyLayout: VarintKeyLayout}, BadgerKV(tab.Badger)); err != ErrKeyLayout {
+		t.Errorf("Expected ErrKeyLayout for a store with data in the tab layout, got %v", err)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	styx := openWith(func(config *Config) {
+		config.GraphQLContext = map[string]interface{}{
+			"@vocab":  "http://schema.org/",
+			"knownBy": map[string]interface{}{"@reverse": "http://schema.org/knows"},
+			"name":    map[string]interface{}{"@container": "@set"},
+		}
+	})
+	defer styx.Close()
+
+	err := styx.SetJSONLD(d1, document1, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		query     string
+		variables map[string]interface{}
+		expected  string
+	}{
+		{
+			`{ Person(name: "Jane Doe") { id birthDate } }`, nil,
+			`{"Person":[{"birthDate":"1995-01-01","id":"http://people.com/jane"}]}`,
+		},
+		{`{ Person(name: "Jane Doe") { knows { id } } }`, nil, `{"Person":[]}`},
+		{
+			`{ Person { knows(name: "Jane Doe") { id } } }`, nil,
+			`{"Person":[{"knows":{"id":"http://people.com/jane"}}]}`,
+		},
+		{
+			`query Jane($id: ID!) { jane: Person(id: $id) { name friend: knownBy { birthDate } } }`,
+			map[string]interface{}{"id": "http://people.com/jane"},
+			`{"jane":[{"friend":{"birthDate":"1996-02-02"},"name":["Jane Doe"]}]}`,
+		},
+		{`{ Person(first: 1) { __typename } }`, nil, `{"Person":[{"__typename":"Person"}]}`},
+		{`{ Person(id: "http://schema.org/Person") { id } }`, nil, `{"Person":[]}`},
+	} {
+		data, err := styx.GraphQL(ctx, c.query, c.variables)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		result, _ := json.Marshal(data)
+		if string(result) != c.expected {
+			t.Errorf("Expected %s for %s, got %s", c.expected, c.query, result)
+		}
+	}
+
+	for query, expected := range map[string]error{
+		`{ Person { ...fields } }`:        ErrUnsupportedGraphQL,
+		`mutation { Person { name } }`:    ErrUnsupportedGraphQL,
+		`{ __schema { types { name } } }`: ErrUnsupportedGraphQL,
+		`{ Person { name }`:               ErrInvalidGraphQL,
+		`{ Person(first: 0) { name } }`:   ErrInvalidGraphQL,
+	} {
+		if _, err := styx.GraphQL(ctx, query, nil); err != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, query, err)
+		}
+	}
+
+	body := `{"query": "{ Person(id: \"http://people.com/jane\") { name } }"}`
+	w := httptest.NewRecorder()
+	styx.GraphQLHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body)))
+	if expected := `{"data":{"Person":[{"name":["Jane Doe"]}]}}`; w.Code != 200 || strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("Expected %s, got %d %s", expected, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,197 @@
+package styx
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+type subscription struct {
+	pattern []*rdf.Quad
+	domain  []rdf.Term
+	seen    map[string][]rdf.Term
+	pending [][]rdf.Term
+	results chan []rdf.Term
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Subscribe registers a standing query. The returned channel receives every new
+// solution to the pattern (ordered like the Domain of a query iterator) that appears
+// after subsequent calls to Set, until the returned cancel function is called.
+// Solutions that already exist when Subscribe is called are not sent. Writes never
+// wait for the subscriber: when the channel's buffer is full, new solutions are queued
+// on the subscription and sent, in order, by the next write that publishes to it.
+func (s *Store) Subscribe(pattern []*rdf.Quad) (<-chan []rdf.Term, func(), error) {
+	sub := &subscription{
+		pattern: pattern,
+		results: make(chan []rdf.Term, 16),
+		done:    make(chan struct{}),
+	}
+
+	var err error
+	sub.domain, sub.seen, err = s.solve(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.lock.Lock()
+	if s.subscriptions == nil {
+		s.subscriptions = map[*subscription]bool{}
+	}
+	s.subscriptions[sub] = true
+	s.lock.Unlock()
+
+	cancel := func() {
+		sub.once.Do(func() {
+			close(sub.done)
+			s.lock.Lock()
+			delete(s.subscriptions, sub)
+			s.lock.Unlock()
+			close(sub.results)
+		})
+	}
+
+	return sub.results, cancel, nil
+}
+
+// solve collects the domain and the complete solutions to a pattern,
+// keyed by their string values
+func (s *Store) solve(pattern []*rdf.Quad) ([]rdf.Term, map[string][]rdf.Term, error) {
+	iter, err := s.internalQuery(context.Background(), nil, pattern, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer iter.Close()
+
+	solutions := map[string][]rdf.Term{}
+	d, err := iter.Next(nil)
+	for ; d != nil; d, err = iter.Next(nil) {
+		index := iter.Index()
+		solutions[strings.Join(formatTerms(index), "\t")] = index
+	}
+
+	return iter.Domain(), solutions, err
+}
+
+// publish updates the subscriptions that might match the quads that a write to a dataset
+// removed or added. Solutions that use a removed triple are forgotten unless they still
+// hold, so that they're sent again if they re-appear, and the solutions that use an added
+// triple are sent if they're new. Subscriptions with transitive paths are solved in full.
+func (s *Store) publish(node rdf.Term, removed, added []*rdf.Quad) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	predicates := getPredicates(append(append([]*rdf.Quad{}, removed...), added...))
+	var delta [2][]*rdf.Quad
+	var exclude []rdf.Term
+	for sub := range s.subscriptions {
+		if !overlaps(sub.pattern, predicates) {
+			continue
+		}
+
+		if delta[0] == nil {
+			views, err := s.getViews()
+			if err != nil {
+				return err
+			}
+			exclude = viewNodes(views)
+			delta[0], err = s.skolemize(node, removed)
+			if err != nil {
+				return err
+			}
+			delta[1], err = s.skolemize(node, added)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := s.update(sub, delta[0], delta[1], exclude)
+		if err != nil {
+			return err
+		}
+
+		sub.flush()
+	}
+
+	return nil
+}
+
+// update forgets the seen solutions of a subscription that no longer hold and queues
+// the new ones, leaving out the solutions that only hold through the excluded datasets
+func (s *Store) update(sub *subscription, removed, added []*rdf.Quad, exclude []rdf.Term) error {
+	query, paths := compilePaths(sub.pattern)
+	if len(paths) > 0 {
+		_, solutions, err := s.solve(sub.pattern)
+		if err != nil {
+			return err
+		}
+
+		for key, index := range solutions {
+			if _, has := sub.seen[key]; !has {
+				sub.pending = append(sub.pending, index)
+			}
+		}
+		sub.seen = solutions
+		return nil
+	}
+
+	removedTriples := make(map[string]bool, len(removed))
+	for _, quad := range removed {
+		removedTriples[quad.String()] = true
+	}
+
+	for key, index := range sub.seen {
+		terms := bindingTerms(sub.domain, index)
+		if stale(query, terms, removedTriples) {
+			solutions, err := s.solveBound(query, sub.domain, terms, exclude)
+			if err != nil {
+				return err
+			} else if len(solutions) == 0 {
+				delete(sub.seen, key)
+			}
+		}
+	}
+
+	for _, quad := range query {
+		for _, triple := range added {
+			terms := unify(quad, triple)
+			if terms == nil {
+				continue
+			}
+
+			solutions, err := s.solveBound(query, sub.domain, terms, exclude)
+			if err != nil {
+				return err
+			}
+
+			for _, index := range solutions {
+				key := strings.Join(formatTerms(index), "\t")
+				if _, has := sub.seen[key]; !has {
+					sub.seen[key] = index
+					sub.pending = append(sub.pending, index)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// flush sends the queued solutions of a subscription until its buffer is full.
+// It never blocks, since publish runs with the writer lock held.
+func (sub *subscription) flush() {
+	for len(sub.pending) > 0 {
+		select {
+		case sub.results <- sub.pending[0]:
+			sub.pending = sub.pending[1:]
+		case <-sub.done:
+			sub.pending = nil
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package styx
+
+import (
+	"sort"
+	"strings"
+
+	ld "github.com/piprate/json-gold/ld"
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const rdfsResource = "http://www.w3.org/2000/01/rdf-schema#Resource"
+
+// A SummaryEdge counts the triples that link instances of one class to another through
+// a predicate. Untyped nodes are counted as rdfs:Resource, and literals by their datatype.
+type SummaryEdge struct {
+	Domain    rdf.Term
+	Predicate rdf.Term
+	Range     rdf.Term
+	Count     uint64
+}
+
+// Summary returns the class-level shape of the store, most frequent edges first.
+// It scans the whole triple index.
+func (s *Store) Summary() ([]*SummaryEdge, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	classes := map[ID][]ID{}
+	rdfType, err := dictionary.GetID(rdf.NewNamedNode(ld.RDFType), rdf.Default)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	} else if err == nil {
+		// The POS index lists every rdf:type triple as (rdf:type, class, instance)
+		prefix := assembleKey(TernaryPrefixes[POS], true, rdfType)
+		iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			terms := strings.Split(string(iter.Item().Key()[len(prefix):]), "\t")
+			if len(terms) == 2 {
+				classes[ID(terms[1])] = append(classes[ID(terms[1])], ID(terms[0]))
+			}
+		}
+		iter.Close()
+	}
+
+	resource, err := dictionary.GetID(rdf.NewNamedNode(rdfsResource), rdf.Default)
+	if err == ErrNotFound {
+		resource = ID(rdf.NewNamedNode(rdfsResource).String())
+	} else if err != nil {
+		return nil, err
+	}
+
+	counts := map[[3]ID]uint64{}
+	prefix := []byte{TernaryPrefixes[SPO]}
+	iter := txn.NewIterator(KVIteratorOptions{PrefetchValues: false, Prefix: prefix})
+	defer iter.Close()
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		terms := strings.Split(string(iter.Item().Key()[1:]), "\t")
+		if len(terms) != 3 {
+			return nil, ErrCorruptIndex
+		}
+
+		domains := classes[ID(terms[0])]
+		if len(domains) == 0 {
+			domains = []ID{resource}
+		}
+
+		// Literals are counted by their datatype, which is kept as a (tab-free) IRI
+		// in place of a class ID and told apart by its tab prefix.
+		var ranges []ID
+		if o := ID(terms[2]); patternLiteral.MatchString(string(o)) {
+			term, err := dictionary.GetTerm(o, rdf.Default)
+			if err != nil {
+				return nil, err
+			}
+			var datatype string
+			if literal, is := term.(*rdf.Literal); is && literal.Datatype() != nil {
+				datatype = literal.Datatype().Value()
+			} else {
+				datatype = ld.XSDString
+			}
+			ranges = []ID{ID("\t" + datatype)}
+		} else if ranges = classes[o]; len(ranges) == 0 {
+			ranges = []ID{resource}
+		}
+
+		for _, domain := range domains {
+			for _, r := range ranges {
+				counts[[3]ID{domain, ID(terms[1]), r}]++
+			}
+		}
+	}
+
+	edges := make([]*SummaryEdge, 0, len(counts))
+	for key, count := range counts {
+		edge := &SummaryEdge{Count: count}
+		if edge.Domain, err = summaryTerm(dictionary, key[0], resource); err != nil {
+			return nil, err
+		} else if edge.Predicate, err = dictionary.GetTerm(key[1], rdf.Default); err != nil {
+			return nil, err
+		} else if edge.Range, err = summaryTerm(dictionary, key[2], resource); err != nil {
+			return nil, err
+		}
+		edges = append(edges, edge)
+	}
+
+	sort.Slice(edges, func(a, b int) bool { return edges[a].Count > edges[b].Count })
+	return edges, nil
+}
+
+func summaryTerm(dictionary Dictionary, id, resource ID) (rdf.Term, error) {
+	if id == resource {
+		return rdf.NewNamedNode(rdfsResource), nil
+	} else if strings.HasPrefix(string(id), "\t") {
+		return rdf.NewNamedNode(string(id[1:])), nil
+	}
+	return dictionary.GetTerm(id, rdf.Default)
+}
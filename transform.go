@@ -0,0 +1,135 @@
+package styx
+
+import (
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// A Transformer post-processes the solutions of an iterator as they stream out of Next.
+// The index is the complete solution, ordered by iter.Domain(). Transformers may return
+// a new slice of the same length, or nil to drop the solution entirely.
+type Transformer interface {
+	Transform(iter *Iterator, index []rdf.Term) []rdf.Term
+}
+
+// TransformerFunc adapts an ordinary function into a Transformer
+type TransformerFunc func(iter *Iterator, index []rdf.Term) []rdf.Term
+
+// Transform calls the underlying function
+func (f TransformerFunc) Transform(iter *Iterator, index []rdf.Term) []rdf.Term {
+	return f(iter, index)
+}
+
+// A TransformerFactory makes the transformers of one iterator. Config.Pipeline holds
+// factories rather than transformers so that transformers with state, like Dedupe,
+// are never shared between queries.
+type TransformerFactory func() Transformer
+
+// Pipe appends transformers to the iterator's pipeline. They are applied
+// in order after any transformers from the store's Config.Pipeline.
+func (iter *Iterator) Pipe(transformers ...Transformer) {
+	iter.pipeline = append(iter.pipeline, transformers...)
+}
+
+func (iter *Iterator) transform(index []rdf.Term) []rdf.Term {
+	for _, t := range iter.pipeline {
+		if index = t.Transform(iter, index); index == nil {
+			return nil
+		}
+	}
+	return index
+}
+
+// Dedupe returns a transformer that drops solutions identical to one already seen by it.
+// This is mostly useful after other transformers have made distinct solutions equal.
+// Dedupe is itself a TransformerFactory, so it can be put in Config.Pipeline directly.
+func Dedupe() Transformer {
+	seen := map[string]bool{}
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		values := make([]string, len(index))
+		for i, term := range index {
+			if term != nil {
+				values[i] = term.String()
+			}
+		}
+		value := strings.Join(values, "\t")
+		if seen[value] {
+			return nil
+		}
+		seen[value] = true
+		return index
+	})
+}
+
+// CompactIRIs returns a transformer that rewrites IRIs into compact "prefix:suffix"
+// form using the given map of prefixes to namespaces. The longest namespace wins.
+func CompactIRIs(prefixes map[string]string) Transformer {
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		result := make([]rdf.Term, len(index))
+		for i, term := range index {
+			result[i] = term
+			if term == nil || term.TermType() != rdf.NamedNodeType {
+				continue
+			}
+
+			value := term.Value()
+			var prefix, namespace string
+			for p, ns := range prefixes {
+				if strings.HasPrefix(value, ns) && len(ns) > len(namespace) {
+					prefix, namespace = p, ns
+				}
+			}
+
+			if namespace != "" {
+				result[i] = rdf.NewNamedNode(prefix + ":" + value[len(namespace):])
+			}
+		}
+		return result
+	})
+}
+
+// RedactPredicates returns a transformer that blanks out the values of variables
+// that occur in the object position of any of the given predicates in the query.
+func RedactPredicates(predicates ...string) Transformer {
+	set := make(map[string]bool, len(predicates))
+	for _, p := range predicates {
+		set[p] = true
+	}
+
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		result := make([]rdf.Term, len(index))
+		copy(result, index)
+		for _, quad := range iter.query {
+			if quad[1].TermType() != rdf.NamedNodeType || !set[quad[1].Value()] {
+				continue
+			}
+			if i, has := iter.ids[quad[2].String()]; has && i < len(result) {
+				result[i] = nil
+			}
+		}
+		return result
+	})
+}
+
+const xsdDateTime = "http://www.w3.org/2001/XMLSchema#dateTime"
+
+// FormatDates returns a transformer that re-formats xsd:dateTime literals
+// using the given time layout. The results are plain string literals.
+func FormatDates(layout string) Transformer {
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		result := make([]rdf.Term, len(index))
+		for i, term := range index {
+			result[i] = term
+			literal, is := term.(*rdf.Literal)
+			if !is || literal.Datatype() == nil || literal.Datatype().Value() != xsdDateTime {
+				continue
+			}
+
+			if value := ParseValue(literal); value.Kind == TimeValue {
+				result[i] = rdf.NewLiteral(value.Time.Format(layout), "", nil)
+			}
+		}
+		return result
+	})
+}
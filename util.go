@@ -8,7 +8,6 @@ import (
 	"regexp"
 	"strings"
 
-	badger "github.com/dgraph-io/badger/v2"
 	ld "github.com/piprate/json-gold/ld"
 	rdf "github.com/underlay/go-rdfjs"
 )
@@ -93,25 +92,38 @@ func assembleKey(prefix byte, tail bool, terms ...ID) []byte {
 	return key
 }
 
+// ConflictRetries is the number of times a write is retried after a transaction conflict
+const ConflictRetries = 3
+
+// retry calls f again (up to ConflictRetries times) while it fails with a transaction conflict.
+// f has to open its own transactions, so that each attempt reads fresh values.
+func retry(f func() error) (err error) {
+	for i := 0; i <= ConflictRetries; i++ {
+		if err = f(); err != ErrConflict {
+			return
+		}
+	}
+	return
+}
+
 // setSafe writes the entry and returns a new transaction if the old one was full.
-func setSafe(key, val []byte, txn *badger.Txn, db *badger.DB) (*badger.Txn, error) {
-	e := badger.NewEntry(key, val).WithMeta(key[0])
-	err := txn.SetEntry(e)
-	if err == badger.ErrTxnTooBig {
+func setSafe(key, val []byte, txn KVTxn, db KV) (KVTxn, error) {
+	err := txn.Set(key, val)
+	if err == ErrTxnTooBig {
 		err = txn.Commit()
 		if err != nil {
 			return nil, err
 		}
 		txn = db.NewTransaction(true)
-		err = txn.SetEntry(e)
+		err = txn.Set(key, val)
 	}
 	return txn, err
 }
 
 // deleteSafe deletes the entry and returns a new transaction if the old one was full.
-func deleteSafe(key []byte, txn *badger.Txn, db *badger.DB) (*badger.Txn, error) {
+func deleteSafe(key []byte, txn KVTxn, db KV) (KVTxn, error) {
 	err := txn.Delete(key)
-	if err == badger.ErrTxnTooBig {
+	if err == ErrTxnTooBig {
 		err = txn.Commit()
 		if err != nil {
 			return nil, err
@@ -146,21 +158,7 @@ var minor = matrix{
 }
 
 func getDataset(input interface{}, opts *ld.JsonLdOptions) (dataset *ld.RDFDataset, err error) {
-	var document interface{}
-	switch input := input.(type) {
-	case []byte:
-		err = json.Unmarshal(input, &document)
-	case string:
-		err = json.Unmarshal([]byte(input), &document)
-	case io.Reader:
-		err = json.NewDecoder(input).Decode(&document)
-	case map[string]interface{}:
-		document = input
-	case []interface{}:
-		document = input
-	default:
-		err = ErrInvalidInput
-	}
+	document, err := decodeDocument(input)
 	if err != nil {
 		return
 	}
@@ -181,6 +179,25 @@ func getDataset(input interface{}, opts *ld.JsonLdOptions) (dataset *ld.RDFDatas
 	return
 }
 
+// decodeDocument parses a JSON document given as bytes, a string, or a reader
+func decodeDocument(input interface{}) (document interface{}, err error) {
+	switch input := input.(type) {
+	case []byte:
+		err = json.Unmarshal(input, &document)
+	case string:
+		err = json.Unmarshal([]byte(input), &document)
+	case io.Reader:
+		err = json.NewDecoder(input).Decode(&document)
+	case map[string]interface{}:
+		document = input
+	case []interface{}:
+		document = input
+	default:
+		err = ErrInvalidInput
+	}
+	return
+}
+
 func fromLdDataset(dataset *ld.RDFDataset, base string) []*rdf.Quad {
 	result := []*rdf.Quad{}
 	for _, quads := range dataset.Graphs {
@@ -0,0 +1,133 @@
+package styx
+
+import (
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// Datasets annotate the valid time of their named graphs with schema:validFrom and
+// schema:validThrough dateTime or date literals, asserted about the graph's name in
+// the same dataset. Valid time is when the graph's assertions hold in the world, as
+// opposed to AsOf, which is when the store held them.
+
+// QueryValidAt is like Query, but only considers the triples that some dataset asserted
+// in a graph that is valid at t. Graphs without a validFrom are valid since forever and
+// graphs without a validThrough are valid from then on, so the default graph and graphs
+// without annotations are always valid.
+func (s *Store) QueryValidAt(pattern []*rdf.Quad, t time.Time) (*Iterator, error) {
+	return s.QueryWithOptions(pattern, nil, nil, &QueryOptions{ValidAt: t})
+}
+
+type datasetGraph struct {
+	base  iri
+	graph ID
+}
+
+// validAtFilter returns a transformer that drops solutions with a quad
+// that no dataset asserted in a graph that is valid at t
+func validAtFilter(t time.Time) Transformer {
+	// Each graph's annotations are read once per query
+	valid := map[datasetGraph]bool{}
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		for _, quad := range iter.query {
+			ids := [3]ID{iter.lookup(quad[0]), iter.lookup(quad[1]), iter.lookup(quad[2])}
+			statements, err := iter.getStatements(ids)
+			if err != nil {
+				return nil
+			}
+
+			asserted := false
+			for _, statement := range statements {
+				if statement == nil {
+					continue
+				}
+
+				key := datasetGraph{statement.base, statement.graph}
+				v, has := valid[key]
+				if !has {
+					v, err = iter.validAt(statement, t)
+					if err != nil {
+						return nil
+					}
+					valid[key] = v
+				}
+
+				if v {
+					asserted = true
+					break
+				}
+			}
+
+			if !asserted {
+				return nil
+			}
+		}
+		return index
+	})
+}
+
+// validAt reports whether the graph of a statement is valid at t,
+// according to the annotations of the statement's dataset
+func (iter *Iterator) validAt(statement *Statement, t time.Time) (bool, error) {
+	for _, namespace := range schemaNamespaces {
+		for _, name := range []string{"validFrom", "validThrough"} {
+			predicate, err := iter.dictionary.GetID(rdf.NewNamedNode(namespace+name), rdf.Default)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return false, err
+			}
+
+			bounds, err := iter.annotations(statement, predicate)
+			if err != nil {
+				return false, err
+			}
+
+			for _, bound := range bounds {
+				if name == "validFrom" && t.Before(bound) || name == "validThrough" && t.After(bound) {
+					return false, nil
+				}
+			}
+		}
+	}
+	return true, nil
+}
+
+// annotations returns the temporal objects of a predicate of a statement's graph that the
+// statement's dataset asserts. Objects that aren't dateTime or date literals are skipped.
+func (iter *Iterator) annotations(statement *Statement, predicate ID) ([]time.Time, error) {
+	prefix := assembleKey(TernaryPrefixes[0], true, statement.graph, predicate)
+	cursor := iter.txn.NewIterator(KVIteratorOptions{PrefetchValues: true, Prefix: prefix})
+	defer cursor.Close()
+
+	var bounds []time.Time
+	for cursor.Seek(prefix); cursor.ValidForPrefix(prefix); cursor.Next() {
+		var asserted bool
+		err := cursor.Item().Value(func(val []byte) error {
+			statements, err := getStatements(val)
+			for _, s := range statements {
+				asserted = asserted || s != nil && s.base == statement.base
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		} else if !asserted {
+			continue
+		}
+
+		object := ID(cursor.Item().Key()[len(prefix):])
+		term, err := iter.dictionary.GetTerm(object, rdf.Default)
+		if err != nil {
+			return nil, err
+		}
+
+		if literal, is := term.(*rdf.Literal); is {
+			if value := ParseValue(literal); value.Kind == TimeValue {
+				bounds = append(bounds, value.Time)
+			}
+		}
+	}
+	return bounds, nil
+}
@@ -0,0 +1,146 @@
+package styx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema#"
+
+// numericTypes are the local names of the XSD datatypes parsed as numbers
+var numericTypes = map[string]bool{
+	"integer": true, "decimal": true, "double": true, "float": true,
+	"int": true, "long": true, "short": true, "byte": true,
+	"nonNegativeInteger": true, "nonPositiveInteger": true,
+	"positiveInteger": true, "negativeInteger": true,
+	"unsignedInt": true, "unsignedLong": true, "unsignedShort": true, "unsignedByte": true,
+}
+
+// temporalLayouts are the layouts that XSD temporal datatypes are parsed with
+var temporalLayouts = map[string]string{
+	"dateTime": time.RFC3339Nano,
+	"date":     "2006-01-02",
+}
+
+// A ValueKind is the kind of representation parsed from a literal
+type ValueKind uint8
+
+const (
+	// StringValue is the kind of literals that are only compared by their lexical form
+	StringValue ValueKind = iota
+	// NumberValue is the kind of literals with numeric XSD datatypes
+	NumberValue
+	// BooleanValue is the kind of xsd:boolean literals
+	BooleanValue
+	// TimeValue is the kind of xsd:dateTime and xsd:date literals
+	TimeValue
+)
+
+// A Value is a literal together with the representation parsed from its datatype,
+// so that literals like "1"^^xsd:integer and "01"^^xsd:integer compare as equal.
+// Literals with lexical forms that aren't valid for their datatype are StringValues.
+type Value struct {
+	Literal *rdf.Literal
+	Kind    ValueKind
+	Number  float64
+	Boolean bool
+	Time    time.Time
+}
+
+// ParseValue parses the representation of a literal from its datatype
+func ParseValue(literal *rdf.Literal) Value {
+	value := Value{Literal: literal, Kind: StringValue}
+	datatype := literal.Datatype()
+	if datatype == nil || !strings.HasPrefix(datatype.Value(), xsdNamespace) {
+		return value
+	}
+
+	name, lexical := strings.TrimPrefix(datatype.Value(), xsdNamespace), strings.TrimSpace(literal.Value())
+	if numericTypes[name] {
+		if number, err := strconv.ParseFloat(lexical, 64); err == nil && !math.IsNaN(number) {
+			value.Kind, value.Number = NumberValue, number
+		}
+	} else if name == "boolean" {
+		if boolean, err := strconv.ParseBool(lexical); err == nil {
+			value.Kind, value.Boolean = BooleanValue, boolean
+		}
+	} else if layout, has := temporalLayouts[name]; has {
+		if t, err := time.Parse(layout, lexical); err == nil {
+			value.Kind, value.Time = TimeValue, t
+		}
+	}
+
+	return value
+}
+
+// Compare orders two values of the same kind, returning -1, 0, or 1. Values of
+// different kinds aren't comparable, and ok is false. StringValues are compared
+// by lexical form, and only if they have the same datatype and language.
+func (v Value) Compare(w Value) (result int, ok bool) {
+	if v.Kind != w.Kind {
+		return 0, false
+	}
+
+	switch v.Kind {
+	case NumberValue:
+		return compareFloats(v.Number, w.Number), true
+	case BooleanValue:
+		if v.Boolean == w.Boolean {
+			return 0, true
+		} else if w.Boolean {
+			return -1, true
+		}
+		return 1, true
+	case TimeValue:
+		if v.Time.Before(w.Time) {
+			return -1, true
+		} else if v.Time.After(w.Time) {
+			return 1, true
+		}
+		return 0, true
+	default:
+		if v.Literal.Language() != w.Literal.Language() || !sameDatatype(v.Literal, w.Literal) {
+			return 0, false
+		}
+		return strings.Compare(v.Literal.Value(), w.Literal.Value()), true
+	}
+}
+
+// Equal reports whether two values have the same representation
+func (v Value) Equal(w Value) bool {
+	result, ok := v.Compare(w)
+	return ok && result == 0
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func sameDatatype(a, b *rdf.Literal) bool {
+	if a.Datatype() == nil || b.Datatype() == nil {
+		return a.Datatype() == nil && b.Datatype() == nil
+	}
+	return a.Datatype().Equal(b.Datatype())
+}
+
+// FilterValues returns a transformer that drops solutions binding the variable to a
+// literal whose parsed value doesn't satisfy keep. Solutions that bind the variable
+// to something other than a literal are dropped too.
+func FilterValues(variable rdf.Term, keep func(value Value) bool) Transformer {
+	return TransformerFunc(func(iter *Iterator, index []rdf.Term) []rdf.Term {
+		literal, is := iter.Get(variable).(*rdf.Literal)
+		if !is || !keep(ParseValue(literal)) {
+			return nil
+		}
+		return index
+	})
+}
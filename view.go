@@ -0,0 +1,889 @@
+package styx
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// SetView registers a materialized view. A view is a CONSTRUCT-style query pattern
+// whose solutions are stored as an ordinary dataset under the given node, so it can
+// be read with Get and joined against in queries like any other graph, and whose
+// bindings can be read with View. The view is updated whenever a dataset that
+// uses one of its predicates is set or deleted. Views don't see each other's datasets.
+func (s *Store) SetView(node rdf.Term, pattern []*rdf.Quad) error {
+	val, err := json.Marshal(pattern)
+	if err != nil {
+		return err
+	}
+
+	dictionary := s.Config.Dictionary.Open(true)
+	origin, err := dictionary.GetID(node, rdf.Default)
+	if err != nil {
+		dictionary.Commit()
+		return err
+	}
+
+	err = dictionary.Commit()
+	if err != nil {
+		return err
+	}
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	key := assembleKey(ViewPrefix, false, origin)
+	previous := pattern
+	err = updateTxn(s.KV, func(txn KVTxn) error {
+		item, err := txn.Get(key)
+		if err == nil {
+			err = item.Value(func(val []byte) error { return json.Unmarshal(val, &previous) })
+		} else if err == ErrKeyNotFound {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.refreshView(node, pattern, previous)
+}
+
+// DeleteView removes a materialized view and its dataset
+func (s *Store) DeleteView(node rdf.Term) error {
+	dictionary := s.Config.Dictionary.Open(false)
+	origin, err := dictionary.GetID(node, rdf.Default)
+	dictionary.Commit()
+	if err != nil {
+		return err
+	}
+
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	key := assembleKey(ViewPrefix, false, origin)
+	var pattern []*rdf.Quad
+	err = viewTxn(s.KV, func(txn KVTxn) error {
+		item, err := txn.Get(key)
+		if err == ErrKeyNotFound {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error { return json.Unmarshal(val, &pattern) })
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove the view's triples using its stored bindings, since the
+	// quad store might not remember what the view's dataset contains
+	bindings, err := s.getBindings(origin)
+	if err == ErrNotFound {
+		err = retry(func() error { return s.delete(node) })
+	} else if err == nil {
+		var removed []*rdf.Quad
+		removed, err = viewQuads(pattern, bindings)
+		if err == nil {
+			err = retry(func() error { return s.patchView(node, nil, removed, nil, 0) })
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = updateTxn(s.KV, func(txn KVTxn) error {
+		err := txn.Delete(assembleKey(BindingsPrefix, false, origin))
+		if err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+	s.results.clear()
+	return err
+}
+
+type view struct {
+	node    rdf.Term
+	pattern []*rdf.Quad
+}
+
+func (s *Store) getViews() ([]*view, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	iter := txn.NewIterator(KVIteratorOptions{
+		PrefetchValues: true,
+		Prefix:         []byte{ViewPrefix},
+	})
+	defer iter.Close()
+
+	views := []*view{}
+	for iter.Seek([]byte{ViewPrefix}); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		node, err := dictionary.GetTerm(ID(item.KeyCopy(nil)[1:]), rdf.Default)
+		if err != nil {
+			return nil, err
+		}
+
+		v := &view{node: node}
+		err = item.Value(func(val []byte) error { return json.Unmarshal(val, &v.pattern) })
+		if err != nil {
+			return nil, err
+		}
+
+		views = append(views, v)
+	}
+
+	return views, nil
+}
+
+// viewNodes returns the datasets of the views
+func viewNodes(views []*view) []rdf.Term {
+	nodes := make([]rdf.Term, len(views))
+	for i, v := range views {
+		nodes[i] = v.node
+	}
+	return nodes
+}
+
+// refreshViews updates every view that shares a predicate with the quads that a write
+// to a dataset removed or added. Views with a variable predicate are always updated.
+func (s *Store) refreshViews(node rdf.Term, removed, added []*rdf.Quad) error {
+	views, err := s.getViews()
+	if err != nil {
+		return err
+	}
+
+	predicates := getPredicates(append(append([]*rdf.Quad{}, removed...), added...))
+	exclude := viewNodes(views)
+	var delta [2][]*rdf.Quad
+	for _, v := range views {
+		if v.node.Equal(node) || !overlaps(v.pattern, predicates) {
+			continue
+		}
+
+		if delta[0] == nil {
+			delta[0], err = s.skolemize(node, removed)
+			if err != nil {
+				return err
+			}
+			delta[1], err = s.skolemize(node, added)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.maintainView(v.node, v.pattern, delta[0], delta[1], exclude)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPredicates returns the set of predicates used in a dataset
+func getPredicates(dataset []*rdf.Quad) map[string]bool {
+	predicates := make(map[string]bool, len(dataset))
+	for _, quad := range dataset {
+		if quad[1].TermType() == rdf.NamedNodeType {
+			predicates[quad[1].Value()] = true
+		}
+	}
+	return predicates
+}
+
+// overlaps reports whether a query pattern might match quads with the given predicates.
+// Patterns with variable predicates overlap with everything.
+func overlaps(pattern []*rdf.Quad, predicates map[string]bool) bool {
+	for _, quad := range pattern {
+		switch quad[1].TermType() {
+		case rdf.VariableType, rdf.BlankNodeType:
+			return true
+		case rdf.NamedNodeType:
+			predicate, _, _, ok := explicitPath(quad[1].Value())
+			if !ok {
+				predicate = quad[1].Value()
+			}
+			if predicates[predicate] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refreshView re-computes a view and updates its dataset with the difference between
+// the quads of its new solutions and those of the bindings stored with the previous pattern.
+// Solutions that only hold through the datasets of views are left out.
+func (s *Store) refreshView(node rdf.Term, pattern, previous []*rdf.Quad) error {
+	views, err := s.getViews()
+	if err != nil {
+		return err
+	}
+
+	exclude := viewNodes(views)
+	iter, err := s.internalQuery(context.Background(), nil, pattern, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	defer iter.Close()
+
+	bindings := &viewBindings{Domain: formatTerms(iter.Domain()), Bindings: [][]string{}}
+	d, err := iter.Next(nil)
+	for ; d != nil; d, err = iter.Next(nil) {
+		outside, err := iter.assertedOutside(exclude)
+		if err != nil {
+			return err
+		} else if outside {
+			bindings.Bindings = append(bindings.Bindings, formatTerms(iter.Index()))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.writeView(node, pattern, previous, bindings)
+}
+
+// maintainView updates the bindings of a view from the triples that a write removed and
+// added, which are named the way that queries return them. Bindings that put a removed
+// triple in the pattern are dropped unless all of their triples are still asserted, and
+// the pattern is solved again with each quad bound to each added triple that it matches.
+// Views with transitive paths or without stored bindings are re-computed in full.
+func (s *Store) maintainView(node rdf.Term, pattern []*rdf.Quad, removed, added []*rdf.Quad, exclude []rdf.Term) error {
+	query, paths := compilePaths(pattern)
+	if len(paths) > 0 {
+		return s.refreshView(node, pattern, pattern)
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	origin, err := dictionary.GetID(node, rdf.Default)
+	dictionary.Commit()
+	if err != nil {
+		return err
+	}
+
+	old, err := s.getBindings(origin)
+	if err == ErrNotFound {
+		return s.refreshView(node, pattern, pattern)
+	} else if err != nil {
+		return err
+	}
+
+	domain, err := parseTerms(old.Domain)
+	if err != nil {
+		return err
+	}
+
+	bindings := &viewBindings{Domain: old.Domain, Bindings: [][]string{}}
+	keys := make(map[string]bool, len(old.Bindings))
+
+	removedTriples := make(map[string]bool, len(removed))
+	for _, quad := range removed {
+		removedTriples[rdf.NewQuad(quad[0], quad[1], quad[2], rdf.Default).String()] = true
+	}
+
+	for _, binding := range old.Bindings {
+		index, err := parseTerms(binding)
+		if err != nil {
+			return err
+		}
+
+		terms := bindingTerms(domain, index)
+		if stale(query, terms, removedTriples) {
+			solutions, err := s.solveBound(query, domain, terms, exclude)
+			if err != nil {
+				return err
+			} else if len(solutions) == 0 {
+				continue
+			}
+		}
+
+		key := strings.Join(binding, "\t")
+		if !keys[key] {
+			keys[key] = true
+			bindings.Bindings = append(bindings.Bindings, binding)
+		}
+	}
+
+	for _, quad := range query {
+		for _, triple := range added {
+			terms := unify(quad, triple)
+			if terms == nil {
+				continue
+			}
+
+			solutions, err := s.solveBound(query, domain, terms, exclude)
+			if err != nil {
+				return err
+			}
+
+			for _, solution := range solutions {
+				binding := formatTerms(solution)
+				if key := strings.Join(binding, "\t"); !keys[key] {
+					keys[key] = true
+					bindings.Bindings = append(bindings.Bindings, binding)
+				}
+			}
+		}
+	}
+
+	return s.writeView(node, pattern, pattern, bindings)
+}
+
+// solveBound returns the solutions of a pattern, ordered by the domain, that extend
+// the given terms for some of its variables without only holding through the excluded datasets
+func (s *Store) solveBound(query []*rdf.Quad, domain []rdf.Term, terms map[string]rdf.Term, exclude []rdf.Term) ([][]rdf.Term, error) {
+	var constant, open []*rdf.Quad
+	for _, quad := range substitute(query, terms) {
+		if isVariable(quad[0]) || isVariable(quad[1]) || isVariable(quad[2]) {
+			open = append(open, quad)
+		} else {
+			constant = append(constant, quad)
+		}
+	}
+
+	// The query engine doesn't check triples without variables
+	holds, err := s.holds(constant, exclude)
+	if err != nil || !holds {
+		return nil, err
+	}
+
+	solution := func(get func(rdf.Term) rdf.Term) []rdf.Term {
+		index := make([]rdf.Term, len(domain))
+		for i, term := range domain {
+			if value, has := terms[term.String()]; has {
+				index[i] = value
+			} else {
+				index[i] = get(term)
+			}
+		}
+		return index
+	}
+
+	if len(open) == 0 {
+		return [][]rdf.Term{solution(func(rdf.Term) rdf.Term { return nil })}, nil
+	}
+
+	iter, err := s.internalQuery(context.Background(), nil, open, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+
+	solutions := [][]rdf.Term{}
+	d, err := iter.Next(nil)
+	for ; d != nil; d, err = iter.Next(nil) {
+		outside, err := iter.assertedOutside(exclude)
+		if err != nil {
+			return nil, err
+		} else if outside {
+			solutions = append(solutions, solution(iter.Get))
+		}
+	}
+	return solutions, err
+}
+
+// holds reports whether every one of the triples is asserted by some dataset
+// other than the excluded ones
+func (s *Store) holds(triples []*rdf.Quad, exclude []rdf.Term) (bool, error) {
+	if len(triples) == 0 {
+		return true, nil
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	defer func() { dictionary.Commit() }()
+
+	excluded := make(map[ID]bool, len(exclude))
+	for _, node := range exclude {
+		id, err := dictionary.GetID(node, rdf.Default)
+		if err == nil {
+			excluded[id] = true
+		} else if err != ErrNotFound {
+			return false, err
+		}
+	}
+
+	txn := s.KV.NewTransaction(false)
+	defer txn.Discard()
+
+	for _, triple := range triples {
+		var ids [3]ID
+		for i, term := range triple[:3] {
+			var err error
+			ids[i], err = dictionary.GetID(term, rdf.Default)
+			if err == ErrNotFound {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+		}
+
+		item, err := txn.Get(assembleKey(TernaryPrefixes[0], false, ids[0], ids[1], ids[2]))
+		if err == ErrKeyNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		var statements []*Statement
+		err = item.Value(func(val []byte) (err error) {
+			statements, err = getStatements(val)
+			return
+		})
+		if err != nil {
+			return false, err
+		}
+
+		outside := false
+		for _, statement := range statements {
+			outside = outside || !excluded[ID(statement.base)]
+		}
+		if !outside {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// stale reports whether substituting the terms into the pattern gives one of the removed triples
+func stale(query []*rdf.Quad, terms map[string]rdf.Term, removed map[string]bool) bool {
+	for _, triple := range substitute(query, terms) {
+		if removed[triple.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// bindingTerms maps the variables of a view's domain to the terms of a binding
+func bindingTerms(domain, index []rdf.Term) map[string]rdf.Term {
+	terms := make(map[string]rdf.Term, len(domain))
+	for i, term := range domain {
+		if i < len(index) && index[i] != nil {
+			terms[term.String()] = index[i]
+		}
+	}
+	return terms
+}
+
+// substitute replaces the variables of a pattern that have terms, in the default graph
+func substitute(query []*rdf.Quad, terms map[string]rdf.Term) []*rdf.Quad {
+	result := make([]*rdf.Quad, len(query))
+	for i, quad := range query {
+		var triple [3]rdf.Term
+		for j, term := range quad[:3] {
+			triple[j] = term
+			if value, has := terms[term.String()]; has && isVariable(term) {
+				triple[j] = value
+			}
+		}
+		result[i] = rdf.NewQuad(triple[0], triple[1], triple[2], rdf.Default)
+	}
+	return result
+}
+
+// unify returns the terms that a pattern quad's variables take to match a triple,
+// or nil if it doesn't match
+func unify(quad *rdf.Quad, triple *rdf.Quad) map[string]rdf.Term {
+	terms := map[string]rdf.Term{}
+	for j, term := range quad[:3] {
+		if !isVariable(term) {
+			if !term.Equal(triple[j]) {
+				return nil
+			}
+		} else if value, has := terms[term.String()]; has && !value.Equal(triple[j]) {
+			return nil
+		} else {
+			terms[term.String()] = triple[j]
+		}
+	}
+	return terms
+}
+
+// writeView stores the bindings of a view and updates its dataset with the difference
+// between the quads of the bindings and those of the bindings stored with the previous pattern
+func (s *Store) writeView(node rdf.Term, pattern, previous []*rdf.Quad, bindings *viewBindings) error {
+	quads, err := viewQuads(pattern, bindings)
+	if err != nil {
+		return err
+	}
+
+	dictionary := s.Config.Dictionary.Open(false)
+	origin, err := dictionary.GetID(node, rdf.Default)
+	dictionary.Commit()
+	if err != nil {
+		return err
+	}
+
+	old, err := s.getBindings(origin)
+	if err == ErrNotFound {
+		// Without previous bindings we don't know which triples belong
+		// to the view, so scan for them and replace the whole dataset.
+		bindings.Next = uint64(len(quads))
+		err = s.setBindings(origin, bindings)
+		if err != nil {
+			return err
+		}
+
+		var removed []*rdf.Quad
+		err = retry(func() (err error) {
+			removed, err = s.set(context.Background(), node, quads, true, nil, true)
+			return
+		})
+		s.results.invalidate(append(removed, quads...))
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	values := make(map[string]bool, len(quads))
+	for _, quad := range quads {
+		values[quad.String()] = true
+	}
+
+	oldQuads, err := viewQuads(previous, old)
+	if err != nil {
+		return err
+	}
+
+	// Statements written before indices were tracked are numbered from zero
+	bindings.Next = old.Next
+	if n := uint64(len(oldQuads)); n > bindings.Next {
+		bindings.Next = n
+	}
+
+	oldValues := make(map[string]bool, len(oldQuads))
+	removed := []*rdf.Quad{}
+	for _, quad := range oldQuads {
+		value := quad.String()
+		oldValues[value] = true
+		if !values[value] {
+			removed = append(removed, quad)
+		}
+	}
+
+	added := []*rdf.Quad{}
+	for _, quad := range quads {
+		if !oldValues[quad.String()] {
+			added = append(added, quad)
+		}
+	}
+
+	next := bindings.Next
+	bindings.Next += uint64(len(added))
+	err = s.setBindings(origin, bindings)
+	if err != nil || len(removed) == 0 && len(added) == 0 {
+		return err
+	}
+
+	err = retry(func() error { return s.patchView(node, quads, removed, added, next) })
+	s.results.invalidate(append(removed, added...))
+	return err
+}
+
+// patchView removes and inserts quads in a view's dataset, which afterwards holds the given
+// quads. The inserted statements are numbered from next, so that they don't collide with
+// the ones that are kept.
+func (s *Store) patchView(node rdf.Term, quads, removed, added []*rdf.Quad, next uint64) (err error) {
+	dictionary := s.Config.Dictionary.Open(true)
+	txn := s.KV.NewTransaction(true)
+	defer func() { txn.Discard(); dictionary.Commit() }()
+
+	origin, err := dictionary.GetID(node, rdf.Default)
+	if err != nil {
+		return
+	}
+
+	ids, err := getQuadIDs(removed, node, dictionary)
+	if err != nil {
+		return
+	}
+
+	txn, err = deleteQuads(origin, ids, dictionary, txn, s.KV, s.Config.Checksums)
+	if err != nil {
+		return
+	}
+
+	ids, err = getQuadIDs(added, node, dictionary)
+	if err != nil {
+		return
+	}
+
+	uc := newUnaryCache()
+	bc := newBinaryCache()
+	for i, quad := range ids {
+		source := &Statement{base: iri(origin), index: next + uint64(i), graph: quad[3]}
+		txn, err = insertStatement([3]ID{quad[0], quad[1], quad[2]}, source, bc, uc, txn, s.KV, s.Config.Checksums)
+		if err != nil {
+			return
+		}
+	}
+
+	// A quantity's value and unit can be split between kept and changed
+	// quads, so the quantities are re-indexed from the whole dataset
+	inserted := make(map[string]bool, len(added))
+	for _, quad := range added {
+		inserted[quad.String()] = true
+	}
+
+	previousQuads := append([]*rdf.Quad{}, removed...)
+	for _, quad := range quads {
+		if !inserted[quad.String()] {
+			previousQuads = append(previousQuads, quad)
+		}
+	}
+
+	for i, dataset := range [][]*rdf.Quad{previousQuads, quads} {
+		ids, err = getQuadIDs(dataset, node, dictionary)
+		if err != nil {
+			return
+		}
+		txn, err = indexQuantities(origin, ids, dictionary, node, i == 0, txn, s.KV)
+		if err != nil {
+			return
+		}
+		txn, err = indexGeometries(origin, ids, dictionary, node, i == 0, txn, s.KV)
+		if err != nil {
+			return
+		}
+		txn, err = indexLanguages(ids, i == 0, txn, s.KV)
+		if err != nil {
+			return
+		}
+	}
+
+	previous, err := getDatasetUsage(origin, txn)
+	if err != nil {
+		return
+	}
+
+	var usage *Usage
+	if len(quads) > 0 {
+		usage = getUsage(quads)
+	}
+
+	txn, err = setUsage(origin, previous, usage, nil, txn, s.KV)
+	if err != nil {
+		return
+	}
+
+	txn, err = bc.Commit(s.KV, txn, s.Config.Checksums)
+	if err != nil {
+		return
+	}
+
+	txn, err = uc.Commit(s.KV, txn, s.Config.Checksums)
+	if err != nil {
+		return
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return
+	}
+
+	if len(quads) == 0 {
+		err = s.Config.QuadStore.Delete(origin)
+		if err == ErrNotFound {
+			err = nil
+		}
+		return
+	}
+
+	ids, err = getQuadIDs(quads, node, dictionary)
+	if err != nil {
+		return
+	}
+
+	return s.Config.QuadStore.Set(origin, ids)
+}
+
+// getQuadIDs translates quads into IDs
+func getQuadIDs(quads []*rdf.Quad, node rdf.Term, dictionary Dictionary) ([][4]ID, error) {
+	ids := make([][4]ID, len(quads))
+	for i, quad := range quads {
+		for j := range quad {
+			id, err := dictionary.GetID(quad[j], node)
+			if err != nil {
+				return nil, err
+			}
+			ids[i][j] = id
+		}
+	}
+	return ids, nil
+}
+
+// viewQuads substitutes a view's bindings into its pattern, like Iterator.Graph,
+// and returns the distinct quads
+func viewQuads(pattern []*rdf.Quad, bindings *viewBindings) ([]*rdf.Quad, error) {
+	query, _ := compilePaths(pattern)
+	quads := []*rdf.Quad{}
+	values := map[string]bool{}
+	for _, binding := range bindings.Bindings {
+		index, err := parseTerms(binding)
+		if err != nil {
+			return nil, err
+		}
+
+		terms := make(map[string]rdf.Term, len(index))
+		for i, term := range index {
+			if term != nil && i < len(bindings.Domain) {
+				terms[bindings.Domain[i]] = term
+			}
+		}
+
+		for _, quad := range query {
+			var triple [3]rdf.Term
+			for j, term := range quad[:3] {
+				if isVariable(term) {
+					triple[j] = terms[term.String()]
+				} else {
+					triple[j] = term
+				}
+			}
+
+			if triple[0] == nil || triple[1] == nil || triple[2] == nil {
+				continue
+			}
+
+			q := rdf.NewQuad(triple[0], triple[1], triple[2], rdf.Default)
+			if value := q.String(); !values[value] {
+				values[value] = true
+				quads = append(quads, q)
+			}
+		}
+	}
+	return quads, nil
+}
+
+type viewBindings struct {
+	Domain   []string   `json:"domain"`
+	Bindings [][]string `json:"bindings"`
+	Next     uint64     `json:"next,omitempty"`
+}
+
+func (s *Store) getBindings(origin ID) (*viewBindings, error) {
+	bindings := &viewBindings{}
+	err := viewTxn(s.KV, func(txn KVTxn) error {
+		item, err := txn.Get(assembleKey(BindingsPrefix, false, origin))
+		if err == ErrKeyNotFound {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error { return json.Unmarshal(val, bindings) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+func (s *Store) setBindings(origin ID, bindings *viewBindings) error {
+	val, err := json.Marshal(bindings)
+	if err != nil {
+		return err
+	}
+
+	key := assembleKey(BindingsPrefix, false, origin)
+	return retry(func() error {
+		return updateTxn(s.KV, func(txn KVTxn) error { return txn.Set(key, val) })
+	})
+}
+
+// A ViewCursor iterates over the precomputed solutions of a materialized view
+type ViewCursor struct {
+	domain   []rdf.Term
+	bindings [][]string
+	index    []rdf.Term
+}
+
+// View returns a cursor over the solutions of a materialized view,
+// as of the last time it was re-computed
+func (s *Store) View(node rdf.Term) (*ViewCursor, error) {
+	dictionary := s.Config.Dictionary.Open(false)
+	origin, err := dictionary.GetID(node, rdf.Default)
+	dictionary.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, err := s.getBindings(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := parseTerms(bindings.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ViewCursor{domain: domain, bindings: bindings.Bindings}, nil
+}
+
+// Domain returns the variables of the view's pattern
+func (c *ViewCursor) Domain() []rdf.Term { return c.domain }
+
+// Index returns the cursor's current solution
+func (c *ViewCursor) Index() []rdf.Term { return c.index }
+
+// Next advances the cursor to the next solution and returns it,
+// or returns nil when there are no more solutions.
+func (c *ViewCursor) Next() ([]rdf.Term, error) {
+	if len(c.bindings) == 0 {
+		c.index = nil
+		return nil, nil
+	}
+
+	index, err := parseTerms(c.bindings[0])
+	if err != nil {
+		return nil, err
+	}
+
+	c.bindings, c.index = c.bindings[1:], index
+	return index, nil
+}
+
+// Close the cursor
+func (c *ViewCursor) Close() {
+	c.bindings, c.index = nil, nil
+}
+
+// formatTerms serializes terms, leaving redacted (nil) terms empty
+func formatTerms(terms []rdf.Term) []string {
+	values := make([]string, len(terms))
+	for i, term := range terms {
+		if term != nil {
+			values[i] = term.String()
+		}
+	}
+	return values
+}
+
+func parseTerms(values []string) (terms []rdf.Term, err error) {
+	terms = make([]rdf.Term, len(values))
+	for i, value := range values {
+		if value != "" {
+			terms[i], err = rdf.ParseTerm(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,174 @@
+package styx
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+// WebhookRetries is the number of times a failed webhook delivery is retried,
+// waiting twice as long before each attempt (starting at one second)
+const WebhookRetries = 3
+
+// WebhookTimeout bounds each webhook request made without a custom Client
+const WebhookTimeout = 10 * time.Second
+
+// WebhookQueueSize is the number of events that can wait to be delivered to each webhook
+const WebhookQueueSize = 64
+
+var webhookClient = &http.Client{Timeout: WebhookTimeout}
+
+// WebhookSignatureHeader is the header that carries "sha256=" and the hex-encoded HMAC-SHA256
+// signature of the request body, when the webhook has a secret
+const WebhookSignatureHeader = "X-Styx-Signature"
+
+// A Webhook is an HTTP endpoint that gets POSTed JSON events. If Pattern is nil,
+// it receives an "ingest" event for every dataset that is inserted. Otherwise
+// it receives a "match" event for every new solution to the pattern, like Subscribe.
+type Webhook struct {
+	URL     string
+	Secret  []byte
+	Pattern []*rdf.Quad
+	Client  *http.Client
+	queue   chan *WebhookEvent
+}
+
+// A WebhookEvent is the body of a webhook request
+type WebhookEvent struct {
+	Event    string   `json:"event"`
+	Dataset  string   `json:"dataset,omitempty"`
+	Quads    int      `json:"quads,omitempty"`
+	Solution []string `json:"solution,omitempty"`
+}
+
+// AddWebhook registers a webhook and returns a function that removes it.
+// Events are delivered in order by a background worker, and are dropped
+// if more than WebhookQueueSize of them are waiting.
+func (s *Store) AddWebhook(hook *Webhook) (func(), error) {
+	if hook.Pattern != nil {
+		results, cancel, err := s.Subscribe(hook.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		hook.start()
+		go func() {
+			defer close(hook.queue)
+			for index := range results {
+				solution := make([]string, len(index))
+				for i, term := range index {
+					if term != nil {
+						solution[i] = term.String()
+					}
+				}
+				s.enqueue(hook, &WebhookEvent{Event: "match", Solution: solution})
+			}
+		}()
+
+		return cancel, nil
+	}
+
+	hook.start()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.webhooks == nil {
+		s.webhooks = map[*Webhook]bool{}
+	}
+	s.webhooks[hook] = true
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.lock.Lock()
+			delete(s.webhooks, hook)
+			close(hook.queue)
+			s.lock.Unlock()
+		})
+	}, nil
+}
+
+// notify queues an ingest event for every ingestion webhook
+func (s *Store) notify(node rdf.Term, dataset []*rdf.Quad) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	event := &WebhookEvent{Event: "ingest", Dataset: node.Value(), Quads: len(dataset)}
+	for hook := range s.webhooks {
+		s.enqueue(hook, event)
+	}
+}
+
+// enqueue queues an event without blocking, dropping it if the queue is full
+func (s *Store) enqueue(hook *Webhook, event *WebhookEvent) {
+	select {
+	case hook.queue <- event:
+	default:
+		s.Config.Logger.Warn("Webhook queue full, dropping event", Field{"url", hook.URL}, Field{"event", event.Event})
+	}
+}
+
+// start creates the webhook's queue and the worker that delivers its events
+func (hook *Webhook) start() {
+	hook.queue = make(chan *WebhookEvent, WebhookQueueSize)
+	go func() {
+		for event := range hook.queue {
+			hook.deliver(event)
+		}
+	}()
+}
+
+// deliver POSTs the event, retrying on errors and 5xx responses
+func (hook *Webhook) deliver(event *WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	client := hook.Client
+	if client == nil {
+		client = webhookClient
+	}
+
+	delay := time.Second
+	for i := 0; ; i++ {
+		err = hook.post(client, body)
+		if err == nil || i == WebhookRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (hook *Webhook) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if hook.Secret != nil {
+		mac := hmac.New(sha256.New, hook.Secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return ErrWebhookFailed
+	}
+	return nil
+}
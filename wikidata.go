@@ -0,0 +1,162 @@
+package styx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	rdf "github.com/underlay/go-rdfjs"
+)
+
+const (
+	wikidataEntity    = "http://www.wikidata.org/entity/"
+	wikidataDirect    = "http://www.wikidata.org/prop/direct/"
+	rdfsLabel         = "http://www.w3.org/2000/01/rdf-schema#label"
+	schemaDescription = "http://schema.org/description"
+	xsdDecimal        = "http://www.w3.org/2001/XMLSchema#decimal"
+	geoWktLiteral     = "http://www.opengis.net/ont/geosparql#wktLiteral"
+)
+
+type wikidataText struct {
+	Language string `json:"language"`
+	Value    string `json:"value"`
+}
+
+type wikidataEntityRecord struct {
+	ID           string                     `json:"id"`
+	Labels       map[string]wikidataText    `json:"labels"`
+	Descriptions map[string]wikidataText    `json:"descriptions"`
+	Claims       map[string][]wikidataClaim `json:"claims"`
+}
+
+type wikidataClaim struct {
+	Rank     string `json:"rank"`
+	Mainsnak struct {
+		SnakType  string `json:"snaktype"`
+		DataValue struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"datavalue"`
+	} `json:"mainsnak"`
+}
+
+// ImportWikidata loads a Wikidata JSON dump (a JSON array with one entity per line).
+// Each entity becomes its own dataset, named by appending "/" and the entity's ID
+// to the given node, so the dump is streamed one entity at a time. Like merged
+// datasets, entities are written without the store's hooks, detection rules,
+// signers or quota. Labels and descriptions become language-tagged literals, and the
+// values of non-deprecated claims become "truthy" wdt: statements, with entity values
+// as IRIs and times, quantities and coordinates as typed literals. Claims with unknown
+// or missing values are skipped.
+func (s *Store) ImportWikidata(ctx context.Context, node rdf.Term, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			entity := strings.TrimRight(strings.TrimSpace(string(line)), ",")
+			if entity != "" && entity != "[" && entity != "]" {
+				record := &wikidataEntityRecord{}
+				if err := json.Unmarshal([]byte(entity), record); err != nil {
+					return err
+				}
+
+				dataset := rdf.NewNamedNode(node.Value() + "/" + record.ID)
+				if err := s.setInternal(ctx, dataset, record.quads()); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (record *wikidataEntityRecord) quads() []*rdf.Quad {
+	subject := rdf.NewNamedNode(wikidataEntity + record.ID)
+	quads := []*rdf.Quad{}
+	for _, label := range record.Labels {
+		object := rdf.NewLiteral(label.Value, label.Language, rdf.RDFLangString)
+		quads = append(quads, rdf.NewQuad(subject, rdf.NewNamedNode(rdfsLabel), object, rdf.Default))
+	}
+
+	for _, description := range record.Descriptions {
+		object := rdf.NewLiteral(description.Value, description.Language, rdf.RDFLangString)
+		quads = append(quads, rdf.NewQuad(subject, rdf.NewNamedNode(schemaDescription), object, rdf.Default))
+	}
+
+	for property, claims := range record.Claims {
+		predicate := rdf.NewNamedNode(wikidataDirect + property)
+		for _, claim := range claims {
+			if claim.Rank == "deprecated" || claim.Mainsnak.SnakType != "value" {
+				continue
+			}
+
+			value := claim.Mainsnak.DataValue
+			if object := wikidataValue(value.Type, value.Value); object != nil {
+				quads = append(quads, rdf.NewQuad(subject, predicate, object, rdf.Default))
+			}
+		}
+	}
+
+	return quads
+}
+
+func wikidataValue(t string, raw json.RawMessage) rdf.Term {
+	switch t {
+	case "string":
+		var value string
+		if json.Unmarshal(raw, &value) == nil {
+			return rdf.NewLiteral(value, "", nil)
+		}
+	case "wikibase-entityid":
+		var value struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(raw, &value) == nil && value.ID != "" {
+			return rdf.NewNamedNode(wikidataEntity + value.ID)
+		}
+	case "monolingualtext":
+		var value struct {
+			Text     string `json:"text"`
+			Language string `json:"language"`
+		}
+		if json.Unmarshal(raw, &value) == nil {
+			return rdf.NewLiteral(value.Text, value.Language, rdf.RDFLangString)
+		}
+	case "time":
+		var value struct {
+			Time string `json:"time"`
+		}
+		if json.Unmarshal(raw, &value) == nil {
+			return rdf.NewLiteral(strings.TrimPrefix(value.Time, "+"), "", rdf.NewNamedNode(xsdDateTime))
+		}
+	case "quantity":
+		var value struct {
+			Amount string `json:"amount"`
+		}
+		if json.Unmarshal(raw, &value) == nil {
+			return rdf.NewLiteral(strings.TrimPrefix(value.Amount, "+"), "", rdf.NewNamedNode(xsdDecimal))
+		}
+	case "globecoordinate":
+		var value struct {
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		}
+		if json.Unmarshal(raw, &value) == nil {
+			point := fmt.Sprintf("Point(%v %v)", value.Longitude, value.Latitude)
+			return rdf.NewLiteral(point, "", rdf.NewNamedNode(geoWktLiteral))
+		}
+	}
+	return nil
+}